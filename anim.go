@@ -0,0 +1,224 @@
+package qoi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+)
+
+// The animation container starts with a header of animMagic, the big-endian uint32 width and height of the
+// frames, the uint32 amount of frames and the int32 loop count. Each frame follows as a uint32 delay in
+// milliseconds, a byte stating its kind, a uint32 length and that many bytes holding a QOI file.
+const (
+	animMagic       = "qoia"
+	animHeaderSize  = 20
+	frameHeaderSize = 9
+)
+
+// Kinds of frames in the animation container.
+const (
+	// frameFull is a frame stored as a QOI file of its own.
+	frameFull byte = 0
+	// frameDelta is a frame stored as its difference to the preceding frame, as written by DeltaEncoder.
+	frameDelta byte = 1
+)
+
+// Frame is a frame of an Animation.
+type Frame struct {
+	Image image.Image
+	// Delay is the time the frame is displayed for, stored with millisecond precision.
+	Delay time.Duration
+}
+
+// Animation is a sequence of frames of the same size, like gif.GIF.
+type Animation struct {
+	// Frames holds the frames of the animation. DecodeAnimation stores frames as *Image.
+	Frames []Frame
+	// LoopCount controls how often the animation is restarted, with the meaning of gif.GIF.LoopCount: 0
+	// means to loop forever, -1 to show each frame once, and any other value n to play the animation n+1
+	// times.
+	LoopCount int
+}
+
+// EncodeAnimation writes anim to w in the QOI animation container format.
+func EncodeAnimation(w io.Writer, anim *Animation) error {
+	var enc Encoder
+	return enc.EncodeAnimation(w, anim)
+}
+
+// EncodeAnimation is like the package-level EncodeAnimation, but encodes the frames using the settings of
+// enc.
+func (enc *Encoder) EncodeAnimation(w io.Writer, anim *Animation) error {
+	if len(anim.Frames) == 0 {
+		return fmt.Errorf("animation has no frames")
+	}
+	if uint64(len(anim.Frames)) > math.MaxUint32 {
+		return fmt.Errorf("animation has %d frames, more than the maximum of %d", len(anim.Frames), uint32(math.MaxUint32))
+	}
+	if anim.LoopCount < -1 || anim.LoopCount > math.MaxInt32 {
+		return fmt.Errorf("invalid loop count %d", anim.LoopCount)
+	}
+	size := anim.Frames[0].Image.Bounds().Size()
+	if err := checkDimensions(size.X, size.Y); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	var header [animHeaderSize]byte
+	copy(header[:4], animMagic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(size.X))
+	binary.BigEndian.PutUint32(header[8:12], uint32(size.Y))
+	binary.BigEndian.PutUint32(header[12:16], uint32(len(anim.Frames)))
+	binary.BigEndian.PutUint32(header[16:20], uint32(int32(anim.LoopCount)))
+	if _, err := out.Write(header[:]); err != nil {
+		return err
+	}
+	var buf, deltaBuf bytes.Buffer
+	de := DeltaEncoder{Encoder: *enc}
+	for i, frame := range anim.Frames {
+		if frameSize := frame.Image.Bounds().Size(); frameSize != size {
+			return fmt.Errorf("frame %d: size %dx%d differs from size %dx%d of first frame", i, frameSize.X, frameSize.Y, size.X, size.Y)
+		}
+		delay := frame.Delay.Milliseconds()
+		if delay < 0 || delay > math.MaxUint32 {
+			return fmt.Errorf("frame %d: invalid delay %v", i, frame.Delay)
+		}
+		buf.Reset()
+		if err := enc.Encode(&buf, frame.Image); err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		kind, data := frameFull, buf.Bytes()
+		if enc.DeltaFrames && i > 0 {
+			deltaBuf.Reset()
+			if err := de.Encode(&deltaBuf, anim.Frames[i-1].Image, frame.Image); err != nil {
+				return fmt.Errorf("frame %d: %w", i, err)
+			}
+			if deltaBuf.Len() < len(data) {
+				kind, data = frameDelta, deltaBuf.Bytes()
+			}
+		}
+		if err := writeFrame(out, uint32(delay), kind, data); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+func writeFrame(out *bufio.Writer, delay uint32, kind byte, data []byte) error {
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], delay)
+	header[4] = kind
+	binary.BigEndian.PutUint32(header[5:], uint32(len(data)))
+	if _, err := out.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := out.Write(data)
+	return err
+}
+
+// DecodeAnimation reads an animation in the QOI animation container format from r.
+func DecodeAnimation(r io.Reader) (*Animation, error) {
+	var dec Decoder
+	return dec.DecodeAnimation(r)
+}
+
+// DecodeAnimation is like the package-level DecodeAnimation, but decodes the frames using the settings of
+// dec. Frames stored as their difference to the preceding frame have 4 channels unless the preceding frame
+// has 3 and they are opaque, or Channels is set.
+func (dec *Decoder) DecodeAnimation(r io.Reader) (*Animation, error) {
+	in := bufio.NewReader(r)
+	var header [animHeaderSize]byte
+	if _, err := io.ReadFull(in, header[:]); err != nil {
+		return nil, fmt.Errorf("could not read animation header: %w", truncated(err))
+	}
+	if string(header[:4]) != animMagic {
+		return nil, fmt.Errorf("%w: animation must start with %q, got %q", ErrBadMagic, animMagic, header[:4])
+	}
+	width := binary.BigEndian.Uint32(header[4:8])
+	height := binary.BigEndian.Uint32(header[8:12])
+	numFrames := binary.BigEndian.Uint32(header[12:16])
+	anim := &Animation{LoopCount: int(int32(binary.BigEndian.Uint32(header[16:20])))}
+	// Delta frames need the preceding frame as it was encoded, so frames are decoded without the
+	// transformations of dec, which are applied to a copy afterwards.
+	if err := dec.checkConversions(); err != nil {
+		return nil, err
+	}
+	plain := *dec
+	plain.Channels, plain.FlipVertical, plain.BGRA = 0, false, false
+	plain.ConvertColorspace, plain.Premultiply, plain.Gamma, plain.ColorTransformer, plain.Swizzle = false, false, 0, nil, ""
+	var prev *Image
+	// The frame count is not trusted for allocating, as corrupt data could state an arbitrarily large one.
+	for i := 0; uint64(i) < uint64(numFrames); i++ {
+		var frameHeader [frameHeaderSize]byte
+		if _, err := io.ReadFull(in, frameHeader[:]); err != nil {
+			return nil, fmt.Errorf("frame %d: could not read frame header: %w", i, truncated(err))
+		}
+		delay := time.Duration(binary.BigEndian.Uint32(frameHeader[:4])) * time.Millisecond
+		kind := frameHeader[4]
+		length := int64(binary.BigEndian.Uint32(frameHeader[5:]))
+		data := io.LimitReader(in, length)
+		var img *Image
+		var err error
+		switch {
+		case kind == frameFull:
+			img, err = plain.Decode(data)
+		case kind == frameDelta && prev != nil:
+			if img, err = plain.decodeDelta(data, prev); err == nil && prev.Channels == 3 {
+				img.DropAlpha(true)
+			}
+		case kind == frameDelta:
+			err = fmt.Errorf("first frame cannot be stored as a difference")
+		default:
+			err = fmt.Errorf("unknown kind of frame %d", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		if uint32(img.Width) != width || uint32(img.Height) != height {
+			return nil, fmt.Errorf("frame %d: size %dx%d differs from size %dx%d of animation", i, img.Width, img.Height, width, height)
+		}
+		// Skip what the decoder left unread, such as the end marker.
+		if _, err = io.Copy(io.Discard, data); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		prev = img
+		anim.Frames = append(anim.Frames, Frame{Image: dec.transformFrame(img), Delay: delay})
+	}
+	return anim, nil
+}
+
+// transformFrame returns img with the transformations of dec applied, copying it if there are any.
+func (dec *Decoder) transformFrame(img *Image) *Image {
+	unchanged := dec.Channels == 0 && !dec.FlipVertical && !dec.BGRA && !dec.Premultiply &&
+		gammaTable(dec.Gamma) == nil && dec.ColorTransformer == nil && dec.Swizzle == "" &&
+		(!dec.ConvertColorspace || img.Colorspace == dec.Colorspace)
+	if unchanged {
+		return img
+	}
+	img = img.Clone()
+	// Convert the channels first and then transform and convert the pixels in the order Decode does, so that
+	// frames come out as they would when decoded as images.
+	switch dec.Channels {
+	case 3:
+		if dec.CompositeAlpha {
+			img.DropAlphaOver(dec.Background)
+		} else {
+			img.DropAlpha(false)
+		}
+	case 4:
+		img.ExpandAlpha()
+	}
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		dec.transformRow(img.Pix[i:i+img.Width*int(img.Channels)], int(img.Channels))
+	}
+	if dec.FlipVertical {
+		img.FlipVertical()
+	}
+	dec.postprocess(img)
+	return img
+}
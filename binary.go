@@ -0,0 +1,24 @@
+package qoi
+
+import "bytes"
+
+// MarshalBinary encodes img as a QOI file, implementing encoding.BinaryMarshaler. The channels and colorspace
+// of img are preserved.
+func (img *Image) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := Encoder{Channels: img.Channels}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the QOI file in data into img, implementing encoding.BinaryUnmarshaler.
+func (img *Image) UnmarshalBinary(data []byte) error {
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		return err
+	}
+	*img = *decoded
+	return nil
+}
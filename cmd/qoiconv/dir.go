@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// convertDir converts all images in inDir and its subdirectories which are not in the format of opts.toExt,
+// writing them to the same relative paths in outDir with their extension replaced by it. Up to jobs files are
+// converted in parallel. Each file is reported to progress as it completes, and failing files do not stop the
+// others; convertDir returns an error if any failed.
+func convertDir(inDir, outDir string, jobs int, opts options, progress io.Writer) error {
+	format := extensions[opts.toExt]
+	if jobs < 1 {
+		return fmt.Errorf("invalid amount of parallel jobs %d: must be at least 1", jobs)
+	}
+	var paths []string
+	err := filepath.WalkDir(inDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if inFormat, ok := extensions[strings.ToLower(filepath.Ext(path))]; ok && inFormat != format {
+			rel, err := filepath.Rel(inDir, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		rel string
+		err error
+	}
+	work := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range work {
+				outPath := filepath.Join(outDir, strings.TrimSuffix(rel, filepath.Ext(rel))+opts.toExt)
+				err := os.MkdirAll(filepath.Dir(outPath), 0777)
+				if err == nil {
+					err = convert(filepath.Join(inDir, rel), outPath, opts)
+				}
+				results <- result{rel: rel, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, rel := range paths {
+			work <- rel
+		}
+		close(work)
+		wg.Wait()
+		close(results)
+	}()
+
+	done, failed := 0, 0
+	for r := range results {
+		done++
+		if r.err != nil {
+			failed++
+			fmt.Fprintf(progress, "[%d/%d] %s: %v\n", done, len(paths), r.rel, r.err)
+			continue
+		}
+		fmt.Fprintf(progress, "[%d/%d] %s\n", done, len(paths), r.rel)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to convert", failed, len(paths))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestConvertDir(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 16, Height: 16, Alpha: qoitest.BinaryAlpha, RunLength: 4, Colors: 16,
+	})
+	pngContent := bytes.NewBuffer(nil)
+	if err := png.Encode(pngContent, img); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"a.png":          pngContent.Bytes(),
+		"sub/b.PNG":      pngContent.Bytes(),
+		"sub/deep/c.png": pngContent.Bytes(),
+		"sub/notes.txt":  []byte("not an image"),
+		"broken.png":     []byte("not a PNG"),
+	}
+	for name, content := range files {
+		path := filepath.Join(in, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	progress := bytes.NewBuffer(nil)
+	if err := convertDir(in, out, 3, options{toExt: ".qoi"}, progress); err == nil {
+		t.Fatal("expected error for broken file")
+	}
+	if lines := strings.Count(progress.String(), "\n"); lines != 4 {
+		t.Fatalf("expected 4 lines of progress, got:\n%s", progress)
+	}
+	for _, name := range []string{"a.qoi", "sub/b.qoi", "sub/deep/c.qoi"} {
+		qoitest.RequireImagesEqual(t, readQOI(t, filepath.Join(out, filepath.FromSlash(name))), img)
+	}
+	for _, name := range []string{"broken.qoi", "sub/notes.qoi"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(name))); err == nil {
+			t.Fatalf("expected no output for %s", name)
+		}
+	}
+
+	// Files converted before are overwritten only with force.
+	os.Remove(filepath.Join(in, "broken.png"))
+	if err := convertDir(in, out, 1, options{toExt: ".qoi"}, progress); err == nil {
+		t.Fatal("expected error for existing outputs without force")
+	}
+	if err := convertDir(in, out, 1, options{toExt: ".qoi", force: true}, progress); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,366 @@
+// Command qoiconv converts images between QOI and PNG, JPEG, GIF, BMP and TIFF, in either direction.
+//
+// Usage:
+//
+//	qoiconv [flags] input output
+//	qoiconv [flags] inputdir outputdir
+//
+// The formats of input and output are chosen by their file extensions: .qoi, .png, .jpg or .jpeg, .gif,
+// .bmp, and .tif or .tiff. An input of - reads standard input, whose format is detected from its content,
+// and an output of - writes standard output in the format given by -to, so that qoiconv can be used in
+// pipelines:
+//
+//	curl -s https://example.com/image.qoi | qoiconv - image.png
+//	qoiconv -to png image.qoi - | display
+//
+// If input is a directory, all images in it and its subdirectories are converted to the format given by -to
+// and written to outputdir, with the same directory structure and their extensions replaced. Images already
+// in that format are left out. Files are converted by -j workers in parallel, and each converted file is
+// reported on standard error as it completes. Files failing to convert do not stop the others.
+//
+// The flags are:
+//
+//	-channels n
+//		channels of QOI output: 3 drops alpha, 4 keeps it, and 0 chooses 3 for opaque images and 4
+//		otherwise. For QOI input converted to other formats, 3 drops alpha while decoding instead.
+//	-colorspace name
+//		colorspace of QOI output, srgb or linear. Pixels are converted if the input is in the other
+//		colorspace. If empty, the colorspace of QOI input is kept, and other formats are taken to be sRGB.
+//		QOI input in linear RGB is always converted to sRGB for other formats.
+//	-f
+//		overwrite output if it exists, rather than failing.
+//	-to ext
+//		file extension of the format to convert to in directory mode or when writing standard output. The
+//		default is qoi.
+//	-j n
+//		amount of files to convert in parallel in directory mode. The default is the amount of CPUs.
+//	-strip-metadata
+//		drop the metadata of QOI input. Otherwise, it is kept when converting QOI to QOI.
+//	-set-comment text
+//		replace the comments of QOI output with text.
+//	-icc file
+//		embed the ICC profile read from file in QOI output, replacing that of QOI input.
+//
+// Metadata is only written to QOI files, in the chunks following the end marker written by
+// qoi.Encoder.Metadata, and other formats are converted without it. -set-comment and -icc fail for output
+// in other formats.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Zyl9393/qoi"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// options holds the settings given by flags.
+type options struct {
+	channels uint8
+	// colorspace is the colorspace of QOI output, if setColorspace is true.
+	colorspace    qoi.Colorspace
+	setColorspace bool
+	force         bool
+	// toExt is the file extension of the format to convert to when it is not given by the output path, as in
+	// directory mode or when writing standard output.
+	toExt string
+	// stripMetadata drops the metadata of QOI input rather than keeping it for QOI output.
+	stripMetadata bool
+	// comment replaces the comments of QOI output if not empty, and icc its ICC profile if not nil.
+	comment string
+	icc     []byte
+}
+
+// extensions maps file extensions to the formats they stand for.
+var extensions = map[string]string{
+	".qoi":  "qoi",
+	".png":  "png",
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".gif":  "gif",
+	".bmp":  "bmp",
+	".tif":  "tiff",
+	".tiff": "tiff",
+}
+
+// decoders and encoders hold the functions reading and writing each format other than QOI.
+var (
+	decoders = map[string]func(r io.Reader) (image.Image, error){
+		"png":  png.Decode,
+		"jpeg": jpeg.Decode,
+		"gif":  gif.Decode,
+		"bmp":  bmp.Decode,
+		"tiff": tiff.Decode,
+	}
+	encoders = map[string]func(w io.Writer, img image.Image) error{
+		"png": png.Encode,
+		"jpeg": func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, nil)
+		},
+		"gif": func(w io.Writer, img image.Image) error {
+			// The palette is chosen by median cut, which suits most images far better than the default Plan 9
+			// palette.
+			return gif.Encode(w, img, &gif.Options{NumColors: 256, Quantizer: &qoi.Quantizer{}})
+		},
+		"bmp": bmp.Encode,
+		"tiff": func(w io.Writer, img image.Image) error {
+			return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+		},
+	}
+)
+
+func main() {
+	channels := flag.Uint("channels", 0, "channels of QOI output: 3, 4, or 0 to omit alpha only if all pixels are opaque")
+	colorspace := flag.String("colorspace", "", "colorspace of QOI output: srgb or linear, or empty to keep the input's")
+	force := flag.Bool("f", false, "overwrite output if it exists")
+	to := flag.String("to", "qoi", "file extension of the format to convert to in directory mode or for standard output")
+	jobs := flag.Int("j", runtime.NumCPU(), "amount of files to convert in parallel in directory mode")
+	strip := flag.Bool("strip-metadata", false, "drop the metadata of QOI input")
+	comment := flag.String("set-comment", "", "replace the comments of QOI output with the given text")
+	iccPath := flag.String("icc", "", "embed the ICC profile read from the given file in QOI output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: qoiconv [flags] input output\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       qoiconv [flags] inputdir outputdir\n\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "Converts between QOI and PNG, JPEG, GIF, BMP and TIFF, chosen by file extension.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts, err := parseOptions(*channels, *colorspace, *to, *force)
+	if err == nil {
+		opts.stripMetadata, opts.comment = *strip, *comment
+		if *iccPath != "" {
+			opts.icc, err = os.ReadFile(*iccPath)
+		}
+	}
+	if err == nil {
+		if info, statErr := os.Stat(flag.Arg(0)); statErr == nil && info.IsDir() {
+			err = convertDir(flag.Arg(0), flag.Arg(1), *jobs, opts, os.Stderr)
+		} else {
+			err = convert(flag.Arg(0), flag.Arg(1), opts)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "qoiconv: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseOptions validates the values of the flags.
+func parseOptions(channels uint, colorspace, to string, force bool) (options, error) {
+	opts := options{force: force, toExt: "." + strings.TrimPrefix(strings.ToLower(to), ".")}
+	if _, ok := extensions[opts.toExt]; !ok {
+		return options{}, fmt.Errorf("invalid format %q to convert to: must be qoi, png, jpg, jpeg, gif, bmp, tif or tiff", to)
+	}
+	if channels != 0 && channels != 3 && channels != 4 {
+		return options{}, fmt.Errorf("invalid channels %d: must be 0, 3 or 4", channels)
+	}
+	opts.channels = uint8(channels)
+	switch strings.ToLower(colorspace) {
+	case "":
+	case "srgb":
+		opts.colorspace, opts.setColorspace = qoi.SRGB, true
+	case "linear":
+		opts.colorspace, opts.setColorspace = qoi.Linear, true
+	default:
+		return options{}, fmt.Errorf("invalid colorspace %q: must be srgb or linear", colorspace)
+	}
+	return opts, nil
+}
+
+// formatOf returns the format of the file at path by its extension.
+func formatOf(path string) (string, error) {
+	format, ok := extensions[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("%s: unknown file extension: must be .qoi, .png, .jpg, .jpeg, .gif, .bmp, .tif or .tiff", path)
+	}
+	return format, nil
+}
+
+// convert converts the image at inPath to the format of outPath and writes it there. Either path may be - for
+// standard input or output.
+func convert(inPath, outPath string, opts options) error {
+	var inFormat, outFormat string
+	var err error
+	if inPath != "-" {
+		if inFormat, err = formatOf(inPath); err != nil {
+			return err
+		}
+	}
+	if outPath == "-" {
+		outFormat = extensions[opts.toExt]
+	} else {
+		if outFormat, err = formatOf(outPath); err != nil {
+			return err
+		}
+		if !opts.force {
+			// Check early, so that the input is not decoded in vain.
+			if _, err := os.Stat(outPath); err == nil {
+				return fmt.Errorf("%s already exists; use -f to overwrite it", outPath)
+			}
+		}
+	}
+	if outFormat != "qoi" && (opts.comment != "" || opts.icc != nil) {
+		return fmt.Errorf("cannot set metadata of %s: only QOI files hold metadata", outFormat)
+	}
+	img, metadata, err := readImage(inPath, inFormat, outFormat == "qoi", opts)
+	if err != nil {
+		return err
+	}
+	if outFormat == "qoi" {
+		metadata = setMetadata(metadata, opts)
+	}
+	return writeImage(outPath, outFormat, img, metadata, opts)
+}
+
+// setMetadata returns m, which may be nil, with the metadata set by opts, or nil if it holds none.
+func setMetadata(m *qoi.Metadata, opts options) *qoi.Metadata {
+	if m == nil {
+		m = new(qoi.Metadata)
+	}
+	if opts.comment != "" {
+		m.Comments = []string{opts.comment}
+	}
+	if opts.icc != nil {
+		m.ICCProfile = opts.icc
+	}
+	if m.ICCProfile == nil && m.EXIF == nil && len(m.Comments) == 0 {
+		return nil
+	}
+	return m
+}
+
+// magics maps the bytes files of each format start with to the format.
+var magics = []struct {
+	magic, format string
+}{
+	{"qoif", "qoi"},
+	{"\x89PNG\r\n\x1a\n", "png"},
+	{"\xff\xd8", "jpeg"},
+	{"GIF8", "gif"},
+	{"BM", "bmp"},
+	{"II*\x00", "tiff"},
+	{"MM\x00*", "tiff"},
+}
+
+// sniff returns the format of the image at the start of r, which is left unread.
+func sniff(r *bufio.Reader) (string, error) {
+	// Peek fails if the input is shorter than 8 bytes, but returns what there is, which is enough to detect
+	// formats with shorter magics.
+	b, _ := r.Peek(8)
+	for _, m := range magics {
+		if strings.HasPrefix(string(b), m.magic) {
+			return m.format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown image format: must be QOI, PNG, JPEG, GIF, BMP or TIFF")
+}
+
+// readImage decodes the image at path in the given format, or in the format detected if path is - for
+// standard input. QOI input is decoded as is along with its metadata for QOI output, unless opts strips it,
+// and as sRGB with the channels of opts without metadata otherwise.
+func readImage(path, format string, toQOI bool, opts options) (image.Image, *qoi.Metadata, error) {
+	var r io.Reader
+	name := path
+	if path == "-" {
+		name = "standard input"
+		in := bufio.NewReader(os.Stdin)
+		var err error
+		if format, err = sniff(in); err != nil {
+			return nil, nil, fmt.Errorf("could not decode %s: %w", name, err)
+		}
+		r = in
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var img image.Image
+	var metadata *qoi.Metadata
+	var err error
+	if format == "qoi" {
+		var dec qoi.Decoder
+		switch {
+		case !toQOI:
+			dec.Channels = opts.channels
+			dec.ConvertColorspace, dec.Colorspace = true, qoi.SRGB
+			img, err = dec.Decode(r)
+		case opts.stripMetadata:
+			img, err = dec.Decode(r)
+		default:
+			img, metadata, err = dec.DecodeWithMetadata(r)
+		}
+	} else {
+		img, err = decoders[format](bufio.NewReader(r))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decode %s: %w", name, err)
+	}
+	return img, metadata, nil
+}
+
+// writeImage encodes img in the given format, along with metadata for QOI, and writes it to path, which must
+// not exist unless opts.force is set, or to standard output if path is -. If encoding to a file fails, the
+// incomplete file is removed.
+func writeImage(path, format string, img image.Image, metadata *qoi.Metadata, opts options) error {
+	if path == "-" {
+		if err := encodeImage(os.Stdout, format, img, metadata, opts); err != nil {
+			return fmt.Errorf("could not encode to standard output: %w", err)
+		}
+		return nil
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !opts.force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists; use -f to overwrite it", path)
+		}
+		return err
+	}
+	err = encodeImage(f, format, img, metadata, opts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("could not encode %s: %w", path, err)
+	}
+	return nil
+}
+
+// encodeImage encodes img in the given format, along with metadata for QOI, and writes it to w.
+func encodeImage(w io.Writer, format string, img image.Image, metadata *qoi.Metadata, opts options) error {
+	if format == "qoi" {
+		enc := qoi.Encoder{Channels: opts.channels, Metadata: metadata}
+		if opts.setColorspace {
+			enc.ConvertColorspace, enc.Colorspace = true, opts.colorspace
+		}
+		return enc.Encode(w, img)
+	}
+	out := bufio.NewWriter(w)
+	if err := encoders[format](out, img); err != nil {
+		return err
+	}
+	return out.Flush()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 40, Height: 30, Alpha: qoitest.Opaque, RunLength: 4, Colors: 16,
+	})
+	src := filepath.Join(dir, "src.qoi")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qoi.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Lossless formats must convert back to the same pixels. The image is opaque, as BMP files written by
+	// golang.org/x/image/bmp lose the colors of transparent pixels.
+	for _, ext := range []string{".png", ".bmp", ".tiff"} {
+		converted, back := filepath.Join(dir, "img"+ext), filepath.Join(dir, "back"+ext+".qoi")
+		if err := convert(src, converted, options{}); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if err := convert(converted, back, options{}); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		qoitest.RequireImagesEqual(t, readQOI(t, back), img)
+	}
+
+	out := filepath.Join(dir, "img.png")
+	if err := convert(src, out, options{}); err == nil {
+		t.Fatal("expected error for existing output without force")
+	}
+	if err := convert(src, out, options{force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := convert(src, filepath.Join(dir, "img.webp"), options{}); err == nil {
+		t.Fatal("expected error for unknown extension")
+	}
+
+	opts, err := parseOptions(4, "linear", "qoi", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = filepath.Join(dir, "opaque.qoi")
+	if err := convert(filepath.Join(dir, "img.png"), out, opts); err != nil {
+		t.Fatal(err)
+	}
+	decoded := readQOI(t, out)
+	if decoded.Channels != 4 || decoded.Colorspace != qoi.Linear {
+		t.Fatalf("expected 4 channels in linear RGB, got %d channels in colorspace %d", decoded.Channels, decoded.Colorspace)
+	}
+	if _, err := parseOptions(2, "", "qoi", false); err == nil {
+		t.Fatal("expected error for 2 channels")
+	}
+	if _, err := parseOptions(0, "cmyk", "qoi", false); err == nil {
+		t.Fatal("expected error for unknown colorspace")
+	}
+	if _, err := parseOptions(0, "", "webp", false); err == nil {
+		t.Fatal("expected error for unknown format to convert to")
+	}
+}
+
+func readQOI(t *testing.T, path string) *qoi.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := qoi.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestSniff(t *testing.T) {
+	dir := t.TempDir()
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 8, Height: 8, Alpha: qoitest.Opaque, RunLength: 4, Colors: 16,
+	})
+	for _, ext := range []string{".qoi", ".png", ".jpg", ".gif", ".bmp", ".tiff"} {
+		path := filepath.Join(dir, "img"+ext)
+		format, err := formatOf(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := bytes.NewBuffer(nil)
+		if err := encodeImage(content, format, img, nil, options{}); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		sniffed, err := sniff(bufio.NewReader(content))
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if sniffed != format {
+			t.Fatalf("%s: sniffed format %s, expected %s", ext, sniffed, format)
+		}
+	}
+	if _, err := sniff(bufio.NewReader(strings.NewReader("no"))); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	dir := t.TempDir()
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 8, Height: 8, Alpha: qoitest.Opaque, RunLength: 4, Colors: 16,
+	})
+	src := filepath.Join(dir, "src.qoi")
+	content := bytes.NewBuffer(nil)
+	enc := qoi.Encoder{Metadata: &qoi.Metadata{EXIF: []byte("exif"), Comments: []string{"original"}}}
+	if err := enc.Encode(content, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, content.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	readMetadata := func(path string) *qoi.Metadata {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, m, err := qoi.DecodeWithMetadata(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	kept := filepath.Join(dir, "kept.qoi")
+	if err := convert(src, kept, options{}); err != nil {
+		t.Fatal(err)
+	}
+	if m := readMetadata(kept); string(m.EXIF) != "exif" || len(m.Comments) != 1 || m.Comments[0] != "original" {
+		t.Fatalf("metadata not kept: %+v", m)
+	}
+	set := filepath.Join(dir, "set.qoi")
+	if err := convert(src, set, options{comment: "new", icc: []byte("icc")}); err != nil {
+		t.Fatal(err)
+	}
+	if m := readMetadata(set); string(m.EXIF) != "exif" || string(m.ICCProfile) != "icc" || len(m.Comments) != 1 || m.Comments[0] != "new" {
+		t.Fatalf("metadata not set: %+v", m)
+	}
+	stripped := filepath.Join(dir, "stripped.qoi")
+	if err := convert(src, stripped, options{stripMetadata: true, comment: "only"}); err != nil {
+		t.Fatal(err)
+	}
+	if m := readMetadata(stripped); m.EXIF != nil || len(m.Comments) != 1 || m.Comments[0] != "only" {
+		t.Fatalf("metadata not stripped: %+v", m)
+	}
+	if err := convert(src, filepath.Join(dir, "img.png"), options{comment: "lost"}); err == nil {
+		t.Fatal("expected error for setting metadata of PNG")
+	}
+}
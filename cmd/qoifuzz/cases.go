@@ -0,0 +1,132 @@
+package main
+
+import "encoding/binary"
+
+// testCase is a QOI file exercising a boundary of the format or of decoders.
+type testCase struct {
+	name string
+	// valid reports whether the file is well-formed: its header is valid and its ops produce exactly the
+	// pixels it states, followed by the end marker and nothing else.
+	valid bool
+	data  []byte
+}
+
+var endMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// stream builds the content of a QOI file.
+type stream []byte
+
+func newStream(width, height uint32, channels, colorspace byte) stream {
+	s := make(stream, 14)
+	copy(s, "qoif")
+	binary.BigEndian.PutUint32(s[4:], width)
+	binary.BigEndian.PutUint32(s[8:], height)
+	s[12], s[13] = channels, colorspace
+	return s
+}
+
+func (s stream) rgb(r, g, b byte) stream     { return append(s, 0xfe, r, g, b) }
+func (s stream) rgba(r, g, b, a byte) stream { return append(s, 0xff, r, g, b, a) }
+func (s stream) index(i int) stream          { return append(s, byte(i)) }
+
+// run appends ops repeating the previous pixel n times, using runs of the maximum length of 62 where possible.
+func (s stream) run(n int) stream {
+	for ; n > 0; n -= 62 {
+		l := n
+		if l > 62 {
+			l = 62
+		}
+		s = append(s, 0xc0|byte(l-1))
+	}
+	return s
+}
+
+// diff appends a DIFF op; dr, dg and db must be in -2..1.
+func (s stream) diff(dr, dg, db int) stream {
+	return append(s, 0x40|byte(dr+2)<<4|byte(dg+2)<<2|byte(db+2))
+}
+
+// luma appends a LUMA op; dg must be in -32..31, and dr-dg and db-dg in -8..7.
+func (s stream) luma(dg, drdg, dbdg int) stream {
+	return append(s, 0x80|byte(dg+32), byte(drdg+8)<<4|byte(dbdg+8))
+}
+
+func (s stream) end() stream { return append(s, endMarker...) }
+
+// hash returns the index position of a color.
+func hash(r, g, b, a byte) int {
+	return (int(r)*3 + int(g)*5 + int(b)*7 + int(a)*11) % 64
+}
+
+// cases returns the corpus. Each case is deterministic, so that corpora generated by different runs are
+// identical.
+func cases() []testCase {
+	var cs []testCase
+	add := func(name string, valid bool, data []byte) {
+		cs = append(cs, testCase{name: name, valid: valid, data: data})
+	}
+
+	// Ops at their boundaries.
+	add("single-rgb", true, newStream(1, 1, 3, 0).rgb(1, 2, 3).end())
+	add("single-rgba", true, newStream(1, 1, 4, 0).rgba(1, 2, 3, 4).end())
+	add("linear-colorspace", true, newStream(1, 1, 3, 1).rgb(1, 2, 3).end())
+	add("rgba-op-in-3-channel-image", true, newStream(2, 1, 3, 0).rgba(1, 2, 3, 4).rgb(5, 6, 7).end())
+	add("run-at-start", true, newStream(4, 4, 4, 0).run(16).end())
+	add("max-runs", true, newStream(62*8, 3, 3, 0).rgb(9, 9, 9).run(62*8*3-1).end())
+	add("runs-across-rows", true, newStream(7, 9, 3, 0).rgb(1, 1, 1).run(10).rgb(2, 2, 2).run(51).end())
+	add("diff-wraparound", true, newStream(3, 1, 3, 0).diff(-2, -1, 1).diff(-2, -2, -2).diff(1, 1, 1).end())
+	add("luma-extremes", true, newStream(4, 1, 4, 0).luma(-32, -8, 7).luma(31, 7, -8).luma(-32, 7, -8).luma(31, -8, 7).end())
+
+	// The index starts out zeroed, and the initial previous pixel, opaque black, is not in it.
+	add("index-unset", true, newStream(2, 2, 4, 0).index(0).index(17).index(63).index(0).end())
+	// Two colors of the same hash, the second overwriting the first in the index.
+	r, g, b := byte(10), byte(20), byte(30)
+	h := hash(r, g, b, 255)
+	collision := newStream(4, 1, 3, 0).rgb(r, g, b).rgb(r+64, g, b).index(h).index(h).end()
+	add("index-collision", true, collision)
+	// All 64 index positions filled and read back in reverse.
+	fill := newStream(16, 8, 4, 0)
+	var hashes []int
+	for i := 0; i < 64; i++ {
+		fill = fill.rgba(byte(i), 0, 0, 255)
+		hashes = append(hashes, hash(byte(i), 0, 0, 255))
+	}
+	for i := len(hashes) - 1; i >= 0; i-- {
+		fill = fill.index(hashes[i])
+	}
+	add("index-full", true, fill.end())
+
+	// Image shapes at their extremes.
+	add("one-row", true, newStream(1000, 1, 3, 0).rgb(1, 2, 3).run(999).end())
+	add("one-column", true, newStream(1, 1000, 3, 0).rgb(1, 2, 3).run(999).end())
+
+	// Headers which are invalid, or state images too large to decode, which decoders must reject without
+	// allocating memory for their pixels first.
+	add("bad-magic", false, append(stream("qoiF"), newStream(1, 1, 3, 0).rgb(1, 2, 3).end()[4:]...))
+	add("zero-width", false, newStream(0, 1, 3, 0).end())
+	add("zero-height", false, newStream(1, 0, 3, 0).end())
+	add("channels-2", false, newStream(1, 1, 2, 0).rgb(1, 2, 3).end())
+	add("channels-5", false, newStream(1, 1, 5, 0).rgb(1, 2, 3).end())
+	add("colorspace-2", false, newStream(1, 1, 3, 2).rgb(1, 2, 3).end())
+	add("giant-header", false, newStream(0xffffffff, 0xffffffff, 4, 0).run(62).end())
+	add("giant-width", false, newStream(0xffffffff, 1, 4, 0).run(62).end())
+	add("giant-height", false, newStream(1, 0xffffffff, 4, 0).run(62).end())
+	add("max-pixels-truncated", false, newStream(20000, 19999, 4, 0).run(62).end())
+
+	// Truncations at every stage of a file.
+	full := newStream(3, 1, 4, 0).rgb(1, 2, 3).rgba(4, 5, 6, 7).luma(1, 1, 1).end()
+	add("empty", false, []byte{})
+	add("truncated-magic", false, full[:2])
+	add("truncated-header", false, full[:10])
+	add("header-only", false, full[:14])
+	add("truncated-op", false, full[:16])
+	add("truncated-luma", false, full[:24])
+	add("missing-end-marker", false, full[:len(full)-len(endMarker)])
+	add("truncated-end-marker", false, full[:len(full)-3])
+
+	// Well-formed ops followed by something else than exactly the end marker.
+	add("bad-end-marker", false, append(newStream(1, 1, 3, 0).rgb(1, 2, 3), 0, 0, 0, 0, 0, 0, 0, 2))
+	add("trailing-data", false, append(newStream(1, 1, 3, 0).rgb(1, 2, 3).end(), "garbage"...))
+	add("extra-pixels", false, newStream(1, 1, 3, 0).rgb(1, 2, 3).rgb(4, 5, 6).end())
+	return cs
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+)
+
+func TestCases(t *testing.T) {
+	names := map[string]bool{}
+	for _, c := range cases() {
+		if names[c.name] {
+			t.Fatalf("duplicate case %s", c.name)
+		}
+		names[c.name] = true
+		dec := qoi.Decoder{Strict: true, MaxBytes: 1 << 24}
+		_, err := dec.DecodeBytes(c.data)
+		_, streamErr := dec.Decode(bytes.NewReader(c.data))
+		if (err == nil) != c.valid || (streamErr == nil) != c.valid {
+			t.Fatalf("%s: expected valid to be %v, but DecodeBytes returned %v and Decode returned %v", c.name, c.valid, err, streamErr)
+		}
+	}
+}
+
+func TestWriteCorpus(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "valid-max-runs.qoi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := qoi.DecodeBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSeedCorpus(dir, "FuzzDecode"); err != nil {
+		t.Fatal(err)
+	}
+	seeds, err := os.ReadDir(filepath.Join(dir, "testdata", "fuzz", "FuzzDecode"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) <= len(cases()) {
+		t.Fatalf("expected more than %d seeds, got %d", len(cases()), len(seeds))
+	}
+}
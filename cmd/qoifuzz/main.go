@@ -0,0 +1,103 @@
+// Command qoifuzz generates a corpus of QOI files exercising boundaries of the format and of decoders: ops at
+// the limits of their ranges, maximum runs, index collisions, image shapes at their extremes, invalid and
+// giant headers, and files truncated at every stage.
+//
+// Usage:
+//
+//	qoifuzz [-go fuzzname] dir
+//
+// By default, the files are written to dir as name.qoi, with names starting with "valid-" for well-formed
+// files and "invalid-" for others, so that other QOI implementations can be smoke-tested by checking that
+// they decode exactly the valid files. Decoders which are lenient about the end marker or trailing data may
+// decode some of the invalid ones as well, but none of the files may make a decoder crash, hang or allocate
+// memory for pixels a file does not hold.
+//
+// With -go, the files are instead written as the seed corpus of the fuzz target fuzzname in the Go package
+// at dir, in the format read by go test -fuzz, alongside the seeds derived by qoi.SeedCorpus from an image
+// covering every op.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+
+	"github.com/Zyl9393/qoi"
+)
+
+func main() {
+	fuzzName := flag.String("go", "", "name of the fuzz target to write the seed corpus of, in the package at dir")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: qoifuzz [-go fuzzname] dir\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	if *fuzzName != "" {
+		err = writeSeedCorpus(flag.Arg(0), *fuzzName)
+	} else {
+		err = writeFiles(flag.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "qoifuzz: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeFiles writes each case to dir as a QOI file.
+func writeFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for _, c := range cases() {
+		prefix := "invalid-"
+		if c.valid {
+			prefix = "valid-"
+		}
+		if err := os.WriteFile(filepath.Join(dir, prefix+c.name+".qoi"), c.data, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSeedCorpus writes the cases and the seeds of qoi.SeedCorpus to the seed corpus of the fuzz target
+// fuzzName in the package at dir.
+func writeSeedCorpus(dir, fuzzName string) error {
+	seeds, err := qoi.SeedCorpus(gradient())
+	if err != nil {
+		return err
+	}
+	for _, c := range cases() {
+		seeds = append(seeds, c.data)
+	}
+	return qoi.WriteSeedCorpus(dir, fuzzName, seeds)
+}
+
+// gradient returns a small image whose encoding uses every op: smooth and steep gradients give DIFF, LUMA
+// and RGB ops, a flat area gives runs and repeated colors give INDEX ops, while varying alpha gives RGBA ops.
+func gradient() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			c := color.NRGBA{R: uint8(x), G: uint8(x * y), B: uint8(y * 40), A: 255}
+			switch {
+			case y >= 12:
+				c = color.NRGBA{R: 200, G: 100, B: 50, A: 255}
+			case y >= 8:
+				c.A = uint8(x * 16)
+			case x%4 == 3:
+				c = color.NRGBA{R: 1, G: 2, B: 3, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
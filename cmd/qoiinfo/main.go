@@ -0,0 +1,189 @@
+// Command qoiinfo prints information about QOI files: the fields of their header, their size and how it
+// compares to the size of their raw pixels.
+//
+// Usage:
+//
+//	qoiinfo [-stats] [-trace] file...
+//	qoiinfo verify [-q] file...
+//
+// With -stats, the stream of ops is walked as well, and the amount of ops of each type is printed along with
+// the pixels they produce and the bytes they take, followed by whether the end marker is present and how
+// many bytes follow it. Walking stops at the first op which is cut off, which is reported along with its
+// pixel, so truncated files can be inspected as well.
+//
+// With -trace, each op is printed as it is walked, with its offset in the file, the index and position of
+// the first pixel it produces, its size and the color it resolves to, as reported by qoi.Trace. This shows
+// exactly where two implementations start to disagree about a file.
+//
+// A file of - reads standard input, so that qoiinfo can inspect the output of other commands:
+//
+//	qoiconv -to qoi image.png - | qoiinfo -stats -
+//
+// The verify subcommand checks files instead, decoding them strictly and verifying their CRC trailer, if
+// present, and prints whether each one is valid, recoverable or corrupt. Its exit code states the worst
+// verdict, making it suitable for gating changes to repositories of images:
+//
+//	0	all files are valid
+//	1	some files are recoverable: all their pixels decode, but their end marker is missing or followed by
+//		unknown data
+//	2	some files are corrupt: their header is invalid, they are cut off before their last pixel, or they do
+//		not match their CRC trailer
+//	3	some files could not be read
+//
+// With -q, only files which are not valid are reported. To inspect a file named verify, pass it as ./verify.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Zyl9393/qoi"
+)
+
+var endMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+func main() {
+	stats := flag.Bool("stats", false, "print the distribution of ops")
+	trace := flag.Bool("trace", false, "print each op with its offset, pixel and color")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: qoiinfo [-stats] [-trace] file...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       qoiinfo verify [-q] file...\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.Arg(0) == "verify" {
+		os.Exit(runVerify(flag.Args()[1:]))
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	failed := false
+	for i, path := range flag.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		name, data, err := readInput(path)
+		if err == nil {
+			err = printInfo(os.Stdout, name, data, *stats)
+		}
+		if err == nil && *trace {
+			err = printTrace(os.Stdout, data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "qoiinfo: %s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// readInput returns the name and content of the file at path, or of standard input if path is -.
+func readInput(path string) (string, []byte, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return "standard input", data, err
+	}
+	data, err := os.ReadFile(path)
+	return path, data, err
+}
+
+// printInfo writes the information about the QOI file named name with the given content to w. It returns
+// an error if the header is invalid or, with stats, the ops are cut off, after writing what it could.
+func printInfo(w io.Writer, name string, data []byte, stats bool) error {
+	fmt.Fprintf(w, "%s:\n", name)
+	fmt.Fprintf(w, "  file size:   %d bytes\n", len(data))
+	header, err := qoi.DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	colorspace := "sRGB"
+	if header.Colorspace() == qoi.Linear {
+		colorspace = "linear RGB"
+	}
+	raw := uint64(header.Width()) * uint64(header.Height()) * uint64(header.Channels())
+	fmt.Fprintf(w, "  dimensions:  %dx%d\n", header.Width(), header.Height())
+	fmt.Fprintf(w, "  channels:    %d\n", header.Channels())
+	fmt.Fprintf(w, "  colorspace:  %s (%d)\n", colorspace, header.Colorspace())
+	fmt.Fprintf(w, "  raw size:    %d bytes\n", raw)
+	fmt.Fprintf(w, "  compression: %.2f%% of raw size\n", float64(len(data))*100/float64(raw))
+	if !stats {
+		return nil
+	}
+
+	s, err := scanOps(data, uint64(header.Width())*uint64(header.Height()))
+	fmt.Fprintf(w, "  ops:\n")
+	for op := range s.ops {
+		fmt.Fprintf(w, "    %-6s %10d ops %12d pixels %12d bytes (%5.1f%%)\n",
+			qoi.Op(op), s.ops[op], s.pixels[op], s.bytes[op], percent(s.bytes[op], uint64(len(data))))
+	}
+	if err != nil {
+		return err
+	}
+	rest := data[s.end:]
+	if !bytes.HasPrefix(rest, endMarker) {
+		fmt.Fprintf(w, "  end marker:  missing\n")
+		return nil
+	}
+	fmt.Fprintf(w, "  end marker:  present\n")
+	fmt.Fprintf(w, "  trailer:     %d bytes\n", len(rest)-len(endMarker))
+	return nil
+}
+
+func percent(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// opStats holds the amount of ops of each type and the amounts of pixels and bytes they account for,
+// indexed by qoi.Op.
+type opStats struct {
+	ops, pixels, bytes [qoi.OpRGBA + 1]uint64
+	// end is the offset in the file following the last op.
+	end int
+}
+
+// scanOps walks the ops of the QOI file data, whose image has the given amount of pixels, until they produce
+// all of them. If the ops are cut off, it returns the ops up to that point along with an error.
+func scanOps(data []byte, pixels uint64) (opStats, error) {
+	var s opStats
+	_, err := qoi.Trace(bytes.NewReader(data), func(op qoi.TracedOp) error {
+		produced := uint64(op.Pixels)
+		if rest := pixels - uint64(op.Pixel); produced > rest {
+			// A run may exceed the image at its end, which decoders ignore.
+			produced = rest
+		}
+		s.ops[op.Op]++
+		s.pixels[op.Op] += produced
+		s.bytes[op.Op] += uint64(op.Size)
+		s.end = int(op.Offset) + op.Size
+		return nil
+	})
+	return s, err
+}
+
+// printTrace writes each op of the QOI file data to w, one per line.
+func printTrace(w io.Writer, data []byte) error {
+	fmt.Fprintf(w, "  %10s %10s %13s %-5s %4s  %-9s  %s\n", "offset", "pixel", "position", "op", "size", "rgba", "details")
+	_, err := qoi.Trace(bytes.NewReader(data), func(op qoi.TracedOp) error {
+		var details string
+		switch op.Op {
+		case qoi.OpRun:
+			details = fmt.Sprintf("  %d pixels", op.Pixels)
+		case qoi.OpIndex:
+			details = fmt.Sprintf("  index %d", op.Index)
+		}
+		c := op.Color
+		_, err := fmt.Fprintf(w, "  %10d %10d %13s %-5s %4d  %02x%02x%02x%02x%s\n",
+			op.Offset, op.Pixel, fmt.Sprintf("(%d,%d)", op.Pos.X, op.Pos.Y), op.Op, op.Size, c.R, c.G, c.B, c.A, details)
+		return err
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestPrintInfo(t *testing.T) {
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 40, Height: 30, Alpha: qoitest.RandomAlpha, RunLength: 4, Colors: 16,
+	})
+	content := bytes.NewBuffer(nil)
+	if err := qoi.Encode(content, img); err != nil {
+		t.Fatal(err)
+	}
+	data := content.Bytes()
+
+	s, err := scanOps(data, 40*30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pixels, size uint64
+	for op := range s.ops {
+		pixels += s.pixels[op]
+		size += s.bytes[op]
+	}
+	// The ops lie between the 14-byte header and the end marker.
+	if pixels != 40*30 || size != uint64(len(data)-14-len(endMarker)) || s.end != len(data)-len(endMarker) {
+		t.Fatalf("ops account for %d pixels and %d bytes", pixels, size)
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := printInfo(out, "img.qoi", data, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"dimensions:  40x30", "channels:    4", "raw size:    4800 bytes", "end marker:  present", "trailer:     0 bytes"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	out.Reset()
+	if err := printTrace(out, data); err != nil {
+		t.Fatal(err)
+	}
+	var ops uint64
+	for _, n := range s.ops {
+		ops += n
+	}
+	if lines := strings.Count(out.String(), "\n"); uint64(lines) != ops+1 {
+		t.Fatalf("expected a line for each of %d ops and one for the column names, got %d lines", ops, lines)
+	}
+
+	if err := printInfo(out, "cut.qoi", data[:len(data)-20], true); !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected ErrTruncated for truncated file, got %v", err)
+	}
+	if err := printInfo(out, "bad.qoi", []byte("not a QOI file"), false); !errors.Is(err, qoi.ErrBadMagic) {
+		t.Fatalf("expected ErrBadMagic, got %v", err)
+	}
+}
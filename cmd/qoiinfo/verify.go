@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// Exit codes of the verify subcommand. For several files, the code of the worst one is used.
+const (
+	// exitValid means that all files are well-formed and match their CRC trailer, if any.
+	exitValid = 0
+	// exitRecoverable means that all pixels decode, but a file is not well-formed, such as when its end
+	// marker is missing or followed by unknown data.
+	exitRecoverable = 1
+	// exitCorrupt means that a file has an invalid header, is cut off before its last pixel or does not
+	// match its CRC trailer.
+	exitCorrupt = 2
+	// exitError means that a file could not be read, or that the command line is invalid.
+	exitError = 3
+)
+
+var statusNames = map[int]string{
+	exitValid:       "valid",
+	exitRecoverable: "recoverable",
+	exitCorrupt:     "corrupt",
+}
+
+// runVerify runs the verify subcommand with the given arguments and returns its exit code.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	quiet := fs.Bool("q", false, "only report files which are not valid")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: qoiinfo verify [-q] file...\n\n")
+		fmt.Fprintf(fs.Output(), "Exits with 0 if all files are valid, 1 if some are recoverable, 2 if some are corrupt\n")
+		fmt.Fprintf(fs.Output(), "and 3 if some could not be read.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+	code := exitValid
+	for _, path := range fs.Args() {
+		name, data, err := readInput(path)
+		status := exitError
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "qoiinfo: %s: %v\n", name, err)
+		} else {
+			status = printVerdict(os.Stdout, name, data, *quiet)
+		}
+		if status > code {
+			code = status
+		}
+	}
+	return code
+}
+
+// printVerdict verifies the QOI file named name with the given content, writes the verdict to w unless the
+// file is valid and quiet is set, and returns its exit code.
+func printVerdict(w io.Writer, name string, data []byte, quiet bool) int {
+	status, err := verify(data)
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "%s: %s: %v\n", name, statusNames[status], err)
+	case !quiet:
+		fmt.Fprintf(w, "%s: %s\n", name, statusNames[status])
+	}
+	return status
+}
+
+// verify decodes data strictly, verifying its CRC trailer if present, and returns exitValid if that
+// succeeds. Otherwise, it returns exitRecoverable if data still decodes leniently, or exitCorrupt, along with
+// the error which makes data not valid.
+func verify(data []byte) (int, error) {
+	strict := qoi.Decoder{Strict: true, VerifyCRC: true}
+	// Decoding with metadata accepts the metadata chunks following the end marker, which are tolerated data
+	// rather than unknown data after it. data is decoded whole, however large the chunks are.
+	_, _, err := strict.DecodeWithMetadata(bytes.NewReader(data))
+	if err == nil {
+		return exitValid, nil
+	}
+	if errors.Is(err, qoi.ErrChecksum) {
+		return exitCorrupt, err
+	}
+	var lenient qoi.Decoder
+	if _, lenientErr := lenient.DecodeBytes(data); lenientErr != nil {
+		return exitCorrupt, lenientErr
+	}
+	return exitRecoverable, err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestVerify(t *testing.T) {
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 16, Height: 16, Alpha: qoitest.RandomAlpha, RunLength: 4, Colors: 16,
+	})
+	encode := func(enc qoi.Encoder) []byte {
+		content := bytes.NewBuffer(nil)
+		if err := enc.Encode(content, img); err != nil {
+			t.Fatal(err)
+		}
+		return content.Bytes()
+	}
+	plain := encode(qoi.Encoder{})
+	withTrailers := encode(qoi.Encoder{CRC: true, Metadata: &qoi.Metadata{Comments: []string{"hello"}}})
+	// The chunks are larger than the pixels, let alone their encoding.
+	large := &qoi.Metadata{ICCProfile: bytes.Repeat([]byte{0x42}, 4000), EXIF: bytes.Repeat([]byte{0x17}, 2000)}
+	withLarge := encode(qoi.Encoder{Metadata: large})
+	withLargeCRC := encode(qoi.Encoder{CRC: true, Metadata: large})
+	badCRC := encode(qoi.Encoder{CRC: true})
+	// The CRC trailer directly follows the end marker, and ends with the CRC-32 itself.
+	badCRC[len(badCRC)-1] ^= 1
+
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		status int
+	}{
+		{"plain", plain, exitValid},
+		{"trailers", withTrailers, exitValid},
+		{"large metadata", withLarge, exitValid},
+		{"large metadata with CRC", withLargeCRC, exitValid},
+		{"missing end marker", plain[:len(plain)-8], exitRecoverable},
+		{"trailing data", append(append([]byte(nil), plain...), "garbage"...), exitRecoverable},
+		{"truncated", plain[:len(plain)/2], exitCorrupt},
+		{"bad magic", append([]byte("qoiF"), plain[4:]...), exitCorrupt},
+		{"bad CRC", badCRC, exitCorrupt},
+	} {
+		out := bytes.NewBuffer(nil)
+		if status := printVerdict(out, test.name, test.data, false); status != test.status {
+			t.Fatalf("%s: expected %s, got %s: %s", test.name, statusNames[test.status], statusNames[status], out)
+		}
+		if !strings.HasPrefix(out.String(), test.name+": "+statusNames[test.status]) {
+			t.Fatalf("%s: unexpected output %q", test.name, out)
+		}
+	}
+	out := bytes.NewBuffer(nil)
+	printVerdict(out, "plain", plain, true)
+	if out.Len() != 0 {
+		t.Fatalf("expected no output for valid file with quiet, got %q", out)
+	}
+}
@@ -0,0 +1,146 @@
+// Command qoiview shows QOI images in the terminal, which is handy for checking images on remote machines.
+//
+// Usage:
+//
+//	qoiview [flags] file
+//
+// A file of - reads standard input. Images are downscaled while they are decoded to fit into the terminal,
+// keeping their aspect ratio, and never upscaled. The flags are:
+//
+//	-mode name
+//		how to draw the image: blocks draws two pixels per character cell with upper half block characters
+//		colored in 24-bit color, sixel draws the image as sixel graphics, and auto chooses sixel for terminals
+//		known to support it and blocks otherwise. The default is auto.
+//	-width n, -height n
+//		size in character cells to fit the image into, instead of the size of the terminal.
+//	-bg rrggbb
+//		color transparent pixels are composited over. The default is black.
+//
+// Sixel graphics are fit assuming character cells of 10x20 pixels, as the size of cells cannot be queried
+// portably.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Zyl9393/qoi"
+	"golang.org/x/term"
+)
+
+// cellWidth and cellHeight are the size in pixels assumed for character cells when drawing sixel graphics.
+const (
+	cellWidth  = 10
+	cellHeight = 20
+)
+
+func main() {
+	mode := flag.String("mode", "auto", "how to draw the image: auto, blocks or sixel")
+	width := flag.Int("width", 0, "width in character cells to fit the image into, or 0 for the terminal's")
+	height := flag.Int("height", 0, "height in character cells to fit the image into, or 0 for the terminal's")
+	bg := flag.String("bg", "000000", "color transparent pixels are composited over, as rrggbb")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: qoiview [flags] file\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := view(flag.Arg(0), *mode, *width, *height, *bg); err != nil {
+		fmt.Fprintf(os.Stderr, "qoiview: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func view(path, mode string, width, height int, bg string) error {
+	background, err := parseColor(bg)
+	if err != nil {
+		return err
+	}
+	if mode == "auto" {
+		mode = "blocks"
+		if supportsSixel(os.Getenv("TERM")) {
+			mode = "sixel"
+		}
+	}
+	if mode != "blocks" && mode != "sixel" {
+		return fmt.Errorf("invalid mode %q: must be auto, blocks or sixel", mode)
+	}
+	if width <= 0 || height <= 0 {
+		cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			cols, rows = 80, 24
+		}
+		if width <= 0 {
+			width = cols
+		}
+		if height <= 0 {
+			// Leave a line for the prompt following the image.
+			height = max1(rows - 1)
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	fit := image.Pt(width, height*2)
+	if mode == "sixel" {
+		fit = image.Pt(width*cellWidth, height*cellHeight)
+	}
+	dec := qoi.Decoder{Channels: 3, CompositeAlpha: true, Background: background}
+	img, err := dec.DecodeThumbnail(r, fit)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if mode == "sixel" {
+		writeSixel(out, img)
+	} else {
+		writeBlocks(out, img)
+	}
+	return out.Flush()
+}
+
+// parseColor parses a color given as rrggbb, optionally prefixed with #.
+func parseColor(s string) (color.NRGBA, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(s, "#")) != 6 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q: must be rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// supportsSixel reports whether terminals of the given TERM are known to support sixel graphics.
+func supportsSixel(termName string) bool {
+	if strings.Contains(termName, "sixel") {
+		return true
+	}
+	for _, name := range []string{"mlterm", "foot", "contour", "yaft"} {
+		if termName == name || strings.HasPrefix(termName, name+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// writeBlocks draws img with upper half block characters, whose foreground color is that of the upper pixel
+// and whose background color is that of the lower one. Escape sequences are only written when colors change.
+func writeBlocks(w *bufio.Writer, img *image.NRGBA) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		var fg, bg color.NRGBA
+		first := true
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			top := img.NRGBAAt(x, y)
+			if first || top != fg {
+				fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm", top.R, top.G, top.B)
+				fg = top
+			}
+			if y+1 < bounds.Max.Y {
+				bottom := img.NRGBAAt(x, y+1)
+				if first || bottom != bg {
+					fmt.Fprintf(w, "\x1b[48;2;%d;%d;%dm", bottom.R, bottom.G, bottom.B)
+					bg = bottom
+				}
+			} else if first {
+				// The last row of an image of odd height leaves the lower halves in the terminal's color.
+				w.WriteString("\x1b[49m")
+			}
+			first = false
+			w.WriteString("▀")
+		}
+		w.WriteString("\x1b[0m\n")
+	}
+}
+
+// writeSixel draws img as sixel graphics with a palette of up to 256 colors chosen by median cut and
+// Floyd-Steinberg dithering.
+func writeSixel(w *bufio.Writer, img *image.NRGBA) {
+	bounds := img.Bounds()
+	var q qoi.Quantizer
+	paletted := image.NewPaletted(bounds, q.Quantize(make(color.Palette, 0, 256), img))
+	draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
+
+	fmt.Fprintf(w, "\x1bP0;1;0q\"1;1;%d;%d", bounds.Dx(), bounds.Dy())
+	for i, c := range paletted.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, percent(r), percent(g), percent(b))
+	}
+	// Each band of 6 rows is drawn one color at a time: sixels holds, for each column, which of the rows of
+	// the band have the color.
+	sixels := make([]byte, bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 6 {
+		var used [256]bool
+		for dy := 0; dy < 6 && y+dy < bounds.Max.Y; dy++ {
+			i := paletted.PixOffset(bounds.Min.X, y+dy)
+			for _, index := range paletted.Pix[i : i+bounds.Dx()] {
+				used[index] = true
+			}
+		}
+		firstColor := true
+		for index := range used {
+			if !used[index] {
+				continue
+			}
+			for x := range sixels {
+				sixels[x] = 0
+			}
+			for dy := 0; dy < 6 && y+dy < bounds.Max.Y; dy++ {
+				i := paletted.PixOffset(bounds.Min.X, y+dy)
+				for x, pixel := range paletted.Pix[i : i+bounds.Dx()] {
+					if int(pixel) == index {
+						sixels[x] |= 1 << dy
+					}
+				}
+			}
+			if !firstColor {
+				// Return to the start of the band to draw the next color over it.
+				w.WriteByte('$')
+			}
+			firstColor = false
+			fmt.Fprintf(w, "#%d", index)
+			writeSixelRow(w, sixels)
+		}
+		w.WriteByte('-')
+	}
+	w.WriteString("\x1b\\\n")
+}
+
+// writeSixelRow writes the sixels of a band, compressing repeated sixels.
+func writeSixelRow(w *bufio.Writer, sixels []byte) {
+	for x := 0; x < len(sixels); {
+		n := 1
+		for x+n < len(sixels) && sixels[x+n] == sixels[x] {
+			n++
+		}
+		c := '?' + sixels[x]
+		if n > 3 {
+			fmt.Fprintf(w, "!%d%c", n, c)
+		} else {
+			for i := 0; i < n; i++ {
+				w.WriteByte(c)
+			}
+		}
+		x += n
+	}
+}
+
+// percent converts a 16-bit color value to the percentage used by sixel palettes.
+func percent(v uint32) uint32 {
+	return (v*100 + 0xffff/2) / 0xffff
+}
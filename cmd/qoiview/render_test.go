@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestWriteBlocks(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 3))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(0, 1, color.NRGBA{G: 255, A: 255})
+	content := bytes.NewBuffer(nil)
+	w := bufio.NewWriter(content)
+	writeBlocks(w, img)
+	w.Flush()
+	lines := strings.Split(strings.TrimSuffix(content.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines for 3 rows, got %d", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "\x1b[38;2;255;0;0m\x1b[48;2;0;255;0m▀") {
+		t.Fatalf("unexpected first cell in %q", lines[0])
+	}
+	if strings.Count(lines[1], "▀") != 2 || !strings.Contains(lines[1], "\x1b[49m") {
+		t.Fatalf("unexpected last line %q", lines[1])
+	}
+}
+
+func TestWriteSixel(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 13))
+	for y := 0; y < 13; y++ {
+		for x := 0; x < 20; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 12), B: uint8(y * 19), A: 255})
+		}
+	}
+	content := bytes.NewBuffer(nil)
+	w := bufio.NewWriter(content)
+	writeSixel(w, img)
+	w.Flush()
+	s := content.String()
+	if !strings.HasPrefix(s, "\x1bP0;1;0q\"1;1;20;13#0;2;") || !strings.HasSuffix(s, "\x1b\\\n") {
+		t.Fatalf("unexpected sixel framing in %q", s)
+	}
+	if bands := strings.Count(s, "-"); bands != 3 {
+		t.Fatalf("expected 3 bands for 13 rows, got %d", bands)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	c, err := parseColor("#10a0ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != (color.NRGBA{R: 0x10, G: 0xa0, B: 0xff, A: 255}) {
+		t.Fatalf("unexpected color %v", c)
+	}
+	for _, s := range []string{"fff", "12345g", ""} {
+		if _, err := parseColor(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+	if !supportsSixel("foot") || !supportsSixel("xterm-sixel") || supportsSixel("xterm-256color") {
+		t.Fatal("unexpected sixel support detection")
+	}
+}
@@ -0,0 +1,102 @@
+package qoi
+
+import (
+	"fmt"
+	"math"
+)
+
+// srgbToLinear and linearToSRGB map 8-bit channel values between sRGB and linear RGB, using the sRGB transfer
+// functions of IEC 61966-2-1.
+var (
+	srgbToLinear = transferTable(func(v float64) float64 {
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	})
+	linearToSRGB = transferTable(func(v float64) float64 {
+		if v <= 0.0031308 {
+			return v * 12.92
+		}
+		return 1.055*math.Pow(v, 1/2.4) - 0.055
+	})
+)
+
+// transferTable returns a table holding f applied to all 8-bit values, scaled to 0..1 and back.
+func transferTable(f func(v float64) float64) *[256]uint8 {
+	var table [256]uint8
+	for i := range table {
+		table[i] = uint8(math.Round(f(float64(i)/255) * 255))
+	}
+	return &table
+}
+
+// colorspaceTable returns the table converting channel values from one colorspace to another, or nil if
+// they are the same.
+func colorspaceTable(from, to Colorspace) *[256]uint8 {
+	switch {
+	case from == to:
+		return nil
+	case to == Linear:
+		return srgbToLinear
+	default:
+		return linearToSRGB
+	}
+}
+
+// applyTable maps the red, green and blue channels of the pixels of row, each bytesPerPixel bytes long,
+// through table. Alpha is left untouched.
+func applyTable(row []byte, bytesPerPixel int, table *[256]uint8) {
+	for i := 0; i+bytesPerPixel <= len(row); i += bytesPerPixel {
+		row[i] = table[row[i]]
+		row[i+1] = table[row[i+1]]
+		row[i+2] = table[row[i+2]]
+	}
+}
+
+// checkColorspace returns an error unless cs is a valid Colorspace.
+func checkColorspace(cs Colorspace) error {
+	if cs != SRGB && cs != Linear {
+		return fmt.Errorf("%w %d: must be 0 (sRGB) or 1 (linear RGB)", ErrInvalidColorspace, cs)
+	}
+	return nil
+}
+
+// ConvertColorspace converts the pixels of img in place from its colorspace to target and sets its
+// Colorspace to target. Alpha is not affected. Converting to linear RGB loses precision in dark colors, as 8
+// bits per channel cannot tell apart as many dark values in linear RGB as in sRGB. It panics if target is
+// not a valid Colorspace.
+func ConvertColorspace(img *Image, target Colorspace) {
+	if err := checkColorspace(target); err != nil {
+		panic(fmt.Sprintf("qoi: ConvertColorspace: %v", err))
+	}
+	table := colorspaceTable(img.Colorspace, target)
+	img.Colorspace = target
+	if table == nil {
+		return
+	}
+	n := int(img.Channels)
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		applyTable(img.Pix[i:i+img.Width*n], n, table)
+	}
+}
+
+// checkConversions returns an error if dec is set to convert images to an invalid colorspace, with an
+// invalid gamma or channel order.
+func (dec *Decoder) checkConversions() error {
+	if dec.ConvertColorspace {
+		if err := checkColorspace(dec.Colorspace); err != nil {
+			return err
+		}
+	}
+	if dec.Swizzle != "" {
+		if dec.BGRA {
+			return fmt.Errorf("BGRA and Swizzle cannot be combined")
+		}
+		if _, err := swizzlePerm(dec.Swizzle, 4); err != nil {
+			return err
+		}
+	}
+	return checkGamma(dec.Gamma)
+}
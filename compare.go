@@ -0,0 +1,34 @@
+package qoi
+
+import (
+	"image"
+	"image/color"
+)
+
+// ImagesEqual reports whether a and b have the same size and whether each pixel of a differs from the
+// corresponding pixel of b by at most tolerance in each of its non-premultiplied channels. Pixels are
+// compared relative to the top-left corner of each image. If the images are not equal, the coordinates of
+// the first differing pixel within a are returned; if their sizes differ, the zero Point is returned.
+func ImagesEqual(a, b image.Image, tolerance uint8) (bool, image.Point) {
+	ar, br := a.Bounds(), b.Bounds()
+	if ar.Size() != br.Size() {
+		return false, image.Point{}
+	}
+	for y := 0; y < ar.Dy(); y++ {
+		for x := 0; x < ar.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(a.At(ar.Min.X+x, ar.Min.Y+y)).(color.NRGBA)
+			cb := color.NRGBAModel.Convert(b.At(br.Min.X+x, br.Min.Y+y)).(color.NRGBA)
+			if absDiff(ca.R, cb.R) > tolerance || absDiff(ca.G, cb.G) > tolerance || absDiff(ca.B, cb.B) > tolerance || absDiff(ca.A, cb.A) > tolerance {
+				return false, image.Point{ar.Min.X + x, ar.Min.Y + y}
+			}
+		}
+	}
+	return true, image.Point{}
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,60 @@
+package qoi
+
+import (
+	"bufio"
+	"image"
+	"io"
+)
+
+// maxOpBits is the cost in bits of the most expensive op, an RGBA op, which is shown as white by
+// DecodeCostMap.
+const maxOpBits = maxOpSize * 8
+
+// DecodeCostMap decodes a QOI image from r into a map of how many bits each of its pixels cost to encode,
+// showing which regions make a file large. Each pixel of the returned image is the size of the op producing
+// it, split evenly among the pixels of a run, scaled such that 255 stands for the 40 bits of an RGBA op:
+// value = bits * 255 / 40. Pixels encoded as RGB ops have 204, LUMA ops 102, INDEX and DIFF ops 51, and
+// pixels of runs a small fraction of that.
+func DecodeCostMap(r io.Reader) (*image.Gray, error) {
+	var dec Decoder
+	return dec.DecodeCostMap(r)
+}
+
+// DecodeCostMap is like the package-level DecodeCostMap, but uses the MaxBytes and BufferSize settings of
+// dec, MaxBytes limiting the size of the returned image. Other settings do not affect the map.
+func (dec *Decoder) DecodeCostMap(r io.Reader) (*image.Gray, error) {
+	in, ok := r.(*bufio.Reader)
+	if !ok {
+		bufferSize := dec.BufferSize
+		if bufferSize <= 0 {
+			bufferSize = defaultBufferSize
+		}
+		in = bufio.NewReaderSize(r, bufferSize)
+	}
+	header, err := PeekHeader(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.checkSize(header, 1); err != nil {
+		return nil, err
+	}
+	if _, err := header.pixLen(1); err != nil {
+		return nil, err
+	}
+	dst := image.NewGray(image.Rect(0, 0, int(header.width), int(header.height)))
+	_, err = Trace(in, func(op TracedOp) error {
+		end := op.Pixel + op.Pixels
+		if end > len(dst.Pix) {
+			end = len(dst.Pix)
+		}
+		cost := uint8((op.Size*8*255 + maxOpBits*op.Pixels/2) / (maxOpBits * op.Pixels))
+		for i := op.Pixel; i < end; i++ {
+			dst.Pix[i] = cost
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
@@ -0,0 +1,156 @@
+package qoi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The CRC trailer written by Encoder.CRC follows the end marker and consists of qoiCRCTag and the CRC-32
+// (IEEE) of the RGBA values of all pixels in big-endian order. It is not part of the QOI specification.
+const (
+	qoiCRCTag         = "qcrc"
+	qoiCRCTrailerSize = 8
+)
+
+// pixelSum accumulates the CRC-32 stored in the CRC trailer.
+type pixelSum struct {
+	crc     uint32
+	scratch []byte
+}
+
+// addRow adds the pixels of row, each bytesPerPixel bytes long, to s. 3-channel pixels and, if dropAlpha
+// is set, 4-channel pixels are added with alpha 255.
+func (s *pixelSum) addRow(row []byte, bytesPerPixel int, dropAlpha bool) {
+	if bytesPerPixel == 4 && !dropAlpha {
+		s.crc = crc32.Update(s.crc, crc32.IEEETable, row)
+		return
+	}
+	n := len(row) / bytesPerPixel * 4
+	if cap(s.scratch) < n {
+		s.scratch = make([]byte, n)
+	}
+	rgba := s.scratch[:n]
+	for i, j := 0, 0; j < n; i, j = i+bytesPerPixel, j+4 {
+		rgba[j], rgba[j+1], rgba[j+2], rgba[j+3] = row[i], row[i+1], row[i+2], 255
+	}
+	s.crc = crc32.Update(s.crc, crc32.IEEETable, rgba)
+}
+
+// appendTrailer appends the CRC trailer holding the sum of s to b.
+func (s *pixelSum) appendTrailer(b []byte) []byte {
+	b = append(b, qoiCRCTag...)
+	return append(b, byte(s.crc>>24), byte(s.crc>>16), byte(s.crc>>8), byte(s.crc))
+}
+
+// verify returns an error unless the CRC-32 stored in trailer matches the sum of s.
+func (s *pixelSum) verify(trailer []byte) error {
+	if crc := binary.BigEndian.Uint32(trailer[len(qoiCRCTag):]); crc != s.crc {
+		return fmt.Errorf("%w: CRC trailer states 0x%08x, pixels sum up to 0x%08x", ErrChecksum, crc, s.crc)
+	}
+	return nil
+}
+
+// partialTrailer reports whether b, which follows the end marker, may be the start of an incomplete CRC
+// trailer.
+func partialTrailer(b []byte) bool {
+	n := len(b)
+	if n > len(qoiCRCTag) {
+		n = len(qoiCRCTag)
+	}
+	return len(b) < qoiCRCTrailerSize && string(b[:n]) == qoiCRCTag[:n]
+}
+
+// peeker is implemented by readers such as *bufio.Reader, which allow looking ahead without consuming.
+type peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// aheadReader lets bodyDecoder look ahead into readers which cannot peek, such as *bytes.Buffer and
+// *bytes.Reader, when checking for the CRC trailer and metadata chunks. Bytes looked at are read from r and
+// kept until they are consumed. On release, seekable readers are seeked back over bytes not consumed.
+type aheadReader struct {
+	r     byteReader
+	ahead []byte
+	buf   [chunkHeaderSize]byte
+}
+
+// Peek returns the next n bytes, which must not exceed chunkHeaderSize, without consuming them. Fewer bytes
+// are returned along with io.EOF if the input ends before.
+func (a *aheadReader) Peek(n int) ([]byte, error) {
+	a.ahead = a.buf[:copy(a.buf[:], a.ahead)]
+	for len(a.ahead) < n {
+		c, err := a.r.ReadByte()
+		if err != nil {
+			return a.ahead, err
+		}
+		a.ahead = append(a.ahead, c)
+	}
+	return a.ahead[:n], nil
+}
+
+func (a *aheadReader) Read(p []byte) (int, error) {
+	if len(a.ahead) == 0 {
+		return a.r.Read(p)
+	}
+	n := copy(p, a.ahead)
+	a.ahead = a.ahead[n:]
+	return n, nil
+}
+
+func (a *aheadReader) ReadByte() (byte, error) {
+	if len(a.ahead) == 0 {
+		return a.r.ReadByte()
+	}
+	c := a.ahead[0]
+	a.ahead = a.ahead[1:]
+	return c, nil
+}
+
+// peek is like Peek of *bufio.Reader, reading the input of d through d.ahead from then on if it cannot peek
+// itself.
+func (d *bodyDecoder) peek(n int) ([]byte, error) {
+	p, ok := d.in.(peeker)
+	if !ok {
+		d.ahead = aheadReader{r: d.in}
+		d.in = &d.ahead
+		p = &d.ahead
+	}
+	return p.Peek(n)
+}
+
+func (d *bodyDecoder) readTrailer() ([]byte, error) {
+	// Leave the input untouched unless it holds a trailer, e.g. so that DecodeAll can go on with the next
+	// image and readChunks finds the chunk following the end marker.
+	b, err := d.peek(len(qoiCRCTag))
+	if len(b) == 0 && err == io.EOF || string(b) != qoiCRCTag[:len(b)] {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read CRC trailer: %w", truncated(err))
+	}
+	trailer := d.raw[:qoiCRCTrailerSize]
+	if _, err := io.ReadFull(d.in, trailer); err != nil {
+		return nil, fmt.Errorf("could not read CRC trailer: %w", truncated(err))
+	}
+	return trailer, nil
+}
+
+func (d *sliceDecoder) readTrailer() ([]byte, error) {
+	rest := d.data[d.pos:]
+	if len(rest) < len(qoiCRCTag) {
+		if len(rest) > 0 && string(rest) == qoiCRCTag[:len(rest)] {
+			return nil, fmt.Errorf("could not read CRC trailer: %w", truncated(io.ErrUnexpectedEOF))
+		}
+		return nil, nil
+	}
+	if string(rest[:len(qoiCRCTag)]) != qoiCRCTag {
+		return nil, nil
+	}
+	if len(rest) < qoiCRCTrailerSize {
+		return nil, fmt.Errorf("could not read CRC trailer: %w", truncated(io.ErrUnexpectedEOF))
+	}
+	d.pos += qoiCRCTrailerSize
+	return rest[:qoiCRCTrailerSize], nil
+}
@@ -0,0 +1,137 @@
+package qoi
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+)
+
+// DeltaEncoder encodes frames of a sequence, e.g. captures of a screen, relative to the frame preceding them.
+// Instead of the frame itself, it encodes the per-channel difference to the previous frame, so pixels which
+// did not change all become the same color and are covered by runs and index hits. This makes encoding
+// frames which differ little from their predecessor much cheaper, both in time and size.
+//
+// The output is a standard QOI file holding the difference image, which DecodeDelta turns back into the
+// frame given the previous one. The difference image is laid out such that unchanged pixels are opaque
+// black, which is also the previous pixel a QOI encoder starts with, so an unchanged frame encodes to a
+// single sequence of runs.
+//
+// A DeltaEncoder reuses its buffers for the difference image between calls and must not be used from
+// multiple goroutines concurrently.
+type DeltaEncoder struct {
+	// Encoder holds the settings used to encode the difference images. Settings which change pixels, such as
+	// CutoutAlpha or Gamma, apply to the frames rather than to their difference, as if each frame was encoded
+	// on its own.
+	Encoder Encoder
+
+	delta *Image
+	buf   bytes.Buffer
+}
+
+// Encode writes the difference between cur and prev to w. Both images must have the same size. If the
+// settings of de.Encoder change pixels, the difference is taken between the frames as decoding them would
+// yield after encoding each on its own with de.Encoder, so that DecodeDelta returns exactly that for cur,
+// given that for prev.
+func (de *DeltaEncoder) Encode(w io.Writer, prev, cur image.Image) error {
+	width, height := cur.Bounds().Dx(), cur.Bounds().Dy()
+	if pw, ph := prev.Bounds().Dx(), prev.Bounds().Dy(); pw != width || ph != height {
+		return fmt.Errorf("previous frame is %dx%d, but current frame is %dx%d", pw, ph, width, height)
+	}
+	if err := checkDimensions(width, height); err != nil {
+		return err
+	}
+	enc := de.Encoder
+	if enc.changesPixels() {
+		var err error
+		if prev, err = de.reconstruct(prev); err != nil {
+			return fmt.Errorf("previous frame: %w", err)
+		}
+		if cur, err = de.reconstruct(cur); err != nil {
+			return err
+		}
+		// The difference image itself must be stored as is.
+		enc.Channels, enc.ConvertColorspace, enc.Unpremultiply, enc.Dither = 0, false, false, NoDither
+		enc.CutoutAlpha, enc.Gamma, enc.ColorTransformer = false, 0, nil
+	}
+	colorspace := SRGB
+	if qimg, ok := cur.(*Image); ok {
+		colorspace = qimg.Colorspace
+	}
+	if de.delta == nil || de.delta.Width != width || de.delta.Height != height {
+		de.delta = NewImage(width, height, 4, colorspace)
+	}
+	de.delta.Colorspace = colorspace
+
+	prevRowAt, curRowAt := pixelRows(prev), pixelRows(cur)
+	for y := 0; y < height; y++ {
+		i := y * de.delta.Stride
+		deltaRow(de.delta.Pix[i:i+width*4], prevRowAt(prev.Bounds().Min.Y+y), curRowAt(cur.Bounds().Min.Y+y))
+	}
+	return enc.Encode(w, de.delta)
+}
+
+// reconstruct returns img as decoding it would yield after encoding it with de.Encoder.
+func (de *DeltaEncoder) reconstruct(img image.Image) (*Image, error) {
+	enc := de.Encoder
+	enc.CRC, enc.Metadata, enc.Stats = false, nil, nil
+	de.buf.Reset()
+	if err := enc.Encode(&de.buf, img); err != nil {
+		return nil, err
+	}
+	return DecodeBytes(de.buf.Bytes())
+}
+
+// changesPixels reports whether enc stores other pixels than those of the images it encodes.
+func (enc *Encoder) changesPixels() bool {
+	return enc.Channels == 3 || enc.ConvertColorspace || enc.Unpremultiply || enc.Dither != NoDither ||
+		enc.CutoutAlpha || gammaTable(enc.Gamma) != nil || enc.ColorTransformer != nil
+}
+
+// DecodeDelta reads a difference image written by DeltaEncoder from r and returns the frame it was computed
+// from, given the previous frame prev. The returned image always has 4 channels.
+func DecodeDelta(r io.Reader, prev image.Image) (*Image, error) {
+	var dec Decoder
+	return dec.decodeDelta(r, prev)
+}
+
+// decodeDelta is like DecodeDelta, but decodes the difference image with the settings of dec, except for
+// Channels.
+func (dec *Decoder) decodeDelta(r io.Reader, prev image.Image) (*Image, error) {
+	deltaDec := *dec
+	deltaDec.Channels = 4
+	img, err := deltaDec.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if pw, ph := prev.Bounds().Dx(), prev.Bounds().Dy(); pw != img.Width || ph != img.Height {
+		return nil, fmt.Errorf("previous frame is %dx%d, but difference image is %dx%d", pw, ph, img.Width, img.Height)
+	}
+	prevRowAt := pixelRows(prev)
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		applyDeltaRow(img.Pix[i:i+img.Width*4], prevRowAt(prev.Bounds().Min.Y+y))
+	}
+	return img, nil
+}
+
+// deltaRow stores the difference between the NRGBA rows prev and cur in dst. Color channels hold cur-prev,
+// alpha holds cur-prev-1, all modulo 256, so an unchanged pixel becomes {0, 0, 0, 255}.
+func deltaRow(dst, prev, cur []byte) {
+	for i := 0; i+4 <= len(dst); i += 4 {
+		dst[i] = cur[i] - prev[i]
+		dst[i+1] = cur[i+1] - prev[i+1]
+		dst[i+2] = cur[i+2] - prev[i+2]
+		dst[i+3] = cur[i+3] - prev[i+3] - 1
+	}
+}
+
+// applyDeltaRow reverts deltaRow in place, turning the difference row in delta back into the current row.
+func applyDeltaRow(delta, prev []byte) {
+	for i := 0; i+4 <= len(delta); i += 4 {
+		delta[i] += prev[i]
+		delta[i+1] += prev[i+1]
+		delta[i+2] += prev[i+2]
+		delta[i+3] += prev[i+3] + 1
+	}
+}
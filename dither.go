@@ -0,0 +1,123 @@
+package qoi
+
+import "image"
+
+// Dither selects how Encoder reduces the 16-bit channels of *image.NRGBA64 and *image.RGBA64 images to the
+// 8 bits QOI stores.
+type Dither int
+
+const (
+	// NoDither truncates channels to their high byte, like color.NRGBAModel does. Smooth gradients may show
+	// banding.
+	NoDither Dither = iota
+	// OrderedDither adds the thresholds of a 4x4 Bayer matrix before rounding down. Its regular pattern
+	// compresses better than FloydSteinbergDither.
+	OrderedDither
+	// FloydSteinbergDither diffuses the rounding error of each channel to the pixels right of and below it.
+	FloydSteinbergDither
+)
+
+// bayer4 holds the thresholds of a 4x4 Bayer matrix, in 16ths.
+var bayer4 = [4][4]uint32{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// ditheredRows is like pixelRows, but reduces the channels of 16-bit images to 8 bits as selected by dither.
+// It returns nil for any other image or for NoDither. Rows must be requested from top to bottom, as the error
+// diffused by FloydSteinbergDither carries over to the next row.
+func ditheredRows(img image.Image, dither Dither) func(y int) []byte {
+	if dither != OrderedDither && dither != FloydSteinbergDither {
+		return nil
+	}
+	wideAt := wideRows(img)
+	if wideAt == nil {
+		return nil
+	}
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	row := make([]byte, width*4)
+	if dither == OrderedDither {
+		return func(y int) []byte {
+			wide := wideAt(y)
+			thresholds := &bayer4[(y-bounds.Min.Y)&3]
+			for i, v := range wide {
+				// Scale v to 0..255 in steps of 1/32, rounding down after adding the threshold in the middle
+				// of its 16th.
+				t := thresholds[(i/4)&3]*2 + 1
+				row[i] = uint8((uint32(v)*32 + t*257) / (257 * 32))
+			}
+			return row
+		}
+	}
+	// The errors are in units of 1/257 of an 8-bit step, so that a 16-bit value v corresponds to v, with
+	// room for one pixel on either side of the row.
+	errs, nextErrs := make([]int32, (width+2)*4), make([]int32, (width+2)*4)
+	return func(y int) []byte {
+		wide := wideAt(y)
+		for i, v := range wide {
+			e := int32(v) + errs[i+4]
+			q := (e + 128) / 257
+			if q < 0 {
+				q = 0
+			} else if q > 255 {
+				q = 255
+			}
+			row[i] = uint8(q)
+			e -= q * 257
+			errs[i+8] += e * 7 / 16
+			nextErrs[i] += e * 3 / 16
+			nextErrs[i+4] += e * 5 / 16
+			nextErrs[i+8] += e / 16
+		}
+		errs, nextErrs = nextErrs, errs
+		for i := range nextErrs {
+			nextErrs[i] = 0
+		}
+		return row
+	}
+}
+
+// wideRows returns a function returning the pixels of row y of img as non-premultiplied 16-bit RGBA values,
+// or nil unless img is an *image.NRGBA64 or *image.RGBA64. The returned slice is reused between calls.
+func wideRows(img image.Image) func(y int) []uint16 {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	row := make([]uint16, width*4)
+	switch img := img.(type) {
+	case *image.NRGBA64:
+		return func(y int) []uint16 {
+			i := img.PixOffset(bounds.Min.X, y)
+			src := img.Pix[i : i+width*8]
+			for j := range row {
+				row[j] = uint16(src[j*2])<<8 | uint16(src[j*2+1])
+			}
+			return row
+		}
+	case *image.RGBA64:
+		return func(y int) []uint16 {
+			i := img.PixOffset(bounds.Min.X, y)
+			src := img.Pix[i : i+width*8]
+			for j := 0; j < len(row); j += 4 {
+				px := row[j : j+4 : j+4]
+				for c := range px {
+					px[c] = uint16(src[(j+c)*2])<<8 | uint16(src[(j+c)*2+1])
+				}
+				// Unpremultiply like color.NRGBA64Model does.
+				switch a := uint32(px[3]); a {
+				case 0xffff:
+				case 0:
+					px[0], px[1], px[2] = 0, 0, 0
+				default:
+					px[0] = uint16(uint32(px[0]) * 0xffff / a)
+					px[1] = uint16(uint32(px[1]) * 0xffff / a)
+					px[2] = uint16(uint32(px[2]) * 0xffff / a)
+				}
+			}
+			return row
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package qoi
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// DecodeInto decodes a QOI image from r into dst, which must have the same dimensions as the image.
+// Pixels are written straight into the Pix of an *image.NRGBA, *image.RGBA or *image.NRGBA64, premultiplying
+// alpha for *image.RGBA. Pixels of an *image.Paletted are mapped to the nearest color of its palette. Any
+// other dst is filled through its Set method.
+func DecodeInto(r io.Reader, dst draw.Image) error {
+	header, err := DecodeHeader(r)
+	if err != nil {
+		return fmt.Errorf("could not decode header: %w", err)
+	}
+	width, height := int(header.width), int(header.height)
+	bounds := dst.Bounds()
+	if bounds.Dx() != width || bounds.Dy() != height {
+		return fmt.Errorf("dst of size %dx%d does not match image of size %dx%d", bounds.Dx(), bounds.Dy(), width, height)
+	}
+	return decodeBodyInto(r, dst)
+}
+
+// DecodeNRGBA decodes a QOI image from r into a new *image.NRGBA. The pixels are decoded straight into its
+// Pix, so unlike converting the result of Decode, no copy is made. Images with 3 channels are expanded to 4.
+func DecodeNRGBA(r io.Reader) (*image.NRGBA, error) {
+	header, err := DecodeHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+	if _, err := header.pixLen(4); err != nil {
+		return nil, err
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, int(header.width), int(header.height)))
+	return dst, decodeBodyInto(r, dst)
+}
+
+// DecodeRGBA decodes a QOI image from r into a new *image.RGBA, premultiplying alpha while decoding.
+func DecodeRGBA(r io.Reader) (*image.RGBA, error) {
+	header, err := DecodeHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+	if _, err := header.pixLen(4); err != nil {
+		return nil, err
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, int(header.width), int(header.height)))
+	return dst, decodeBodyInto(r, dst)
+}
+
+// DecodeNRGBA64 decodes a QOI image from r into a new *image.NRGBA64, widening each channel to 16 bits while
+// decoding.
+func DecodeNRGBA64(r io.Reader) (*image.NRGBA64, error) {
+	header, err := DecodeHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+	if _, err := header.pixLen(8); err != nil {
+		return nil, err
+	}
+	dst := image.NewNRGBA64(image.Rect(0, 0, int(header.width), int(header.height)))
+	return dst, decodeBodyInto(r, dst)
+}
+
+// decodeBodyInto decodes the body of a QOI image, whose header was already consumed from r, into dst, which
+// must have the dimensions stated in the header.
+func decodeBodyInto(r io.Reader, dst draw.Image) error {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	d := newBodyDecoder(r, 0)
+	defer d.release()
+	d.start(width, bounds.Dy())
+	switch dst := dst.(type) {
+	case *image.NRGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			i := dst.PixOffset(bounds.Min.X, y)
+			if err := d.decodeRow(dst.Pix[i:i+width*4], 4); err != nil {
+				return err
+			}
+		}
+	case *image.RGBA:
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			i := dst.PixOffset(bounds.Min.X, y)
+			row := dst.Pix[i : i+width*4]
+			if err := d.decodeRow(row, 4); err != nil {
+				return err
+			}
+			premultiplyRow(row)
+		}
+	case *image.NRGBA64:
+		row := make([]byte, width*4)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			if err := d.decodeRow(row, 4); err != nil {
+				return err
+			}
+			i := dst.PixOffset(bounds.Min.X, y)
+			widenRow(dst.Pix[i:i+width*8], row)
+		}
+	case *image.Paletted:
+		lookup := newPaletteLookup(dst.Palette)
+		row := make([]byte, width*4)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			if err := d.decodeRow(row, 4); err != nil {
+				return err
+			}
+			i := dst.PixOffset(bounds.Min.X, y)
+			lookup.indexRow(dst.Pix[i:i+width], row)
+		}
+	default:
+		row := make([]byte, width*4)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			if err := d.decodeRow(row, 4); err != nil {
+				return err
+			}
+			for x := 0; x < width; x++ {
+				dst.Set(bounds.Min.X+x, y, color.NRGBA{R: row[x*4], G: row[x*4+1], B: row[x*4+2], A: row[x*4+3]})
+			}
+		}
+	}
+	return nil
+}
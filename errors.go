@@ -0,0 +1,34 @@
+package qoi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrBadMagic is returned when data does not start with the QOI magic bytes.
+	ErrBadMagic = errors.New("bad magic")
+	// ErrInvalidChannels is returned when a header states an amount of channels other than 3 or 4.
+	ErrInvalidChannels = errors.New("invalid amount of channels")
+	// ErrInvalidColorspace is returned when a header states a colorspace other than SRGB or Linear.
+	ErrInvalidColorspace = errors.New("invalid colorspace")
+	// ErrEmptyImage is returned when decoding or encoding an image with zero width or height, which the
+	// format does not allow.
+	ErrEmptyImage = errors.New("image has no pixels")
+	// ErrTruncated is returned when data ends before the image is complete.
+	ErrTruncated = errors.New("truncated data")
+	// ErrChecksum is returned when the CRC trailer of an image does not match its pixels.
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrTooLarge is returned when an image exceeds the size limits of the format, of the platform or of the
+	// Decoder.
+	ErrTooLarge = errors.New("image too large")
+)
+
+// truncated wraps err in ErrTruncated if it reports that the input ended early.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package qoi
+
+import (
+	"image"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// DecodeFile decodes the QOI image stored in the file at path.
+func DecodeFile(path string) (*Image, error) {
+	var dec Decoder
+	return dec.DecodeFile(path)
+}
+
+// DecodeFile is like the package-level DecodeFile, but uses the settings of dec.
+func (dec *Decoder) DecodeFile(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return dec.Decode(f)
+}
+
+// DecodeFS decodes the QOI image stored in the file name of fsys, such as an embed.FS. Errors are reported
+// as *fs.PathError.
+func DecodeFS(fsys fs.FS, name string) (*Image, error) {
+	var dec Decoder
+	return dec.DecodeFS(fsys, name)
+}
+
+// DecodeFS is like the package-level DecodeFS, but uses the settings of dec.
+func (dec *Decoder) DecodeFS(fsys fs.FS, name string) (*Image, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := dec.Decode(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "decode", Path: name, Err: err}
+	}
+	return img, nil
+}
+
+// DecodeAllFS decodes the QOI images stored in the files of fsys matching pattern, as defined by fs.Glob.
+// The images are returned by the names of their files. If any file fails to decode, its error is returned
+// and no images are.
+func DecodeAllFS(fsys fs.FS, pattern string) (map[string]*Image, error) {
+	var dec Decoder
+	return dec.DecodeAllFS(fsys, pattern)
+}
+
+// DecodeAllFS is like the package-level DecodeAllFS, but uses the settings of dec.
+func (dec *Decoder) DecodeAllFS(fsys fs.FS, pattern string) (map[string]*Image, error) {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	images := make(map[string]*Image, len(names))
+	for _, name := range names {
+		img, err := dec.DecodeFS(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		images[name] = img
+	}
+	return images, nil
+}
+
+// EncodeFile encodes img as a QOI file at path. The image is first written to a temporary file in the same
+// directory which is then renamed to path, so path is never left holding a partially written image. If path
+// exists, its permissions are kept, otherwise the file is created like os.Create does.
+func EncodeFile(path string, img image.Image) error {
+	var enc Encoder
+	return enc.EncodeFile(path, img)
+}
+
+// EncodeFile is like the package-level EncodeFile, but uses the settings of enc.
+func (enc *Encoder) EncodeFile(path string, img image.Image) (err error) {
+	f, err := createTemp(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if fi, statErr := os.Stat(path); statErr == nil && fi.Mode().IsRegular() {
+		if err = f.Chmod(fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err = enc.Encode(f, img); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// createTemp is like os.CreateTemp, creating a file named prefix followed by a random number and ".tmp" in
+// dir, but with mode 0666 before the umask like os.Create rather than 0600, as the file replaces another.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
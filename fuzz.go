@@ -0,0 +1,52 @@
+package qoi
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+// SeedCorpus returns inputs for fuzzing decoders, derived from the given images. Each image is encoded at
+// every CompressionLevel with 3 and 4 channels, and each encoding is also included truncated in the middle
+// of its body and without its end marker, so that fuzzing starts out covering every op and error path.
+func SeedCorpus(images ...image.Image) ([][]byte, error) {
+	var seeds [][]byte
+	for i, img := range images {
+		for _, level := range []CompressionLevel{DefaultCompression, BestSpeed, BestCompression} {
+			for _, channels := range []uint8{3, 4} {
+				enc := Encoder{CompressionLevel: level, Channels: channels}
+				var buf bytes.Buffer
+				if err := enc.Encode(&buf, img); err != nil {
+					return nil, fmt.Errorf("image %d: %w", i, err)
+				}
+				data := buf.Bytes()
+				bodyEnd := len(data) - len(qoiEnd)
+				seeds = append(seeds,
+					data,
+					data[:qoiHeaderSize+(bodyEnd-qoiHeaderSize)/2],
+					data[:bodyEnd],
+				)
+			}
+		}
+	}
+	return seeds, nil
+}
+
+// WriteSeedCorpus writes seeds to the seed corpus directory of the fuzz target named fuzzName in the
+// package at dir, i.e. to dir/testdata/fuzz/fuzzName, in the format read by go test. Existing files are
+// overwritten.
+func WriteSeedCorpus(dir, fuzzName string, seeds [][]byte) error {
+	corpusDir := filepath.Join(dir, "testdata", "fuzz", fuzzName)
+	if err := os.MkdirAll(corpusDir, 0o755); err != nil {
+		return err
+	}
+	for i, seed := range seeds {
+		content := fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", seed)
+		if err := os.WriteFile(filepath.Join(corpusDir, fmt.Sprintf("seed-%d", i)), []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+//go:build go1.18
+
+package qoi_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	testdataloader "github.com/peteole/testdata-loader"
+)
+
+// fuzzSeeds adds the seed corpus derived from part of the test image and a tiny image to f.
+func fuzzSeeds(f *testing.F) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		f.Fatal(err)
+	}
+	tiny := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	copy(tiny.Pix, []byte{0, 0, 0, 255, 1, 2, 3, 255, 1, 2, 3, 255, 40, 50, 60, 70, 40, 50, 60, 70, 0, 0, 0, 255})
+	// Large inputs slow down fuzzing to a crawl, so only a small part of the test image is used.
+	crop := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}).SubImage(image.Rect(48, 48, 64, 64))
+	seeds, err := qoi.SeedCorpus(crop, tiny)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := qoi.Decoder{MaxBytes: 1 << 20}
+		img, err := dec.DecodeBytes(data)
+		streamImg, streamErr := dec.Decode(&countingReader{r: bytes.NewReader(data)})
+		if (err == nil) != (streamErr == nil) {
+			t.Fatalf("DecodeBytes returned %v, but Decode returned %v", err, streamErr)
+		}
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(img.Pix, streamImg.Pix) {
+			t.Fatalf("DecodeBytes and Decode decoded different pixels")
+		}
+		dec.Strict = true
+		_, strictErr := dec.DecodeBytes(data)
+		_, strictStreamErr := dec.Decode(&countingReader{r: bytes.NewReader(data)})
+		if (strictErr == nil) != (strictStreamErr == nil) {
+			t.Fatalf("strict DecodeBytes returned %v, but strict Decode returned %v", strictErr, strictStreamErr)
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add(uint8(3), uint8(4), []byte{0, 0, 0, 255, 1, 2, 3, 255, 1, 2, 3, 255, 40, 50, 60, 70})
+	f.Add(uint8(1), uint8(3), []byte{0, 0, 0, 255, 255, 255})
+	f.Fuzz(func(t *testing.T, width, channels uint8, pix []byte) {
+		if width == 0 || (channels != 3 && channels != 4) {
+			return
+		}
+		height := len(pix) / (int(width) * int(channels))
+		if height == 0 {
+			return
+		}
+		img := qoi.NewImage(int(width), height, channels, qoi.SRGB)
+		copy(img.Pix, pix)
+		for _, level := range []qoi.CompressionLevel{qoi.DefaultCompression, qoi.BestSpeed, qoi.BestCompression} {
+			enc := qoi.Encoder{CompressionLevel: level, Channels: channels}
+			var buf bytes.Buffer
+			if err := enc.Encode(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+			dec := qoi.Decoder{Strict: true}
+			decodeImg, err := dec.DecodeBytes(buf.Bytes())
+			if err != nil {
+				t.Fatalf("compression level %d: %v", level, err)
+			}
+			if !bytes.Equal(decodeImg.Pix, img.Pix) {
+				t.Fatalf("compression level %d: decoded pixels differ", level)
+			}
+		}
+	})
+}
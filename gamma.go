@@ -0,0 +1,33 @@
+package qoi
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// gammaTables caches the tables returned by gammaTable, keyed by gamma.
+var gammaTables sync.Map
+
+// gammaTable returns the table mapping 8-bit channel values v, scaled to 0..1, to v^gamma, or nil if gamma
+// is 0 or 1 and thus leaves values unchanged. gamma must be valid according to checkGamma.
+func gammaTable(gamma float64) *[256]uint8 {
+	if gamma == 0 || gamma == 1 {
+		return nil
+	}
+	if table, ok := gammaTables.Load(gamma); ok {
+		return table.(*[256]uint8)
+	}
+	table, _ := gammaTables.LoadOrStore(gamma, transferTable(func(v float64) float64 {
+		return math.Pow(v, gamma)
+	}))
+	return table.(*[256]uint8)
+}
+
+// checkGamma returns an error unless gamma is 0 or a positive finite number.
+func checkGamma(gamma float64) error {
+	if gamma < 0 || math.IsNaN(gamma) || math.IsInf(gamma, 0) {
+		return fmt.Errorf("invalid gamma %v: must be positive and finite, or 0", gamma)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package qoi
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+// gifDelayUnit is the unit of the delays of a gif.GIF.
+const gifDelayUnit = 10 * time.Millisecond
+
+// FromGIF converts g to an Animation. GIF frames may cover only part of the canvas and depend on how their
+// predecessors were disposed of, so each frame of the Animation holds the whole canvas as it is displayed
+// after drawing the corresponding GIF frame, as an *image.NRGBA. The canvas starts out transparent.
+func FromGIF(g *gif.GIF) (*Animation, error) {
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("GIF has no frames")
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = image.Rectangle{}
+		for _, p := range g.Image {
+			bounds = bounds.Union(p.Bounds())
+		}
+	}
+	canvas := image.NewNRGBA(bounds)
+	var previous []byte
+	anim := &Animation{Frames: make([]Frame, len(g.Image)), LoopCount: g.LoopCount}
+	for i, p := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = append(previous[:0], canvas.Pix...)
+		}
+		drawPaletted(canvas, p)
+		frame := image.NewNRGBA(bounds)
+		copy(frame.Pix, canvas.Pix)
+		anim.Frames[i].Image = frame
+		if i < len(g.Delay) {
+			anim.Frames[i].Delay = time.Duration(g.Delay[i]) * gifDelayUnit
+		}
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, p.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous)
+		}
+	}
+	return anim, nil
+}
+
+// drawPaletted draws p over dst, leaving the pixels of dst untouched where p is transparent.
+func drawPaletted(dst *image.NRGBA, p *image.Paletted) {
+	colors := make([]color.NRGBA, len(p.Palette))
+	for i, c := range p.Palette {
+		colors[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+	r := p.Bounds().Intersect(dst.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := int(p.Pix[p.PixOffset(x, y)])
+			if i >= len(colors) || colors[i].A == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, colors[i])
+		}
+	}
+}
+
+// ToGIF converts anim to a GIF. Each frame becomes a full-canvas GIF frame with its own palette. Pixels with
+// an alpha of less than 128 become transparent, all others opaque, as GIF knows no partial transparency.
+// Frames with at most 255 colors are converted losslessly otherwise; frames with more colors are mapped to
+// the Plan 9 palette.
+func ToGIF(anim *Animation) (*gif.GIF, error) {
+	if len(anim.Frames) == 0 {
+		return nil, fmt.Errorf("animation has no frames")
+	}
+	size := anim.Frames[0].Image.Bounds().Size()
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(anim.Frames)),
+		Delay:     make([]int, len(anim.Frames)),
+		Disposal:  make([]byte, len(anim.Frames)),
+		LoopCount: anim.LoopCount,
+		Config:    image.Config{Width: size.X, Height: size.Y},
+	}
+	for i, frame := range anim.Frames {
+		if frameSize := frame.Image.Bounds().Size(); frameSize != size {
+			return nil, fmt.Errorf("frame %d: size %dx%d differs from size %dx%d of first frame", i, frameSize.X, frameSize.Y, size.X, size.Y)
+		}
+		g.Image[i] = toPaletted(frame.Image)
+		g.Delay[i] = int((frame.Delay + gifDelayUnit/2) / gifDelayUnit)
+		// Clear each frame, so its transparent pixels do not reveal the previous one.
+		g.Disposal[i] = gif.DisposalBackground
+	}
+	return g, nil
+}
+
+// toPaletted converts img to an *image.Paletted at the origin whose palette holds a transparent color at
+// index 0.
+func toPaletted(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rowAt := pixelRows(img)
+	dst := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.NRGBA{}})
+	indices := map[color.NRGBA]uint8{}
+	for y := 0; y < height; y++ {
+		row := rowAt(bounds.Min.Y + y)
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: row[x*4], G: row[x*4+1], B: row[x*4+2], A: 255}
+			if row[x*4+3] < 128 {
+				continue // index 0
+			}
+			index, ok := indices[c]
+			if !ok {
+				if len(dst.Palette) == 256 {
+					return toPlan9(img)
+				}
+				index = uint8(len(dst.Palette))
+				indices[c] = index
+				dst.Palette = append(dst.Palette, c)
+			}
+			dst.Pix[y*dst.Stride+x] = index
+		}
+	}
+	return dst
+}
+
+// toPlan9 converts img like toPaletted, mapping opaque pixels to the nearest color of the Plan 9 palette.
+func toPlan9(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	rowAt := pixelRows(img)
+	opaque := color.Palette(palette.Plan9[:255])
+	dst := image.NewPaletted(image.Rect(0, 0, width, height), append(color.Palette{color.NRGBA{}}, opaque...))
+	for y := 0; y < height; y++ {
+		row := rowAt(bounds.Min.Y + y)
+		for x := 0; x < width; x++ {
+			if row[x*4+3] < 128 {
+				continue
+			}
+			c := color.NRGBA{R: row[x*4], G: row[x*4+1], B: row[x*4+2], A: 255}
+			dst.Pix[y*dst.Stride+x] = uint8(1 + opaque.Index(c))
+		}
+	}
+	return dst
+}
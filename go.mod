@@ -2,4 +2,10 @@ module github.com/Zyl9393/qoi
 
 go 1.17
 
-require github.com/peteole/testdata-loader v0.3.0
+require (
+	github.com/peteole/testdata-loader v0.3.0
+	golang.org/x/image v0.18.0
+	golang.org/x/term v0.21.0
+)
+
+require golang.org/x/sys v0.21.0 // indirect
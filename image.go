@@ -1,8 +1,10 @@
 package qoi
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"math"
 )
 
 type Colorspace uint8
@@ -13,24 +15,298 @@ const (
 )
 
 type Image struct {
-	Pix        []byte
+	Pix []byte
+	// Stride is the distance in bytes between vertically adjacent pixels in Pix. A Stride of 0 means rows
+	// are packed tightly, i.e. Width*Channels bytes apart.
+	Stride int
+	// Rect is the bounds of the image. If it is the zero Rectangle, the bounds are (0, 0)-(Width, Height).
+	// Otherwise, Width and Height must match its size.
+	Rect       image.Rectangle
 	Width      int
 	Height     int
 	Channels   uint8
 	Colorspace Colorspace
 }
 
+// NewImage returns a new Image of the given size with all pixels set to zero. It panics if width or height
+// are negative or too large, if channels is not 3 or 4, or if cs is not a valid Colorspace.
+func NewImage(width, height int, channels uint8, cs Colorspace) *Image {
+	if channels != 3 && channels != 4 {
+		panic(fmt.Sprintf("qoi: NewImage: %v %d: must be 3 or 4", ErrInvalidChannels, channels))
+	}
+	if cs != SRGB && cs != Linear {
+		panic(fmt.Sprintf("qoi: NewImage: %v %d: must be 0 (sRGB) or 1 (linear RGB)", ErrInvalidColorspace, cs))
+	}
+	if width < 0 || height < 0 || uint64(width) > math.MaxUint32 || uint64(height) > math.MaxUint32 {
+		panic(fmt.Sprintf("qoi: NewImage: invalid size %dx%d", width, height))
+	}
+	size := uint64(width) * uint64(height) * uint64(channels)
+	if size > uint64(maxInt) {
+		panic(fmt.Sprintf("qoi: NewImage: %v: %dx%d with %d channels", ErrTooLarge, width, height, channels))
+	}
+	return &Image{
+		Pix:        make([]byte, size),
+		Stride:     width * int(channels),
+		Rect:       image.Rect(0, 0, width, height),
+		Width:      width,
+		Height:     height,
+		Channels:   channels,
+		Colorspace: cs,
+	}
+}
+
 func (img *Image) ColorModel() color.Model {
 	return color.NRGBAModel
 }
 
 func (img *Image) Bounds() image.Rectangle {
-	return image.Rect(0, 0, img.Width, img.Height)
+	if img.Rect == (image.Rectangle{}) {
+		return image.Rect(0, 0, img.Width, img.Height)
+	}
+	return img.Rect
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to the pixel at (x, y).
+func (img *Image) PixOffset(x, y int) int {
+	return (y-img.Rect.Min.Y)*img.stride() + (x-img.Rect.Min.X)*int(img.Channels)
+}
+
+// offset is like PixOffset, but with x and y relative to the top-left corner of the image.
+func (img *Image) offset(x, y int) int {
+	return y*img.stride() + x*int(img.Channels)
+}
+
+// stride returns the effective Stride of img.
+func (img *Image) stride() int {
+	if img.Stride == 0 {
+		return img.Width * int(img.Channels)
+	}
+	return img.Stride
+}
+
+// view reports whether img may share Pix with another image, such as the parent of a SubImage, because its
+// rows are not tightly packed or Pix continues beyond its length. Converting such an image in place would
+// change the other image.
+func (img *Image) view() bool {
+	return img.stride() != img.Width*int(img.Channels) || cap(img.Pix) > len(img.Pix)
 }
 
 func (img *Image) At(x, y int) color.Color {
+	return img.NRGBAAt(x, y)
+}
+
+// NRGBAAt is like At, but returns the color as color.NRGBA, avoiding an allocation.
+func (img *Image) NRGBAAt(x, y int) color.NRGBA {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return color.NRGBA{}
+	}
+	i := img.PixOffset(x, y)
+	if img.Channels == 4 {
+		return color.NRGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+	}
+	return color.NRGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: 255}
+}
+
+// Set sets the pixel at (x, y) to c, making Image a draw.Image. The alpha of c is dropped for images with 3
+// channels.
+func (img *Image) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return
+	}
+	i := img.PixOffset(x, y)
+	c1 := color.NRGBAModel.Convert(c).(color.NRGBA)
+	img.Pix[i] = c1.R
+	img.Pix[i+1] = c1.G
+	img.Pix[i+2] = c1.B
+	if img.Channels == 4 {
+		img.Pix[i+3] = c1.A
+	}
+}
+
+// SubImage returns an image representing the portion of img visible through r. The returned image shares
+// its pixels with img.
+func (img *Image) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return &Image{Channels: img.Channels, Colorspace: img.Colorspace}
+	}
+	i := img.PixOffset(r.Min.X, r.Min.Y)
+	j := img.PixOffset(r.Max.X-1, r.Max.Y-1) + int(img.Channels)
+	return &Image{
+		Pix:        img.Pix[i:j],
+		Stride:     img.stride(),
+		Rect:       r,
+		Width:      r.Dx(),
+		Height:     r.Dy(),
+		Channels:   img.Channels,
+		Colorspace: img.Colorspace,
+	}
+}
+
+// Opaque reports whether img is fully opaque, which it always is if it has 3 channels.
+func (img *Image) Opaque() bool {
+	if img.Channels != 4 {
+		return true
+	}
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		for x := 0; x < img.Width; x++ {
+			if img.Pix[i+x*4+3] != 255 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RGBA64At returns the premultiplied 16-bit color of the pixel at (x, y), making Image a color.RGBA64Image.
+func (img *Image) RGBA64At(x, y int) color.RGBA64 {
+	r, g, b, a := img.NRGBAAt(x, y).RGBA()
+	return color.RGBA64{R: uint16(r), G: uint16(g), B: uint16(b), A: uint16(a)}
+}
+
+// ToNRGBA returns img as an *image.NRGBA. If img has 4 channels, the returned image shares its pixels with
+// img, otherwise they are copied and alpha is set to 255.
+func (img *Image) ToNRGBA() *image.NRGBA {
+	if img.Channels == 4 {
+		return &image.NRGBA{Pix: img.Pix, Stride: img.stride(), Rect: img.Bounds()}
+	}
+	dst := image.NewNRGBA(img.Bounds())
+	img.copyRowsTo(dst.Pix, dst.Stride)
+	return dst
+}
+
+// ToRGBA returns a copy of img as an *image.RGBA, with premultiplied alpha.
+func (img *Image) ToRGBA() *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	img.copyRowsTo(dst.Pix, dst.Stride)
+	if img.Channels == 4 {
+		for y := 0; y < img.Height; y++ {
+			premultiplyRow(dst.Pix[y*dst.Stride : y*dst.Stride+img.Width*4])
+		}
+	}
+	return dst
+}
+
+// copyRowsTo copies the pixels of img into the 4-channel rows of dst placed stride bytes apart.
+func (img *Image) copyRowsTo(dst []byte, stride int) {
+	for y := 0; y < img.Height; y++ {
+		src := img.Pix[img.offset(0, y) : img.offset(0, y)+img.Width*int(img.Channels)]
+		row := dst[y*stride : y*stride+img.Width*4]
+		if img.Channels == 4 {
+			copy(row, src)
+		} else {
+			expandRGB(row, src)
+		}
+	}
+}
+
+// Clone returns a deep copy of img with tightly packed rows, which does not share any pixels with img.
+func (img *Image) Clone() *Image {
+	rowSize := img.Width * int(img.Channels)
+	clone := *img
+	clone.Pix = make([]byte, rowSize*img.Height)
+	clone.Stride = rowSize
+	for y := 0; y < img.Height; y++ {
+		copy(clone.Pix[y*rowSize:(y+1)*rowSize], img.Pix[img.offset(0, y):])
+	}
+	return &clone
+}
+
+// ExpandAlpha converts img to 4 channels with tightly packed rows, setting alpha to 255. It does nothing if
+// img already has 4 channels. Pix is converted in place if it is long enough, so use Clone first to keep the
+// original, but never if img is a view into another image, such as one returned by SubImage.
+func (img *Image) ExpandAlpha() {
 	if img.Channels == 4 {
-		return color.NRGBA{R: img.Pix[(y*img.Width+x)*int(img.Channels)], G: img.Pix[(y*img.Width+x)*int(img.Channels)+1], B: img.Pix[(y*img.Width+x)*int(img.Channels)+2], A: img.Pix[(y*img.Width+x)*int(img.Channels)+3]}
+		return
+	}
+	stride := img.stride()
+	if uint64(img.Width)*uint64(img.Height)*4 > uint64(maxInt) {
+		panic(fmt.Sprintf("qoi: ExpandAlpha: %v: %dx%d with 4 channels", ErrTooLarge, img.Width, img.Height))
+	}
+	size := img.Width * img.Height * 4
+	pix := img.Pix
+	if len(pix) < size || img.view() {
+		pix = make([]byte, size)
+	}
+	pix = pix[:size]
+	// Go backwards, so that no pixel is overwritten before it was read when converting in place.
+	for y := img.Height - 1; y >= 0; y-- {
+		for x := img.Width - 1; x >= 0; x-- {
+			i := y*stride + x*3
+			j := (y*img.Width + x) * 4
+			r, g, b := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+			pix[j], pix[j+1], pix[j+2], pix[j+3] = r, g, b, 255
+		}
+	}
+	img.Pix = pix
+	img.Stride = img.Width * 4
+	img.Channels = 4
+}
+
+// DropAlpha converts img to 3 channels with tightly packed rows in place, discarding alpha. If onlyIfOpaque
+// is set, img is only converted if it is fully opaque. DropAlpha reports whether img has 3 channels
+// afterwards. If img is a view into another image, such as one returned by SubImage, it gets new Pix instead,
+// leaving the other image unchanged.
+func (img *Image) DropAlpha(onlyIfOpaque bool) bool {
+	if img.Channels == 3 {
+		return true
+	}
+	if onlyIfOpaque && !img.Opaque() {
+		return false
+	}
+	stride := img.stride()
+	pix := img.Pix
+	if img.view() {
+		pix = make([]byte, img.Width*img.Height*3)
+	}
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			i := y*stride + x*4
+			j := (y*img.Width + x) * 3
+			pix[j], pix[j+1], pix[j+2] = img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+		}
+	}
+	img.Pix = pix[:img.Width*img.Height*3]
+	img.Stride = img.Width * 3
+	img.Channels = 3
+	return true
+}
+
+// DropAlphaOver converts img to 3 channels with tightly packed rows in place like DropAlpha, but composites
+// each pixel over background instead of discarding its alpha, so semi-transparent pixels blend into the
+// background as they would when displayed on it. The alpha of background is ignored. Like DropAlpha, it does
+// not convert views into other images in place.
+func (img *Image) DropAlphaOver(background color.NRGBA) {
+	if img.Channels == 3 {
+		return
+	}
+	stride := img.stride()
+	pix := img.Pix
+	if img.view() {
+		pix = make([]byte, img.Width*img.Height*3)
+	}
+	for y := 0; y < img.Height; y++ {
+		// Row y of the result starts no later than row y of img, and each pixel takes 3 bytes instead of 4, so
+		// every pixel is read before it or any pixel following it is overwritten.
+		i := y * stride
+		j := y * img.Width * 3
+		compositeRow(pix[j:j+img.Width*3], img.Pix[i:i+img.Width*4], background)
+	}
+	img.Pix = pix[:img.Width*img.Height*3]
+	img.Stride = img.Width * 3
+	img.Channels = 3
+}
+
+// compositeRow writes the 4-channel pixels of src composited over background into dst as 3-channel pixels.
+// dst may overlap src as long as it does not start after it.
+func compositeRow(dst, src []byte, background color.NRGBA) {
+	bg := [3]uint32{uint32(background.R), uint32(background.G), uint32(background.B)}
+	for i, j := 0, 0; i+3 < len(src) && j+2 < len(dst); i, j = i+4, j+3 {
+		a := uint32(src[i+3])
+		r, g, b := uint32(src[i]), uint32(src[i+1]), uint32(src[i+2])
+		dst[j] = uint8((r*a + bg[0]*(255-a) + 127) / 255)
+		dst[j+1] = uint8((g*a + bg[1]*(255-a) + 127) / 255)
+		dst[j+2] = uint8((b*a + bg[2]*(255-a) + 127) / 255)
 	}
-	return color.NRGBA{R: img.Pix[(y*img.Width+x)*int(img.Channels)], G: img.Pix[(y*img.Width+x)*int(img.Channels)+1], B: img.Pix[(y*img.Width+x)*int(img.Channels)+2], A: 255}
 }
@@ -0,0 +1,127 @@
+// Package ext holds what the non-standard extensions of QOI, such as qoi16 and qoigray, share with QOI and
+// each other: the layout of the header, the end marker and the limit on the size of images.
+package ext
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Zyl9393/qoi"
+)
+
+const (
+	// HeaderSize is the size of the header, which has the layout of the QOI header with a different magic.
+	HeaderSize = 14
+
+	// MaxPixels is the maximum amount of pixels of an image, as for QOI.
+	MaxPixels = 400000000
+
+	maxInt = int(^uint(0) >> 1)
+)
+
+// EndMarker terminates the ops of an image, as in QOI.
+var EndMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// Header holds the header of an image.
+type Header struct {
+	Width, Height int
+	Channels      byte
+	Colorspace    qoi.Colorspace
+}
+
+// CheckSize returns an error unless an image of the given size may be encoded.
+func CheckSize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: %dx%d", qoi.ErrEmptyImage, width, height)
+	}
+	if uint64(width)*uint64(height) >= MaxPixels {
+		return fmt.Errorf("%w: %dx%d image must have less than %d pixels total", qoi.ErrTooLarge, width, height, MaxPixels)
+	}
+	return nil
+}
+
+// CheckBytes returns an error wrapping qoi.ErrTooLarge if the pixels of the image with header h take up
+// more than maxBytes bytes with bytesPerPixel bytes each, or more than fit in an int. If maxBytes is 0, the
+// size is only limited by the latter.
+func CheckBytes(h Header, bytesPerPixel, maxBytes int) error {
+	size := uint64(h.Width) * uint64(h.Height) * uint64(bytesPerPixel)
+	if maxBytes > 0 && size > uint64(maxBytes) {
+		return fmt.Errorf("%w: %dx%d with %d bytes per pixel exceeds limit of %d bytes", qoi.ErrTooLarge, h.Width, h.Height, bytesPerPixel, maxBytes)
+	}
+	if size > uint64(maxInt) {
+		return fmt.Errorf("%w: %dx%d with %d bytes per pixel", qoi.ErrTooLarge, h.Width, h.Height, bytesPerPixel)
+	}
+	return nil
+}
+
+// WriteHeader writes the header of an image starting with magic to out.
+func WriteHeader(out *bufio.Writer, magic string, h Header) {
+	var header [HeaderSize]byte
+	copy(header[:4], magic)
+	binary.BigEndian.PutUint32(header[4:8], uint32(h.Width))
+	binary.BigEndian.PutUint32(header[8:12], uint32(h.Height))
+	header[12] = h.Channels
+	header[13] = byte(h.Colorspace)
+	out.Write(header[:])
+}
+
+// ReadHeader reads the header of an image from r and returns an error wrapping errBadMagic unless it starts
+// with magic, or an error if it states an amount of channels outside minChannels..maxChannels or is invalid
+// otherwise.
+func ReadHeader(r io.Reader, magic string, errBadMagic error, minChannels, maxChannels byte) (Header, error) {
+	var header [HeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Header{}, fmt.Errorf("could not read header: %w", Truncated(err))
+	}
+	if string(header[:4]) != magic {
+		return Header{}, fmt.Errorf("%w: %q", errBadMagic, header[:4])
+	}
+	w, h := binary.BigEndian.Uint32(header[4:8]), binary.BigEndian.Uint32(header[8:12])
+	channels := header[12]
+	if channels < minChannels || channels > maxChannels {
+		return Header{}, fmt.Errorf("%w: %d", qoi.ErrInvalidChannels, channels)
+	}
+	if header[13] != byte(qoi.SRGB) && header[13] != byte(qoi.Linear) {
+		return Header{}, fmt.Errorf("%w: %d", qoi.ErrInvalidColorspace, header[13])
+	}
+	if w == 0 || h == 0 {
+		return Header{}, fmt.Errorf("%w: %dx%d", qoi.ErrEmptyImage, w, h)
+	}
+	if uint64(w)*uint64(h) >= MaxPixels {
+		return Header{}, fmt.Errorf("%w: %dx%d", qoi.ErrTooLarge, w, h)
+	}
+	return Header{Width: int(w), Height: int(h), Channels: channels, Colorspace: qoi.Colorspace(header[13])}, nil
+}
+
+// ReadEnd reads the end marker from in and returns an error if it is bad or missing.
+func ReadEnd(in io.ByteReader) error {
+	var end [8]byte
+	for i := range end {
+		b, err := in.ReadByte()
+		if err != nil {
+			return fmt.Errorf("could not read end marker: %w", Truncated(err))
+		}
+		end[i] = b
+	}
+	if !bytes.Equal(end[:], EndMarker) {
+		return fmt.Errorf("bad end marker %x", end)
+	}
+	return nil
+}
+
+// PixelError returns the error to report for err, which occurred while decoding the pixel at the given
+// index.
+func PixelError(err error, pixel int) error {
+	return fmt.Errorf("could not decode pixel %d: %w", pixel, Truncated(err))
+}
+
+// Truncated wraps err in qoi.ErrTruncated if it reports that the input ended early.
+func Truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %v", qoi.ErrTruncated, err)
+	}
+	return err
+}
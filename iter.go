@@ -0,0 +1,38 @@
+//go:build go1.23
+
+package qoi
+
+import (
+	"image"
+	"image/color"
+	"iter"
+)
+
+// Rows returns an iterator over the rows of img, yielding the y coordinate and the pixels of each row. The
+// yielded slices share their pixels with img.
+func (img *Image) Rows() iter.Seq2[int, []byte] {
+	return func(yield func(int, []byte) bool) {
+		rowSize := img.Width * int(img.Channels)
+		for y := 0; y < img.Height; y++ {
+			i := img.offset(0, y)
+			if !yield(img.Rect.Min.Y+y, img.Pix[i:i+rowSize:i+rowSize]) {
+				return
+			}
+		}
+	}
+}
+
+// Pixels returns an iterator over all pixels of img in row-major order, yielding the coordinates and the
+// color of each pixel.
+func (img *Image) Pixels() iter.Seq2[image.Point, color.NRGBA] {
+	return func(yield func(image.Point, color.NRGBA) bool) {
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if !yield(image.Point{x, y}, img.NRGBAAt(x, y)) {
+					return
+				}
+			}
+		}
+	}
+}
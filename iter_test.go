@@ -0,0 +1,41 @@
+//go:build go1.23
+
+package qoi_test
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+)
+
+func TestImageRowsPixels(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, Width: 2, Height: 2, Channels: 3}
+	numRows := 0
+	for y, row := range img.Rows() {
+		if !bytes.Equal(row, img.Pix[y*6:(y+1)*6]) {
+			t.Fatalf("row %d: expected %v, got %v", y, img.Pix[y*6:(y+1)*6], row)
+		}
+		numRows++
+	}
+	if numRows != img.Height {
+		t.Fatalf("expected %d rows, got %d", img.Height, numRows)
+	}
+	var points []image.Point
+	for p, c := range img.Pixels() {
+		if c != img.NRGBAAt(p.X, p.Y) {
+			t.Fatalf("pixel %v: expected %v, got %v", p, img.NRGBAAt(p.X, p.Y), c)
+		}
+		points = append(points, p)
+		if len(points) == 3 {
+			break
+		}
+	}
+	want := []image.Point{{0, 0}, {1, 0}, {0, 1}}
+	for i := range want {
+		if points[i] != want[i] {
+			t.Fatalf("expected points %v, got %v", want, points)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package qoi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Metadata chunks written by Encoder.Metadata follow the end marker and the CRC trailer, if any. Each
+// chunk consists of a 4-byte type, the big-endian uint32 length of its payload and the payload. They are
+// not part of the QOI specification, but decoders ignore data following the end marker unless they are
+// strict about it.
+const (
+	chunkICCProfile = "iccp"
+	chunkEXIF       = "exif"
+	chunkText       = "text"
+
+	chunkHeaderSize = 8
+)
+
+// Metadata holds data about an image stored alongside its pixels.
+type Metadata struct {
+	// ICCProfile is the ICC color profile of the image.
+	ICCProfile []byte
+	// EXIF is an EXIF blob, as stored in the APP1 segment of a JPEG file after the "Exif\x00\x00" header.
+	EXIF []byte
+	// Comments are arbitrary text comments.
+	Comments []string
+}
+
+// writeChunks writes the chunks holding m to out. A nil m writes nothing.
+func (m *Metadata) writeChunks(out *bufio.Writer) error {
+	if m == nil {
+		return nil
+	}
+	if m.ICCProfile != nil {
+		if err := writeChunk(out, chunkICCProfile, m.ICCProfile); err != nil {
+			return err
+		}
+	}
+	if m.EXIF != nil {
+		if err := writeChunk(out, chunkEXIF, m.EXIF); err != nil {
+			return err
+		}
+	}
+	for _, comment := range m.Comments {
+		if err := writeChunk(out, chunkText, []byte(comment)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeChunk(out *bufio.Writer, typ string, payload []byte) error {
+	if uint64(len(payload)) > 1<<32-1 {
+		return fmt.Errorf("%s chunk of %d bytes is too large", typ, len(payload))
+	}
+	var header [chunkHeaderSize]byte
+	copy(header[:4], typ)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	out.Write(header[:])
+	out.Write(payload)
+	return nil
+}
+
+// isChunkType reports whether b starts with a type of metadata chunk.
+func isChunkType(b []byte) bool {
+	switch string(b[:4]) {
+	case chunkICCProfile, chunkEXIF, chunkText:
+		return true
+	}
+	return false
+}
+
+// add stores the payload of a chunk of the given type in m. The payload is retained.
+func (m *Metadata) add(typ string, payload []byte) {
+	switch typ {
+	case chunkICCProfile:
+		m.ICCProfile = payload
+	case chunkEXIF:
+		m.EXIF = payload
+	case chunkText:
+		m.Comments = append(m.Comments, string(payload))
+	}
+}
+
+// DecodeWithMetadata is like Decode, but also returns the metadata stored along with the image by
+// Encoder.Metadata. The returned Metadata is empty if there is none. The end marker must be present.
+func DecodeWithMetadata(r io.Reader) (*Image, *Metadata, error) {
+	var dec Decoder
+	return dec.DecodeWithMetadata(r)
+}
+
+// DecodeWithMetadata is like the package-level DecodeWithMetadata, but uses the settings of dec.
+func (dec *Decoder) DecodeWithMetadata(r io.Reader) (*Image, *Metadata, error) {
+	m := new(Metadata)
+	withMetadata := *dec
+	withMetadata.metadata = m
+	img, err := withMetadata.Decode(r)
+	return img, m, err
+}
+
+func (d *bodyDecoder) readChunks(m *Metadata, strict bool) error {
+	for {
+		// Leave the input untouched unless it holds another chunk, like readTrailer.
+		b, err := d.peek(4)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("could not read metadata chunk: %w", err)
+		}
+		if len(b) < 4 {
+			return shortChunkError(len(b), strict)
+		}
+		if !isChunkType(b) {
+			return nil
+		}
+		header := d.raw[:chunkHeaderSize]
+		if _, err := io.ReadFull(d.in, header); err != nil {
+			return fmt.Errorf("could not read metadata chunk: %w", truncated(err))
+		}
+		typ := string(header[:4])
+		length := int64(binary.BigEndian.Uint32(header[4:]))
+		// Copy instead of allocating length bytes up front, so a corrupt length cannot cause a huge
+		// allocation.
+		var payload bytes.Buffer
+		if _, err = io.CopyN(&payload, d.in, length); err != nil {
+			return fmt.Errorf("could not read %s chunk of %d bytes: %w", typ, length, truncated(err))
+		}
+		m.add(typ, payload.Bytes())
+	}
+}
+
+func (d *sliceDecoder) readChunks(m *Metadata, strict bool) error {
+	for {
+		rest := d.data[d.pos:]
+		if len(rest) < 4 {
+			return shortChunkError(len(rest), strict)
+		}
+		if !isChunkType(rest) {
+			return nil
+		}
+		if len(rest) < chunkHeaderSize {
+			return fmt.Errorf("could not read metadata chunk: %w", truncated(io.ErrUnexpectedEOF))
+		}
+		typ := string(rest[:4])
+		length := uint64(binary.BigEndian.Uint32(rest[4:chunkHeaderSize]))
+		if uint64(len(rest)-chunkHeaderSize) < length {
+			return fmt.Errorf("could not read %s chunk of %d bytes: %w", typ, length, truncated(io.ErrUnexpectedEOF))
+		}
+		end := chunkHeaderSize + int(length)
+		m.add(typ, append([]byte(nil), rest[chunkHeaderSize:end]...))
+		d.pos += end
+	}
+}
+
+// shortChunkError returns the error to report for n bytes following the metadata chunks, too few to hold the
+// type of another chunk, which is nil for none or unless strict is set.
+func shortChunkError(n int, strict bool) error {
+	if n == 0 || !strict {
+		return nil
+	}
+	return fmt.Errorf("%d bytes of trailing data after end marker are too short for a metadata chunk", n)
+}
@@ -0,0 +1,256 @@
+package qoi
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// DecodePaletted decodes a QOI image from r into a new *image.Paletted with palette p, mapping each pixel to
+// the nearest color of p as p.Index does. p must have 1 to 256 colors.
+func DecodePaletted(r io.Reader, p color.Palette) (*image.Paletted, error) {
+	if len(p) == 0 || len(p) > 256 {
+		return nil, fmt.Errorf("palette must have 1 to 256 colors, got %d", len(p))
+	}
+	header, err := DecodeHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+	if _, err := header.pixLen(4); err != nil {
+		return nil, err
+	}
+	dst := image.NewPaletted(image.Rect(0, 0, int(header.width), int(header.height)), p)
+	return dst, decodeBodyInto(r, dst)
+}
+
+// DecodeQuantized decodes a QOI image from r into a new *image.Paletted whose palette of at most n colors is
+// chosen by median cut, weighting colors by how many pixels have them. Images with at most n distinct colors
+// are decoded losslessly. Fully transparent pixels all map to the same color. n must be in 1..256.
+func DecodeQuantized(r io.Reader, n int) (*image.Paletted, error) {
+	if n < 1 || n > 256 {
+		return nil, fmt.Errorf("palette size must be in 1..256, got %d", n)
+	}
+	nrgba, err := DecodeNRGBA(r)
+	if err != nil {
+		return nil, err
+	}
+	hist := newHistogram()
+	hist.addRows(pixelRows(nrgba), nrgba.Bounds())
+	dst := image.NewPaletted(nrgba.Bounds(), hist.medianCut(n))
+	indexRows(dst, pixelRows(nrgba))
+	return dst, nil
+}
+
+// indexRows sets the pixels of dst to the nearest colors of its palette of the NRGBA rows returned by rowAt.
+func indexRows(dst *image.Paletted, rowAt func(y int) []byte) {
+	bounds := dst.Bounds()
+	lookup := newPaletteLookup(dst.Palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		i := dst.PixOffset(bounds.Min.X, y)
+		lookup.indexRow(dst.Pix[i:i+bounds.Dx()], rowAt(y))
+	}
+}
+
+// paletteLookup finds the nearest color of a palette, remembering the index of each color it has seen, as
+// images typically repeat few colors many times.
+type paletteLookup struct {
+	palette color.Palette
+	indices map[color.NRGBA]uint8
+}
+
+func newPaletteLookup(p color.Palette) *paletteLookup {
+	return &paletteLookup{palette: p, indices: map[color.NRGBA]uint8{}}
+}
+
+// indexRow stores the palette indices of the pixels of the NRGBA row src in dst.
+func (l *paletteLookup) indexRow(dst, src []byte) {
+	for x := range dst {
+		c := color.NRGBA{R: src[x*4], G: src[x*4+1], B: src[x*4+2], A: src[x*4+3]}
+		index, ok := l.indices[c]
+		if !ok {
+			index = uint8(l.palette.Index(c))
+			l.indices[c] = index
+		}
+		dst[x] = index
+	}
+}
+
+// histogram counts the pixels of each color.
+type histogram struct {
+	counts map[color.NRGBA]uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: map[color.NRGBA]uint64{}}
+}
+
+// addRows counts the pixels of the NRGBA rows returned by rowAt for the rows of bounds. Fully transparent
+// pixels are all counted as color.NRGBA{}. Runs of the same color are counted at once, so images QOI
+// compresses well are also counted quickly.
+func (h *histogram) addRows(rowAt func(y int) []byte, bounds image.Rectangle) {
+	var run color.NRGBA
+	var runLength uint64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := rowAt(y)
+		for i := 0; i+4 <= len(row); i += 4 {
+			var c color.NRGBA
+			if row[i+3] != 0 {
+				c = color.NRGBA{R: row[i], G: row[i+1], B: row[i+2], A: row[i+3]}
+			}
+			if c == run {
+				runLength++
+				continue
+			}
+			if runLength > 0 {
+				h.counts[run] += runLength
+			}
+			run, runLength = c, 1
+		}
+	}
+	if runLength > 0 {
+		h.counts[run] += runLength
+	}
+}
+
+// weightedColor is a color and the amount of pixels having it.
+type weightedColor struct {
+	c     [4]uint8
+	count uint64
+}
+
+// medianCut returns a palette of at most n colors representing the colors counted by h. Starting with a
+// box holding all colors, it repeatedly splits the box with the widest range in any channel at the weighted
+// median of that channel, until there are n boxes or no box holds more than one color. Each box contributes
+// the weighted average of its colors.
+func (h *histogram) medianCut(n int) color.Palette {
+	colors := make([]weightedColor, 0, len(h.counts))
+	for c, count := range h.counts {
+		colors = append(colors, weightedColor{c: [4]uint8{c.R, c.G, c.B, c.A}, count: count})
+	}
+	// Map iteration order is random, so sort to get the same palette for the same image every time.
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		return uint32(a[0])<<24|uint32(a[1])<<16|uint32(a[2])<<8|uint32(a[3]) < uint32(b[0])<<24|uint32(b[1])<<16|uint32(b[2])<<8|uint32(b[3])
+	})
+	boxes := [][]weightedColor{colors}
+	for len(boxes) < n {
+		widest, channel, widestRange := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for c := 0; c < 4; c++ {
+				if r := channelRange(box, c); r > widestRange {
+					widest, channel, widestRange = i, c, r
+				}
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		a, b := splitBox(boxes[widest], channel)
+		boxes[widest] = a
+		boxes = append(boxes, b)
+	}
+	p := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		if len(box) > 0 {
+			p = append(p, averageColor(box))
+		}
+	}
+	return p
+}
+
+// channelRange returns the difference between the largest and smallest value of channel c in box.
+func channelRange(box []weightedColor, c int) int {
+	lo, hi := box[0].c[c], box[0].c[c]
+	for _, wc := range box[1:] {
+		if wc.c[c] < lo {
+			lo = wc.c[c]
+		}
+		if wc.c[c] > hi {
+			hi = wc.c[c]
+		}
+	}
+	return int(hi) - int(lo)
+}
+
+// splitBox sorts box by channel c and splits it at the weighted median, such that both halves are non-empty.
+func splitBox(box []weightedColor, c int) (a, b []weightedColor) {
+	sort.SliceStable(box, func(i, j int) bool { return box[i].c[c] < box[j].c[c] })
+	var total uint64
+	for _, wc := range box {
+		total += wc.count
+	}
+	k := 1
+	var sum uint64
+	for ; k < len(box)-1; k++ {
+		sum += box[k-1].count
+		if sum*2 >= total {
+			break
+		}
+	}
+	return box[:k], box[k:]
+}
+
+// averageColor returns the average of the colors of box, weighted by their counts.
+func averageColor(box []weightedColor) color.NRGBA {
+	var sums [4]uint64
+	var total uint64
+	for _, wc := range box {
+		for c := range sums {
+			sums[c] += uint64(wc.c[c]) * wc.count
+		}
+		total += wc.count
+	}
+	var avg [4]uint8
+	for c := range sums {
+		avg[c] = uint8((sums[c] + total/2) / total)
+	}
+	return color.NRGBA{R: avg[0], G: avg[1], B: avg[2], A: avg[3]}
+}
+
+// Quantizer is a draw.Quantizer choosing palettes by median cut, like DecodeQuantized, from the colors of all
+// images it decoded. This makes it possible to quantize frames of a sequence, or images converted to GIF with
+// gif.Options, with palettes fit for all of them. A Quantizer which decoded no images chooses palettes from
+// the colors of the image being quantized instead.
+//
+// A Quantizer must not be used from multiple goroutines concurrently.
+type Quantizer struct {
+	// Decoder holds the settings used to decode images.
+	Decoder Decoder
+
+	hist *histogram
+}
+
+// Decode decodes a QOI image from r like Decoder.Decode and counts the pixels of each of its colors.
+func (q *Quantizer) Decode(r io.Reader) (*Image, error) {
+	img, err := q.Decoder.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if q.hist == nil {
+		q.hist = newHistogram()
+	}
+	q.hist.addRows(pixelRows(img), img.Bounds())
+	return img, nil
+}
+
+// Quantize implements draw.Quantizer, appending up to cap(p)-len(p) colors to p.
+func (q *Quantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := cap(p) - len(p)
+	if n <= 0 {
+		return p
+	}
+	if n > 256 {
+		n = 256
+	}
+	hist := q.hist
+	if hist == nil {
+		hist = newHistogram()
+		hist.addRows(pixelRows(m), m.Bounds())
+	}
+	return append(p, hist.medianCut(n)...)
+}
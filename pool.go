@@ -0,0 +1,76 @@
+package qoi
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// Pool encodes and decodes batches of QOI files concurrently. The zero value uses one goroutine per CPU and
+// the default settings of Encoder and Decoder. Scratch buffers are shared between all goroutines of all
+// Pools, so running many small jobs does not allocate them anew for every file.
+type Pool struct {
+	// Workers is the maximum amount of files processed at once. If 0, runtime.GOMAXPROCS(0) is used.
+	Workers int
+	Encoder Encoder
+	Decoder Decoder
+}
+
+// DecodeAll decodes the QOI files at paths. The image decoded from paths[i] is stored at index i of the
+// returned slice. All files are processed even if some fail; the error of the first failing path is
+// returned, and the images of failed paths are nil.
+func (p *Pool) DecodeAll(paths []string) ([]*Image, error) {
+	images := make([]*Image, len(paths))
+	err := p.run(len(paths), func(i int) (err error) {
+		images[i], err = p.Decoder.DecodeFile(paths[i])
+		return err
+	})
+	return images, err
+}
+
+// EncodeAll encodes images[i] as a QOI file at paths[i] for each i, like EncodeFile. All images are
+// processed even if some fail; the error of the first failing path is returned.
+func (p *Pool) EncodeAll(paths []string, images []image.Image) error {
+	if len(paths) != len(images) {
+		return fmt.Errorf("got %d paths for %d images", len(paths), len(images))
+	}
+	return p.run(len(paths), func(i int) error {
+		return p.Encoder.EncodeFile(paths[i], images[i])
+	})
+}
+
+// run calls fn for each index in [0, n) on up to p.Workers goroutines and returns the error for the lowest
+// index, if any.
+func (p *Pool) run(n int, fn func(i int) error) error {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("image %d: %w", i, err)
+		}
+	}
+	return nil
+}
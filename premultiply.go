@@ -0,0 +1,76 @@
+package qoi
+
+// Premultiply multiplies the color channels of the pixels of img by their alpha in place, as expected by
+// e.g. image.RGBA and most compositing APIs. Images with 3 channels are opaque and left untouched.
+//
+// The methods of Image treat Pix as holding non-premultiplied colors, so a premultiplied Image is meant to
+// have its Pix handed to consumers of premultiplied pixels, or to be turned back with Unpremultiply.
+func (img *Image) Premultiply() {
+	if img.Channels != 4 {
+		return
+	}
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		premultiplyRow(img.Pix[i : i+img.Width*4])
+	}
+}
+
+// Unpremultiply reverts Premultiply, dividing the color channels of the pixels of img by their alpha in
+// place. Color channels exceeding alpha, which cannot result from premultiplying, are clamped to it. Images
+// with 3 channels are left untouched.
+func (img *Image) Unpremultiply() {
+	if img.Channels != 4 {
+		return
+	}
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		unpremultiplyRow(img.Pix[i : i+img.Width*4])
+	}
+}
+
+// ThresholdAlpha snaps the alpha of each pixel of img to 0 if it is less than threshold and to 255
+// otherwise, as needed for cutout transparency. Pixels becoming transparent are set to transparent black, so
+// that they form runs regardless of their former color. Images with 3 channels are left untouched.
+func (img *Image) ThresholdAlpha(threshold uint8) {
+	if img.Channels != 4 {
+		return
+	}
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		thresholdAlphaRow(img.Pix[i:i+img.Width*4], threshold)
+	}
+}
+
+// thresholdAlphaRow applies ThresholdAlpha to the 4-channel pixels of row.
+func thresholdAlphaRow(row []byte, threshold uint8) {
+	for i := 0; i+3 < len(row); i += 4 {
+		if row[i+3] < threshold {
+			row[i], row[i+1], row[i+2], row[i+3] = 0, 0, 0, 0
+		} else {
+			row[i+3] = 255
+		}
+	}
+}
+
+// unpremultiplyRow divides the color channels of premultiplied 4-channel pixels in row by their alpha,
+// rounding like color.NRGBAModel does.
+func unpremultiplyRow(row []byte) {
+	for i := 0; i+3 < len(row); i += 4 {
+		px := row[i : i+4 : i+4]
+		a := px[3]
+		if a == 0xff {
+			continue
+		}
+		r, g, b := px[0], px[1], px[2]
+		if r > a {
+			r = a
+		}
+		if g > a {
+			g = a
+		}
+		if b > a {
+			b = a
+		}
+		unpremultiply(px, uint32(r)*0x101, uint32(g)*0x101, uint32(b)*0x101, uint32(a)*0x101)
+	}
+}
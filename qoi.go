@@ -2,18 +2,22 @@ package qoi
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"io"
+	"os"
+	"sync"
 )
 
 func init() {
 	image.RegisterFormat("qoi", qoiMagic, decode, DecodeConfig)
 }
 
+// Header is the header of a QOI image, as returned by DecodeHeader.
 type Header struct {
 	magic      [4]byte
 	width      uint32
@@ -22,6 +26,36 @@ type Header struct {
 	colorspace Colorspace
 }
 
+// pixLen returns the size in bytes of the pixel data of the image when decoded into the given amount of
+// channels, computed without overflow. An error is returned if the size does not fit into an int.
+func (h Header) pixLen(channels uint8) (int, error) {
+	size := uint64(h.width) * uint64(h.height) * uint64(channels)
+	if size > uint64(maxInt) {
+		return 0, fmt.Errorf("%w: %dx%d with %d channels", ErrTooLarge, h.width, h.height, channels)
+	}
+	return int(size), nil
+}
+
+// Width returns the width of the image in pixels.
+func (h Header) Width() int {
+	return int(h.width)
+}
+
+// Height returns the height of the image in pixels.
+func (h Header) Height() int {
+	return int(h.height)
+}
+
+// Channels returns the amount of channels of the image, which is 3 (RGB) or 4 (RGBA).
+func (h Header) Channels() uint8 {
+	return h.channels
+}
+
+// Colorspace returns the colorspace of the image.
+func (h Header) Colorspace() Colorspace {
+	return h.colorspace
+}
+
 const (
 	qoi_INDEX byte = 0b00_000000
 	qoi_DIFF  byte = 0b01_000000
@@ -37,8 +71,14 @@ var qoiEnd = []byte{0, 0, 0, 0, 0, 0, 0, 0b00000001}
 
 const qoiMagic = "qoif"
 
+const qoiHeaderSize = 14
+
+const defaultBufferSize = 4096
+
 const qoiPixelsMax = 400_000_000 // 400 million pixels ought to be enough for anybody
 
+const maxInt = int(^uint(0) >> 1)
+
 func qoi_COLOR_HASH(r, g, b, a byte) byte {
 	return byte(r*3 + g*5 + b*7 + a*11)
 }
@@ -50,66 +90,693 @@ func DecodeConfig(reader io.Reader) (cfg image.Config, err error) {
 	if err != nil {
 		return cfg, err
 	}
+	// Reject images that cannot be decoded on this platform before their size is converted to int.
+	if _, err := header.pixLen(header.channels); err != nil {
+		return cfg, err
+	}
 	return image.Config{ColorModel: color.NRGBAModel, Width: int(header.width), Height: int(header.height)}, nil
 }
 
+// Config is an image.Config extended by the QOI-specific header fields.
+type Config struct {
+	image.Config
+	Channels   uint8
+	Colorspace Colorspace
+}
+
+// PixLen returns the length of the Pix of an Image decoded from a file with this configuration, or -1 if
+// it does not fit into an int.
+func (cfg Config) PixLen() int {
+	if cfg.Width < 0 || cfg.Height < 0 {
+		return -1
+	}
+	h := Header{width: uint32(cfg.Width), height: uint32(cfg.Height)}
+	if uint64(h.width) != uint64(cfg.Width) || uint64(h.height) != uint64(cfg.Height) {
+		return -1
+	}
+	size, err := h.pixLen(cfg.Channels)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// DecodeExtendedConfig is like DecodeConfig, but also reports the channels and colorspace of the image.
+func DecodeExtendedConfig(reader io.Reader) (cfg Config, err error) {
+	header, err := DecodeHeader(reader)
+	if err != nil {
+		return cfg, err
+	}
+	if _, err := header.pixLen(header.channels); err != nil {
+		return cfg, err
+	}
+	imgCfg := image.Config{ColorModel: color.NRGBAModel, Width: int(header.width), Height: int(header.height)}
+	return Config{Config: imgCfg, Channels: header.channels, Colorspace: header.colorspace}, nil
+}
+
 func decode(r io.Reader) (image.Image, error) {
 	return Decode(r)
 }
 
+// Decoder configures decoding of QOI images. The zero value decodes like Decode.
+type Decoder struct {
+	// Channels forces decoded images to have 3 or 4 channels, regardless of the channels stated in the
+	// header. Alpha is dropped or padded with 255 as needed. If 0, the header's channels are used.
+	Channels uint8
+	// FlipVertical places the rows of decoded images bottom-up, as expected by e.g. OpenGL's glTexImage2D.
+	FlipVertical bool
+	// BGRA swaps the red and blue channels of decoded pixels, as expected by e.g. DirectX and Cairo surfaces.
+	BGRA bool
+	// Strict verifies that the last pixel is followed by the end marker and reports any data following it,
+	// as well as runs extending past the last pixel.
+	Strict bool
+	// MaxBytes limits the size in bytes of the pixel data of images to decode, so that hostile headers cannot
+	// cause huge allocations. Images exceeding it are rejected before any pixel data is read. If 0, the size
+	// is not limited.
+	MaxBytes int
+	// BufferSize is the size in bytes of the buffer used to read from readers which do not implement
+	// io.ByteReader themselves. If 0, a default of 4096 bytes is used.
+	BufferSize int
+	// Salvage makes decode functions which return an Image return it along with ErrTruncated if the data
+	// ends before the last pixel, with all pixels which were not decoded set to SalvageColor. Without it, the
+	// pixels of an Image returned along with an error are unspecified.
+	Salvage      bool
+	SalvageColor color.NRGBA
+	// VerifyCRC checks the pixels of images against the CRC trailer written by Encoder.CRC, if present, and
+	// returns ErrChecksum if they do not match. It also implies reading the end marker. The alpha of 4-channel
+	// images is needed to verify them, so Channels must not be 3 for such images.
+	VerifyCRC bool
+	// CompositeAlpha makes decoding 4-channel images into 3 channels, as set by Channels, composite their
+	// pixels over Background like Image.DropAlphaOver does, instead of discarding alpha, which shows
+	// semi-transparent pixels in wrong colors. As alpha is kept until then, it also allows VerifyCRC.
+	CompositeAlpha bool
+	Background     color.NRGBA
+	// ConvertColorspace converts the pixels of decoded images from the colorspace stated in the header to
+	// Colorspace like ConvertColorspace does, so that applications can rely on getting pixels in the
+	// colorspace they work in. The Colorspace of returned images is set accordingly. Colorspace is ignored
+	// without ConvertColorspace.
+	ConvertColorspace bool
+	Colorspace        Colorspace
+	// Premultiply premultiplies the color channels of decoded 4-channel images by their alpha, like
+	// Image.Premultiply does, for consumers expecting premultiplied pixels. QOI stores non-premultiplied
+	// colors, so this is applied after all other transformations.
+	Premultiply bool
+	// Gamma adjusts the color channels of decoded pixels, mapping each value v, scaled to 0..1, to v^Gamma
+	// through a lookup table while decoding. It is applied to the pixels as stored, before converting their
+	// colorspace. Alpha is not affected. Gamma values of 0 and 1 leave pixels unchanged.
+	Gamma float64
+	// ColorTransformer transforms the colors of decoded pixels if not nil. It is called with each row as
+	// soon as it is decoded and before all other transformations, so it sees the colors as stored. Note that
+	// metadata chunks holding an ICC profile follow the pixels, so a ColorTransformer depending on the profile
+	// of an image needs it to be known beforehand.
+	ColorTransformer ColorTransformer
+	// Swizzle reorders the channels of decoded pixels if not empty. It must be a permutation of "RGBA", such
+	// as "BGRA" or "ARGB", stating the order of the channels of the output, as expected by platform surface
+	// formats. For images decoded into 3 channels, alpha is left out. It is applied after all other
+	// transformations and cannot be combined with BGRA. Methods of Image assume RGB(A) order, so a swizzled
+	// Image is meant to have its Pix handed to the consumer of the channel order.
+	Swizzle string
+
+	// concatenated is set while decoding one of several back-to-back images, each of which must be
+	// terminated by its end marker.
+	concatenated bool
+	// metadata receives the metadata chunks following the image if not nil.
+	metadata *Metadata
+}
+
 func Decode(reader io.Reader) (*Image, error) {
-	header, err := DecodeHeader(reader)
+	var dec Decoder
+	return dec.Decode(reader)
+}
+
+// Decode decodes a QOI image from reader, using the settings of dec.
+// Decoding state is pooled across calls, so the returned Image and its Pix are the only allocations made.
+//
+// If reader is an io.Seeker of known size, such as a *bytes.Reader or a regular *os.File, the image is read
+// at once and decoded like DecodeBytes does. Data following the pixels is left unread, as when decoding from
+// an io.ByteReader.
+func (dec *Decoder) Decode(reader io.Reader) (*Image, error) {
+	if err := dec.checkConversions(); err != nil {
+		return nil, err
+	}
+	img, err := dec.decode(reader)
+	dec.postprocess(img)
+	return img, err
+}
+
+// decode is like Decode, but does not convert the colorspace.
+func (dec *Decoder) decode(reader io.Reader) (*Image, error) {
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		size, ok, err := remainingSize(rs)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return dec.decodeSized(rs, size)
+		}
+	}
+	d := newBodyDecoder(reader, dec.BufferSize)
+	defer d.release()
+	header, err := d.readHeader()
 	if err != nil {
 		return nil, err
 	}
-	pix := make([]uint8, header.width*header.height*uint32(header.channels))
-	img := &Image{
-		Pix:        pix,
+	img, err := dec.newImage(header)
+	if err != nil {
+		return nil, err
+	}
+	d.start(img.Width, img.Height)
+	return img, dec.decodeBody(d, img.Pix, img.Width, img.Height, int(img.Channels), img.Stride)
+}
+
+// remainingSize returns the amount of bytes between the current position of s and its end, and whether
+// that amount is known. s is positioned where it was before.
+func remainingSize(s io.Seeker) (int64, bool, error) {
+	if f, ok := s.(*os.File); ok {
+		// Seeking succeeds on some devices and pipes without telling their size.
+		if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+			return 0, false, nil
+		}
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false, nil
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false, nil
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return 0, false, err
+	}
+	return end - cur, end >= cur, nil
+}
+
+// slurpPool holds the buffers decodeSized reads images into. Buffers larger than maxPooledSlurp are not
+// retained.
+var slurpPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+const maxPooledSlurp = 16 << 20
+
+// decodeSized is like Decode, but for readers with size bytes left to read. Unless the body is larger than
+// any valid encoding of the image, the whole image is read at once and decoded by a sliceDecoder, and r is
+// seeked back to where the image ends.
+func (dec *Decoder) decodeSized(r io.ReadSeeker, size int64) (*Image, error) {
+	buf := slurpPool.Get().(*[]byte)
+	defer func() {
+		if cap(*buf) <= maxPooledSlurp {
+			slurpPool.Put(buf)
+		}
+	}()
+	if cap(*buf) < qoiHeaderSize {
+		*buf = make([]byte, qoiHeaderSize)
+	}
+	data := (*buf)[:qoiHeaderSize]
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("could not read header: %w", truncated(err))
+	}
+	header, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	img, err := dec.newImage(header)
+	if err != nil {
+		return nil, err
+	}
+	numPixels := img.Width * img.Height
+	// No pixel takes more than 5 bytes to encode, and a CRC trailer may follow the end marker. Metadata
+	// chunks following it may be of any size, so the whole input is read when decoding them.
+	maxBodySize := uint64(numPixels)*5 + uint64(len(qoiEnd)) + qoiCRCTrailerSize
+	if uint64(size) > qoiHeaderSize+maxBodySize && dec.metadata == nil || uint64(size) > uint64(maxInt) {
+		d := newBodyDecoder(r, dec.BufferSize)
+		defer d.release()
+		d.start(img.Width, img.Height)
+		if err := dec.decodeBody(d, img.Pix, img.Width, img.Height, int(img.Channels), img.Stride); err != nil {
+			return img, err
+		}
+		// Leave data following the image unread, as when decoding from data read as a whole.
+		if unread := d.buffered(); unread > 0 && !dec.Strict {
+			if _, err := r.Seek(-int64(unread), io.SeekCurrent); err != nil {
+				return img, err
+			}
+		}
+		return img, nil
+	}
+	if uint64(cap(*buf)) < uint64(size) {
+		*buf = make([]byte, size)
+		copy(*buf, data)
+	}
+	data = (*buf)[:size]
+	if _, err := io.ReadFull(r, data[qoiHeaderSize:]); err != nil {
+		return img, truncated(err)
+	}
+	d := newSliceDecoder(data, img.Width, img.Height)
+	if err := dec.decodeBody(d, img.Pix, img.Width, img.Height, int(img.Channels), img.Stride); err != nil {
+		return img, err
+	}
+	if unread := len(data) - d.pos; unread > 0 && !dec.Strict {
+		if _, err := r.Seek(-int64(unread), io.SeekCurrent); err != nil {
+			return img, err
+		}
+	}
+	return img, nil
+}
+
+// newImage allocates the Image dec decodes an image with the given header into.
+func (dec *Decoder) newImage(header Header) (*Image, error) {
+	channels, err := dec.outputChannels(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.checkSize(header, channels); err != nil {
+		return nil, err
+	}
+	size, err := header.pixLen(channels)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{
+		Pix:        make([]uint8, size),
+		Stride:     int(header.width) * int(channels),
+		Rect:       image.Rect(0, 0, int(header.width), int(header.height)),
 		Width:      int(header.width),
 		Height:     int(header.height),
-		Channels:   header.channels,
+		Channels:   channels,
 		Colorspace: header.colorspace,
+	}, nil
+}
+
+// checkSize returns an error if decoding an image with the given header into the given amount of channels
+// would exceed dec.MaxBytes.
+func (dec *Decoder) checkSize(header Header, channels uint8) error {
+	size := uint64(header.width) * uint64(header.height) * uint64(channels)
+	if dec.MaxBytes > 0 && size > uint64(dec.MaxBytes) {
+		return fmt.Errorf("%w: %dx%d with %d channels exceeds limit of %d bytes", ErrTooLarge, header.width, header.height, channels, dec.MaxBytes)
+	}
+	return nil
+}
+
+// outputChannels returns the amount of channels dec decodes an image with the given header into.
+func (dec *Decoder) outputChannels(header Header) (uint8, error) {
+	if dec.VerifyCRC && dec.Channels == 3 && !dec.CompositeAlpha && header.channels == 4 {
+		return 0, fmt.Errorf("cannot verify CRC of a 4-channel image decoded into 3 channels")
+	}
+	switch dec.Channels {
+	case 0:
+		return header.channels, nil
+	case 3, 4:
+		return dec.Channels, nil
 	}
-	return img, decodeBody(reader, pix, int(img.Channels), img.Width*int(img.Channels))
+	return 0, fmt.Errorf("invalid amount of output channels %d: must be 0, 3 or 4", dec.Channels)
 }
 
-func decodeBody(r io.Reader, dest []uint8, bytesPerPixel int, stride int) (err error) {
-	in := bufio.NewReaderSize(r, 250)
-	numPixels := len(dest) / bytesPerPixel
+// decodeBody decodes width*height pixels from d into dest, each bytesPerPixel bytes long, with rows
+// placed stride bytes apart.
+func (dec *Decoder) decodeBody(d rowDecoder, dest []uint8, width, height, bytesPerPixel, stride int) error {
+	rowSize := width * bytesPerPixel
+	rowAt := func(y int) []byte {
+		return dest[y*stride : y*stride+rowSize]
+	}
+	err := dec.decodeRows(d, height, bytesPerPixel, rowAt, nil)
+	if err != nil && dec.Salvage && errors.Is(err, ErrTruncated) {
+		dec.salvage(d.decodedPixels(), width, height, bytesPerPixel, rowAt)
+	}
+	return err
+}
 
-	var b1, b2 byte
+// salvage completes the rows of an image of which only the given amount of pixels were decoded, by
+// transforming the decoded part of the incomplete row and setting all pixels after it to dec.SalvageColor.
+func (dec *Decoder) salvage(decoded, width, height, bytesPerPixel int, rowAt func(y int) []byte) {
+	c := dec.SalvageColor
+	fill := []byte{c.R, c.G, c.B, c.A}
+	if dec.composites(bytesPerPixel) {
+		compositeRow(fill, fill, dec.Background)
+	}
+	fill = fill[:bytesPerPixel]
+	dec.transformRow(fill, bytesPerPixel)
+	for y := decoded / width; y < height; y++ {
+		row := rowAt(dec.destRow(y, height))
+		x := 0
+		if y == decoded/width {
+			x = decoded % width
+			dec.transformRow(row[:x*bytesPerPixel], bytesPerPixel)
+		}
+		for ; x < width; x++ {
+			copy(row[x*bytesPerPixel:], fill)
+		}
+	}
+}
+
+// decodeRows decodes height rows of pixels from d, each bytesPerPixel bytes long. The pixels of output row y
+// are decoded into rowAt(y). If done is not nil, it is called with each row once it is complete.
+func (dec *Decoder) decodeRows(d rowDecoder, height, bytesPerPixel int, rowAt func(y int) []byte, done func(y int, row []byte) error) error {
+	var sum *pixelSum
+	if dec.VerifyCRC {
+		sum = new(pixelSum)
+	}
+	var wide []byte
+	for y := 0; y < height; y++ {
+		destY := dec.destRow(y, height)
+		row := rowAt(destY)
+		if dec.composites(bytesPerPixel) {
+			// Decode with alpha, then composite into row.
+			if wide == nil {
+				wide = make([]byte, len(row)/3*4)
+			}
+			err := d.decodeRow(wide, 4)
+			compositeRow(row, wide, dec.Background)
+			if err != nil {
+				return err
+			}
+			if sum != nil {
+				sum.addRow(wide, 4, false)
+			}
+		} else {
+			if err := d.decodeRow(row, bytesPerPixel); err != nil {
+				return err
+			}
+			if sum != nil {
+				sum.addRow(row, bytesPerPixel, false)
+			}
+		}
+		dec.transformRow(row, bytesPerPixel)
+		if done != nil {
+			if err := done(destY, row); err != nil {
+				return err
+			}
+		}
+	}
+	if dec.Strict {
+		if err := d.verifyRun(); err != nil {
+			return err
+		}
+	}
+	if dec.Strict || dec.concatenated || dec.VerifyCRC || dec.metadata != nil {
+		if err := d.readEnd(); err != nil {
+			return err
+		}
+	}
+	if sum != nil || dec.metadata != nil {
+		// Metadata chunks follow the CRC trailer, so it needs to be consumed even if it is not verified.
+		trailer, err := d.readTrailer()
+		if err != nil {
+			return err
+		}
+		if trailer != nil && sum != nil {
+			if err := sum.verify(trailer); err != nil {
+				return err
+			}
+		}
+	}
+	if dec.metadata != nil {
+		if err := d.readChunks(dec.metadata, dec.Strict); err != nil {
+			return err
+		}
+	}
+	if dec.Strict && !dec.concatenated {
+		return d.verifyEOF()
+	}
+	return nil
+}
 
-	var index [64]pixel
+// composites reports whether dec composites pixels over dec.Background when decoding into the given amount
+// of bytes per pixel.
+func (dec *Decoder) composites(bytesPerPixel int) bool {
+	return dec.CompositeAlpha && bytesPerPixel == 3
+}
 
-	run := 0
-	numDecodedPixels := 0
+// transformRow applies the pixel transformations configured in dec to a freshly decoded row.
+func (dec *Decoder) transformRow(row []byte, bytesPerPixel int) {
+	if dec.ColorTransformer != nil {
+		dec.ColorTransformer.TransformRow(row, bytesPerPixel)
+	}
+	if table := gammaTable(dec.Gamma); table != nil {
+		applyTable(row, bytesPerPixel, table)
+	}
+	if dec.BGRA {
+		swapRB(row, bytesPerPixel)
+	}
+	if dec.swizzlesRows() {
+		perm, _ := swizzlePerm(dec.Swizzle, bytesPerPixel)
+		swizzleRow(row, bytesPerPixel, perm)
+	}
+}
 
-	px := pixel{0, 0, 0, 255}
-	for numDecodedPixels < numPixels {
+// postprocess applies the conversions configured in dec to the decoded img, if not nil. Alpha is
+// premultiplied after converting the colorspace, as the transfer functions apply to non-premultiplied
+// colors.
+func (dec *Decoder) postprocess(img *Image) {
+	if img == nil {
+		return
+	}
+	if dec.ConvertColorspace {
+		ConvertColorspace(img, dec.Colorspace)
+	}
+	if dec.Premultiply {
+		img.Premultiply()
+	}
+	if dec.Swizzle != "" && !dec.swizzlesRows() {
+		swizzleImage(img, dec.Swizzle)
+	}
+}
+
+// rowConversion returns a function converting the rows of an image in the given colorspace, each decoded and
+// transformed into bytesPerPixel bytes per pixel, like postprocess converts the whole image, or nil if dec
+// is not set to convert them.
+func (dec *Decoder) rowConversion(colorspace Colorspace, bytesPerPixel int) func(row []byte) {
+	var table *[256]uint8
+	if dec.ConvertColorspace {
+		table = colorspaceTable(colorspace, dec.Colorspace)
+	}
+	premultiply := dec.Premultiply && bytesPerPixel == 4
+	swizzle := dec.Swizzle != "" && !dec.swizzlesRows()
+	if table == nil && !premultiply && !swizzle {
+		return nil
+	}
+	perm, _ := swizzlePerm(dec.Swizzle, bytesPerPixel)
+	return func(row []byte) {
+		if table != nil {
+			applyTable(row, bytesPerPixel, table)
+		}
+		if premultiply {
+			premultiplyRow(row)
+		}
+		if swizzle {
+			swizzleRow(row, bytesPerPixel, perm)
+		}
+	}
+}
+
+// destRow returns the row of the output the y-th decoded row of an image of the given height belongs to.
+func (dec *Decoder) destRow(y, height int) int {
+	if dec.FlipVertical {
+		return height - 1 - y
+	}
+	return y
+}
+
+// rowDecoder decodes the body of a QOI image one row at a time.
+type rowDecoder interface {
+	// decodeRow decodes the next len(row)/bytesPerPixel pixels into row.
+	decodeRow(row []byte, bytesPerPixel int) error
+	// verifyRun returns an error if the last RUN op extends past the last pixel.
+	verifyRun() error
+	// readEnd consumes the end marker following the last pixel and returns an error if it is bad or missing.
+	readEnd() error
+	// verifyEOF consumes the remainder of the input and returns an error if there is any.
+	verifyEOF() error
+	// readTrailer consumes the CRC trailer following the end marker and returns it, or nil if there is none.
+	readTrailer() ([]byte, error)
+	// readChunks consumes the metadata chunks following the end marker and CRC trailer, storing them in m.
+	// If strict is set, it returns an error if they are followed by data too short to be another chunk.
+	readChunks(m *Metadata, strict bool) error
+	// decodedPixels returns the amount of pixels decoded so far.
+	decodedPixels() int
+}
+
+// opState is the state of the op stream decoder carried from one pixel to the next.
+type opState struct {
+	index [64]pixel
+	px    pixel
+	run   int
+
+	// runOp and runOffset are the most recent RUN op and its offset in the QOI stream.
+	runOp     byte
+	runOffset int64
+
+	// lastOp and lastOpOffset are the most recent op and its offset in the QOI stream, reported when the
+	// stream is truncated. An offset of 0 means no op was read yet.
+	lastOp       byte
+	lastOpOffset int64
+
+	width            int
+	numPixels        int
+	numDecodedPixels int
+}
+
+func newOpState(width, height int) opState {
+	return opState{px: pixel{0, 0, 0, 255}, width: width, numPixels: width * height}
+}
+
+// truncatedAt returns an ErrTruncated error for a stream ending at the given offset, locating where decoding
+// stopped.
+func (s *opState) truncatedAt(offset int64) error {
+	var lastOp string
+	if s.lastOpOffset > 0 {
+		lastOp = fmt.Sprintf(", last op 0x%02x at offset %d", s.lastOp, s.lastOpOffset)
+	}
+	return fmt.Errorf("%w: unexpected EOF at offset %d in row %d, column %d after %d pixels: expected %d%s",
+		ErrTruncated, offset, s.numDecodedPixels/s.width, s.numDecodedPixels%s.width, s.numDecodedPixels, s.numPixels, lastOp)
+}
+
+func (s *opState) decodedPixels() int {
+	return s.numDecodedPixels
+}
+
+func (s *opState) verifyRun() error {
+	if s.run > 0 {
+		return fmt.Errorf("RUN op 0x%02x at offset %d extends %d pixels past the end of the image", s.runOp, s.runOffset, s.run)
+	}
+	return nil
+}
+
+// byteReader is implemented by buffered readers such as *bufio.Reader and *bytes.Reader.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// bodyDecoder is a rowDecoder reading the body from an io.Reader.
+type bodyDecoder struct {
+	in byteReader
+	// offset is the offset in the QOI stream of the next byte to read from in.
+	offset int64
+	opState
+
+	// buf wraps readers which do not implement io.ByteReader. It is kept while the bodyDecoder is pooled.
+	buf *bufio.Reader
+	// ahead wraps in once peek is called if in cannot peek.
+	ahead aheadReader
+	// header and raw receive the header, the channels of RGB and RGBA ops and the end marker read from in,
+	// so that no buffer escapes to the heap on every call.
+	header [qoiHeaderSize]byte
+	raw    [8]byte
+}
+
+var bodyDecoderPool = sync.Pool{
+	New: func() interface{} {
+		return new(bodyDecoder)
+	},
+}
+
+// newBodyDecoder returns a pooled bodyDecoder reading from r, which must be released once decoding is done.
+// Unless r implements io.ByteReader, it is wrapped in a buffer of bufferSize bytes, or of defaultBufferSize
+// bytes if 0. start must be called before decoding any pixels.
+func newBodyDecoder(r io.Reader, bufferSize int) *bodyDecoder {
+	d := bodyDecoderPool.Get().(*bodyDecoder)
+	// Readers which already implement io.ByteReader are used as is, avoiding double buffering. DecodeAll
+	// relies on this so that no data following the end marker is consumed.
+	in, ok := r.(byteReader)
+	if !ok {
+		if bufferSize <= 0 {
+			bufferSize = defaultBufferSize
+		}
+		if d.buf == nil || d.buf.Size() != bufferSize {
+			d.buf = bufio.NewReaderSize(r, bufferSize)
+		} else {
+			d.buf.Reset(r)
+		}
+		in = d.buf
+	}
+	d.in = in
+	d.offset = 0
+	return d
+}
+
+// start prepares d for decoding the pixels of a width*height image from a body starting right after the
+// header.
+func (d *bodyDecoder) start(width, height int) {
+	d.offset = qoiHeaderSize
+	d.opState = newOpState(width, height)
+}
+
+// buffered returns the amount of bytes d read ahead from the reader it was created for without consuming
+// them.
+func (d *bodyDecoder) buffered() int {
+	if d.buf == nil || d.in != byteReader(d.buf) {
+		return 0
+	}
+	return d.buf.Buffered()
+}
+
+// release returns d to the pool. d must not be used afterwards.
+func (d *bodyDecoder) release() {
+	if s, ok := d.ahead.r.(io.Seeker); ok && len(d.ahead.ahead) > 0 {
+		// Leave data following the image unread, as with readers which can peek.
+		s.Seek(-int64(len(d.ahead.ahead)), io.SeekCurrent)
+	}
+	d.ahead = aheadReader{}
+	if d.buf != nil {
+		d.buf.Reset(nil)
+	}
+	d.in = nil
+	bodyDecoderPool.Put(d)
+}
+
+// readHeader is like DecodeHeader, but reads the header through d.
+func (d *bodyDecoder) readHeader() (Header, error) {
+	if _, err := io.ReadFull(d.in, d.header[:]); err != nil {
+		return Header{}, fmt.Errorf("could not read header: %w", truncated(err))
+	}
+	d.offset = qoiHeaderSize
+	return parseHeader(d.header[:])
+}
+
+func (d *bodyDecoder) decodeRow(row []byte, bytesPerPixel int) (err error) {
+	in := d.in
+	var b1, b2 byte
+	px := d.px
+	run := d.run
+	offset := d.offset
+	defer func() {
+		d.px = px
+		d.run = run
+		d.offset = offset
+	}()
+
+	for len(row) >= bytesPerPixel {
 		if run > 0 {
 			run--
 		} else {
 			b1, err = in.ReadByte()
-			if err == io.EOF {
-				return fmt.Errorf("unexpected EOF after %d pixels: expected %d", numDecodedPixels, numPixels)
-			}
 			if err != nil {
-				return err
+				return d.readError(err, offset)
 			}
+			opOffset := offset
+			d.lastOp, d.lastOpOffset = b1, opOffset
+			offset++
 
 			switch {
 			case b1 == qoi_RGB:
-				_, err = io.ReadFull(in, px[:3])
+				n, err := io.ReadFull(in, d.raw[:3])
 				if err != nil {
-					return err
+					return d.readError(err, offset+int64(n))
 				}
+				copy(px[:3], d.raw[:3])
+				offset += 3
 			case b1 == qoi_RGBA:
-				_, err = io.ReadFull(in, px[:])
+				n, err := io.ReadFull(in, d.raw[:4])
 				if err != nil {
-					return err
+					return d.readError(err, offset+int64(n))
 				}
+				copy(px[:], d.raw[:4])
+				offset += 4
 			case b1&qoi_MASK_2 == qoi_INDEX:
-				px = index[b1]
+				px = d.index[b1]
 			case b1&qoi_MASK_2 == qoi_DIFF:
 				px[0] += ((b1 >> 4) & 0x03) - 2
 				px[1] += ((b1 >> 2) & 0x03) - 2
@@ -117,196 +784,726 @@ func decodeBody(r io.Reader, dest []uint8, bytesPerPixel int, stride int) (err e
 			case b1&qoi_MASK_2 == qoi_LUMA:
 				b2, err = in.ReadByte()
 				if err != nil {
-					return err
+					return d.readError(err, offset)
 				}
+				offset++
 				vg := (b1 & 0b00111111) - 32
 				px[0] += vg - 8 + ((b2 >> 4) & 0x0f)
 				px[1] += vg
 				px[2] += vg - 8 + (b2 & 0x0f)
 			case b1&qoi_MASK_2 == qoi_RUN:
 				run = int(b1 & 0b00111111)
+				d.runOp, d.runOffset = b1, opOffset
 			default:
 				px = pixel{255, 0, 255, 255} // should not happen
 			}
 
-			index[int(qoi_COLOR_HASH(px[0], px[1], px[2], px[3]))&0b111111] = px
+			d.index[int(qoi_COLOR_HASH(px[0], px[1], px[2], px[3]))&0b111111] = px
 		}
 
-		copy(dest[:bytesPerPixel], px[:bytesPerPixel])
-		dest = dest[bytesPerPixel:]
-		numDecodedPixels++
+		copy(row[:bytesPerPixel], px[:bytesPerPixel])
+		row = row[bytesPerPixel:]
+		d.numDecodedPixels++
+	}
+	return nil
+}
+
+// readError returns the error to report for err, which occurred while reading the byte at the given offset.
+func (d *bodyDecoder) readError(err error, offset int64) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return d.truncatedAt(offset)
+	}
+	return err
+}
+
+func (d *bodyDecoder) readEnd() error {
+	end := d.raw[:]
+	if _, err := io.ReadFull(d.in, end); err != nil {
+		return fmt.Errorf("could not read end marker: %w", truncated(err))
+	}
+	if !bytes.Equal(end, qoiEnd) {
+		return fmt.Errorf("bad end marker %x", end)
+	}
+	return nil
+}
+
+func (d *bodyDecoder) verifyEOF() error {
+	n, err := io.Copy(io.Discard, d.in)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%d bytes of trailing data after end marker", n)
 	}
 	return nil
 }
 
 // Decode decodes QOI image data from r into dest, until all pixels are written.
-// If dest cannot fit the image, an error is returned.
+// If dest cannot fit the image, an error is returned. Like all decode functions, it rejects images with
+// zero width or height with ErrEmptyImage, as does Encode.
 func DecodeIntoBuffer(r io.Reader, dest []byte) (*Image, error) {
-	header, err := DecodeHeader(r)
+	var dec Decoder
+	return dec.DecodeWithStride(r, dest, 0)
+}
+
+// DecodeIntoBuffer is like the package-level DecodeIntoBuffer, but uses the settings of dec.
+func (dec *Decoder) DecodeIntoBuffer(r io.Reader, dest []byte) (*Image, error) {
+	return dec.DecodeWithStride(r, dest, 0)
+}
+
+// DecodeWithStride is like DecodeIntoBuffer, but places the rows of the image stride bytes apart in dest,
+// leaving the padding after each row untouched. A stride of 0 packs rows tightly. Otherwise, stride must be
+// at least the width of the image times its channels.
+func DecodeWithStride(r io.Reader, dest []byte, stride int) (*Image, error) {
+	var dec Decoder
+	return dec.DecodeWithStride(r, dest, stride)
+}
+
+// DecodeWithStride is like the package-level DecodeWithStride, but uses the settings of dec.
+func (dec *Decoder) DecodeWithStride(r io.Reader, dest []byte, stride int) (*Image, error) {
+	if err := dec.checkConversions(); err != nil {
+		return nil, err
+	}
+	d := newBodyDecoder(r, dec.BufferSize)
+	defer d.release()
+	header, err := d.readHeader()
 	if err != nil {
 		return nil, fmt.Errorf("could not decode header: %w", err)
 	}
-	numPixels := int(header.width * header.height)
-	if numPixels == 0 {
-		return nil, nil
+	channels, err := dec.outputChannels(header)
+	if err != nil {
+		return nil, err
+	}
+	rowSize := uint64(header.width) * uint64(channels)
+	if rowSize > uint64(maxInt) {
+		return nil, fmt.Errorf("%w: rows of %d bytes", ErrTooLarge, rowSize)
 	}
-	bytesPerPixel := int(header.channels)
-	if numPixels*bytesPerPixel > len(dest) {
-		return nil, fmt.Errorf("dest of size %d bytes cannot fit image data totalling %d bytes", len(dest), numPixels*bytesPerPixel)
+	if stride == 0 {
+		stride = int(rowSize)
+	} else if uint64(stride) < rowSize {
+		return nil, fmt.Errorf("stride %d is less than row size of %d bytes", stride, rowSize)
+	}
+	size := uint64(header.height-1)*uint64(stride) + rowSize
+	if size > uint64(len(dest)) {
+		return nil, fmt.Errorf("dest of size %d bytes cannot fit image data totalling %d bytes", len(dest), size)
 	}
 	img := &Image{
-		Pix:        dest[:numPixels*bytesPerPixel],
+		Pix:        dest[:size],
+		Stride:     stride,
+		Rect:       image.Rect(0, 0, int(header.width), int(header.height)),
 		Width:      int(header.width),
 		Height:     int(header.height),
-		Channels:   header.channels,
+		Channels:   channels,
 		Colorspace: header.colorspace,
 	}
-	return img, decodeBody(r, img.Pix, int(img.Channels), img.Width*int(img.Channels))
+	d.start(img.Width, img.Height)
+	err = dec.decodeBody(d, img.Pix, img.Width, img.Height, int(img.Channels), img.Stride)
+	dec.postprocess(img)
+	return img, err
+}
+
+// DecodeAll decodes back-to-back QOI images from r until it is exhausted, e.g. a sequence of concatenated
+// QOI files. Each image must be terminated by its end marker.
+func DecodeAll(r io.Reader) ([]*Image, error) {
+	var dec Decoder
+	return dec.DecodeAll(r)
+}
+
+// DecodeAll is like the package-level DecodeAll, but uses the settings of dec.
+func (dec *Decoder) DecodeAll(r io.Reader) ([]*Image, error) {
+	in := bufio.NewReader(r)
+	all := *dec
+	all.concatenated = true
+	var images []*Image
+	for {
+		if _, err := in.Peek(1); err == io.EOF {
+			return images, nil
+		} else if err != nil {
+			return images, err
+		}
+		img, err := all.Decode(in)
+		if err != nil {
+			return images, fmt.Errorf("image %d: %w", len(images), err)
+		}
+		images = append(images, img)
+	}
+}
+
+// DecodeRows decodes a QOI image from r one row at a time, calling fn with the index and pixels of each row
+// as soon as it is complete, so the image is never held in memory as a whole. The row is reused for the
+// next call and must not be retained by fn. Decoding stops at the first error returned by fn.
+func DecodeRows(r io.Reader, fn func(y int, row []byte) error) error {
+	var dec Decoder
+	return dec.DecodeRows(r, fn)
+}
+
+// DecodeRows is like the package-level DecodeRows, but uses the settings of dec. Setting dec.Channels fixes
+// the layout of the rows passed to fn. If dec.FlipVertical is set, rows are passed bottom-up, with y
+// counting down from the last row.
+func (dec *Decoder) DecodeRows(r io.Reader, fn func(y int, row []byte) error) error {
+	if err := dec.checkConversions(); err != nil {
+		return err
+	}
+	d := newBodyDecoder(r, dec.BufferSize)
+	defer d.release()
+	header, err := d.readHeader()
+	if err != nil {
+		return fmt.Errorf("could not decode header: %w", err)
+	}
+	channels, err := dec.outputChannels(header)
+	if err != nil {
+		return err
+	}
+	if err := dec.checkSize(header, channels); err != nil {
+		return err
+	}
+	if _, err := header.pixLen(channels); err != nil {
+		return err
+	}
+	row := make([]byte, int(header.width)*int(channels))
+	rowAt := func(y int) []byte {
+		return row
+	}
+	if convert := dec.rowConversion(header.colorspace, int(channels)); convert != nil {
+		convertFn := fn
+		fn = func(y int, row []byte) error {
+			convert(row)
+			return convertFn(y, row)
+		}
+	}
+	d.start(int(header.width), int(header.height))
+	return dec.decodeRows(d, int(header.height), int(channels), rowAt, fn)
+}
+
+// CompressionLevel selects the trade-off between encoding speed and output size.
+type CompressionLevel int
+
+const (
+	// DefaultCompression emits the same op sequence as the reference encoder.
+	DefaultCompression CompressionLevel = 0
+	// BestSpeed only emits RUN, RGB and RGBA ops, skipping hash, index and diff computations entirely.
+	BestSpeed CompressionLevel = -1
+	// BestCompression keeps the encoder's index in exact lockstep with the decoder's, which also records
+	// pixels covered by RUN ops. The decoder's state depends only on the pixel sequence and never on the
+	// ops chosen, so picking the shortest op per pixel is already optimal and no lookahead is required.
+	BestCompression CompressionLevel = -2
+)
+
+// Encoder configures encoding of QOI images. The zero value encodes like Encode.
+type Encoder struct {
+	CompressionLevel CompressionLevel
+	// Channels forces the channels stated in the header to 3 or 4. With 3 channels, alpha is dropped. If 0,
+	// 3 channels are used for opaque images and 4 channels otherwise.
+	Channels uint8
+	// CRC appends a trailer holding a CRC-32 of the pixels after the end marker, which Decoder.VerifyCRC
+	// checks. The trailer is not part of the QOI specification, but decoders ignore data following the end
+	// marker unless they are strict about it.
+	CRC bool
+	// Metadata is stored in chunks following the end marker if not nil, which DecodeWithMetadata returns.
+	// Like the CRC trailer, they are not part of the QOI specification.
+	Metadata *Metadata
+	// DeltaFrames makes EncodeAnimation store each frame after the first as its difference to the preceding
+	// frame, like DeltaEncoder, wherever that is smaller than the frame itself.
+	DeltaFrames bool
+	// ConvertColorspace converts the pixels of images from their colorspace to Colorspace while encoding, like
+	// ConvertColorspace does, and states Colorspace in the header. The colorspace of an *Image is its
+	// Colorspace, that of any other image is assumed to be sRGB. Colorspace is ignored without
+	// ConvertColorspace.
+	ConvertColorspace bool
+	Colorspace        Colorspace
+	// Unpremultiply treats the pixels of images as premultiplied and divides their color channels by their
+	// alpha while encoding, like Image.Unpremultiply does. It is meant for images whose color model claims
+	// non-premultiplied colors while holding premultiplied ones, such as an *Image after Premultiply. Images
+	// which state being premultiplied, like *image.RGBA, are always converted and must not be encoded with it.
+	Unpremultiply bool
+	// Dither selects how the 16-bit channels of *image.NRGBA64 and *image.RGBA64 images are reduced to 8 bits.
+	// Dithering avoids the banding plain truncation causes in smooth gradients, at the cost of a larger
+	// output. It does not affect any other images.
+	Dither Dither
+	// CutoutAlpha snaps alpha to 0 or 255 while encoding, like Image.ThresholdAlpha does with AlphaThreshold,
+	// for sprites whose edges are meant to be either opaque or transparent. Besides, it makes runs of
+	// transparent pixels compress better. AlphaThreshold is ignored without CutoutAlpha.
+	CutoutAlpha    bool
+	AlphaThreshold uint8
+	// Gamma adjusts the color channels of pixels while encoding like Decoder.Gamma does. It is applied after
+	// converting their colorspace, so that Decoder.Gamma set to 1/Gamma reverts it, within rounding.
+	Gamma float64
+	// ColorTransformer transforms the colors of pixels while encoding if not nil, after all other
+	// conversions, so that the colors it returns are stored as they are. Rows are passed to it with 4
+	// channels.
+	ColorTransformer ColorTransformer
+	// Swizzle states the order of the channels of the pixels passed to PixelWriter and RowWriter if not empty,
+	// like Decoder.Swizzle does for decoded pixels. It does not affect Encode.
+	Swizzle string
+	// Stats is overwritten with statistics about the ops of each image Encode encodes if not nil, so an
+	// Encoder with Stats must not be used by several goroutines at once. PixelWriter and RowWriter do not
+	// collect statistics.
+	Stats *Stats
 }
 
 // Encode encodes img as a QOI file and writes it to w.
 func Encode(w io.Writer, img image.Image) error {
-	out := bufio.NewWriter(w)
+	var enc Encoder
+	return enc.Encode(w, img)
+}
 
-	minX := img.Bounds().Min.X
-	maxX := img.Bounds().Max.X
-	minY := img.Bounds().Min.Y
-	maxY := img.Bounds().Max.Y
-	width := maxX - minX
-	height := maxY - minY
+// Encode encodes img as a QOI file and writes it to w, using the settings of enc.
+func (enc *Encoder) Encode(w io.Writer, img image.Image) error {
+	out := writerPool.Get().(*bufio.Writer)
+	var sw *statsWriter
+	if enc.Stats != nil {
+		*enc.Stats = Stats{}
+		sw = &statsWriter{w: w}
+		out.Reset(sw)
+	} else {
+		out.Reset(w)
+	}
+	defer func() {
+		out.Reset(nil)
+		writerPool.Put(out)
+	}()
+
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	if err := checkDimensions(width, height); err != nil {
+		return err
+	}
 
-	numPixels := width * height
-	if numPixels == 0 {
-		return errors.New("bad image size 0")
-	} else if numPixels >= qoiPixelsMax {
-		return fmt.Errorf("image must have less than %d pixels total", qoiPixelsMax)
+	var ws io.WriteSeeker
+	var seekable bool
+	var start int64
+	bytesPerPixel := int(enc.Channels)
+	switch enc.Channels {
+	case 3, 4:
+	case 0:
+		// If w is seekable, assume 4 channels and backpatch the header once the body revealed whether the
+		// image is opaque, instead of scanning the whole image for opacity up front.
+		ws, seekable = w.(io.WriteSeeker)
+		if seekable {
+			var err error
+			if start, err = ws.Seek(0, io.SeekCurrent); err != nil {
+				seekable = false
+			}
+		}
+		bytesPerPixel = 4
+		if !seekable && isOpaqueImage(img) {
+			bytesPerPixel--
+		}
+	default:
+		return fmt.Errorf("invalid amount of channels %d: must be 0, 3 or 4", enc.Channels)
+	}
+	colorspace := SRGB
+	if qimg, ok := img.(*Image); ok {
+		colorspace = qimg.Colorspace
+	}
+	var table *[256]uint8
+	if enc.ConvertColorspace {
+		if err := checkColorspace(enc.Colorspace); err != nil {
+			return err
+		}
+		table = colorspaceTable(colorspace, enc.Colorspace)
+		colorspace = enc.Colorspace
 	}
-	bytesPerPixel := 3
-	if !isOpaqueImage(img) {
-		bytesPerPixel++
+	if err := checkGamma(enc.Gamma); err != nil {
+		return err
 	}
 
-	// write header to output
-	if err := binary.Write(out, binary.BigEndian, []byte(qoiMagic)); err != nil {
+	if err := encodeHeader(out, width, height, bytesPerPixel, colorspace); err != nil {
 		return err
 	}
-	// width
-	if err := binary.Write(out, binary.BigEndian, uint32(width)); err != nil {
+
+	var sum *pixelSum
+	if enc.CRC {
+		sum = new(pixelSum)
+	}
+	options := enc.options()
+	options.stats = enc.Stats
+	e := newOpEncoder(out, width, options, sum)
+	rowAt := ditheredRows(img, enc.Dither)
+	if rowAt == nil {
+		rowAt = pixelRows(img)
+	}
+	gamma := gammaTable(enc.Gamma)
+	var converted []byte
+	if table != nil || gamma != nil || enc.Unpremultiply || enc.CutoutAlpha || enc.ColorTransformer != nil {
+		converted = make([]byte, width*4)
+	}
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		row := rowAt(y)
+		if converted != nil {
+			// The rows of img must not be modified, so they are converted in a copy.
+			copy(converted, row)
+			if enc.Unpremultiply {
+				unpremultiplyRow(converted)
+			}
+			if enc.CutoutAlpha {
+				thresholdAlphaRow(converted, enc.AlphaThreshold)
+			}
+			if table != nil {
+				applyTable(converted, 4, table)
+			}
+			if gamma != nil {
+				applyTable(converted, 4, gamma)
+			}
+			if enc.ColorTransformer != nil {
+				enc.ColorTransformer.TransformRow(converted, 4)
+			}
+			row = converted
+		}
+		e.encodePixels(row, 4)
+	}
+	if err := e.finishImage(); err != nil {
 		return err
 	}
-	// height
-	if err := binary.Write(out, binary.BigEndian, uint32(height)); err != nil {
+	if seekable && e.opaque {
+		bytesPerPixel = 3
+		if err := backpatchHeader(ws, start, 12, []byte{3}); err != nil {
+			return err
+		}
+	}
+	if enc.Stats != nil {
+		enc.Stats.InputBytes = int64(width) * int64(height) * int64(bytesPerPixel)
+		enc.Stats.OutputBytes = sw.n
+	}
+	return nil
+}
+
+// EncodedSize returns the size in bytes of the QOI file Encode writes for img, without keeping the output.
+func EncodedSize(img image.Image) (int64, error) {
+	var enc Encoder
+	return enc.EncodedSize(img)
+}
+
+// EncodedSize is like the package-level EncodedSize, but uses the settings of enc. The image is encoded to
+// count the output, so this is as expensive as calling Encode.
+func (enc *Encoder) EncodedSize(img image.Image) (int64, error) {
+	var c countingWriter
+	err := enc.Encode(&c, img)
+	return c.n, err
+}
+
+// countingWriter discards all data written to it, counting its size.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// checkDimensions returns an error unless an image of the given size can be encoded. Both dimensions are
+// then positive and fit into the uint32 fields of the header.
+func checkDimensions(width, height int) error {
+	if width < 0 || height < 0 {
+		return fmt.Errorf("invalid size %dx%d: must not be negative", width, height)
+	}
+	if width == 0 || height == 0 {
+		return fmt.Errorf("%w: %dx%d", ErrEmptyImage, width, height)
+	}
+	// Multiplying width and height could overflow, so each of them is checked first. Limiting them to less
+	// than qoiPixelsMax also keeps them within uint32.
+	if uint64(width) >= qoiPixelsMax || uint64(height) >= qoiPixelsMax || uint64(width)*uint64(height) >= qoiPixelsMax {
+		return fmt.Errorf("%w: %dx%d image must have less than %d pixels total", ErrTooLarge, width, height, qoiPixelsMax)
+	}
+	return nil
+}
+
+// writerPool holds the buffers Encode writes through, which are reused by subsequent calls.
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriter(nil)
+	},
+}
+
+// backpatchHeader overwrites the bytes at the given offset in the header written at offset start of ws with
+// b, then seeks back to where ws was positioned before.
+func backpatchHeader(ws io.WriteSeeker, start, offset int64, b []byte) error {
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
 		return err
 	}
-	// channels
-	if err := binary.Write(out, binary.BigEndian, uint8(bytesPerPixel)); err != nil {
+	if _, err = ws.Seek(start+offset, io.SeekStart); err != nil {
 		return err
 	}
-	// sRGB with linear alpha
-	if err := binary.Write(out, binary.BigEndian, uint8(0)); err != nil {
+	if _, err = ws.Write(b); err != nil {
 		return err
 	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
 
-	var index [64]pixel
-	px_prev := pixel{0, 0, 0, 255}
-	run := 0
+func encodeHeader(out *bufio.Writer, width, height, bytesPerPixel int, colorspace Colorspace) error {
+	var b [qoiHeaderSize]byte
+	copy(b[:4], qoiMagic)
+	binary.BigEndian.PutUint32(b[4:8], uint32(width))
+	binary.BigEndian.PutUint32(b[8:12], uint32(height))
+	b[12] = uint8(bytesPerPixel)
+	b[13] = uint8(colorspace)
+	_, err := out.Write(b[:])
+	return err
+}
 
-	widthMinusOne := width - 1
-	heightMinusOne := height - 1
-	var px pixel
+// maxOpSize is the size in bytes of the longest op.
+const maxOpSize = 5
 
-	for y := minY; y < maxY; y++ {
-		for x := minX; x < maxX; x++ {
-			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
-			px = pixel{c.R, c.G, c.B, c.A}
+// maxOpsBufferSize limits the size of the buffer an opEncoder collects ops in, so that it cannot overflow
+// int for very wide images.
+const maxOpsBufferSize = 64 << 10
 
-			if px == px_prev {
-				run++
-				last_pixel := x == widthMinusOne && y == heightMinusOne
-				if run == 62 || last_pixel {
-					out.WriteByte(qoi_RUN | byte(run-1))
-					run = 0
-				}
+// opEncoder emits the ops for a sequence of pixels, which may be passed to it in chunks of any size.
+type opEncoder struct {
+	out *bufio.Writer
+
+	index   [64]pixel
+	pxPrev  pixel
+	run     int
+	opaque  bool
+	sum     *pixelSum
+	ops     []byte
+	options opOptions
+}
+
+// opOptions selects the ops emitted by an opEncoder.
+type opOptions struct {
+	// fast only emits RUN, RGB and RGBA ops.
+	fast bool
+	// mirrorIndex adds pixels encoded as part of a run to the index, like the decoder does.
+	mirrorIndex bool
+	// dropAlpha encodes all pixels as opaque.
+	dropAlpha bool
+	// metadata is written as metadata chunks after the image if not nil.
+	metadata *Metadata
+	// stats counts the ops emitted if not nil.
+	stats *Stats
+}
+
+// newOpEncoder returns an opEncoder writing to out, which collects the ops of up to width pixels before
+// writing them at once. If sum is not nil, all pixels are added to it.
+func newOpEncoder(out *bufio.Writer, width int, options opOptions, sum *pixelSum) *opEncoder {
+	opsSize := maxOpsBufferSize
+	if width <= maxOpsBufferSize/maxOpSize {
+		opsSize = width * maxOpSize
+	}
+	return &opEncoder{
+		out:     out,
+		pxPrev:  pixel{0, 0, 0, 255},
+		opaque:  true,
+		sum:     sum,
+		ops:     make([]byte, 0, opsSize),
+		options: options,
+	}
+}
+
+// options returns the opOptions enc encodes with.
+func (enc *Encoder) options() opOptions {
+	return opOptions{
+		fast:        enc.CompressionLevel == BestSpeed,
+		mirrorIndex: enc.CompressionLevel == BestCompression,
+		dropAlpha:   enc.Channels == 3,
+		metadata:    enc.Metadata,
+	}
+}
+
+// encodePixels emits the ops for pixels, each bytesPerPixel bytes long, except for a trailing run, which
+// is only emitted once it ends or by finish.
+func (e *opEncoder) encodePixels(pixels []byte, bytesPerPixel int) {
+	if e.sum != nil {
+		e.sum.addRow(pixels, bytesPerPixel, e.options.dropAlpha)
+	}
+	if e.options.fast {
+		e.encodePixelsFast(pixels, bytesPerPixel)
+		return
+	}
+	ops := e.ops[:0]
+	index := &e.index
+	px_prev := e.pxPrev
+	run := e.run
+	opaque := e.opaque
+	mirrorIndex := e.options.mirrorIndex
+	dropAlpha := e.options.dropAlpha || bytesPerPixel == 3
+
+	px := pixel{0, 0, 0, 255}
+	for i := 0; i+bytesPerPixel <= len(pixels); i += bytesPerPixel {
+		if len(ops) > cap(ops)-maxOpSize {
+			e.write(ops)
+			ops = ops[:0]
+		}
+		copy(px[:], pixels[i:i+bytesPerPixel])
+		if dropAlpha {
+			px[3] = 255
+		}
+		opaque = opaque && px[3] == 255
+
+		if px == px_prev {
+			run++
+			if mirrorIndex {
+				index[qoi_COLOR_HASH(px[0], px[1], px[2], px[3])&0b111111] = px
+			}
+			if run == 62 {
+				ops = append(ops, qoi_RUN|byte(run-1))
+				run = 0
+			}
+		} else {
+			if run > 0 {
+				ops = append(ops, qoi_RUN|byte(run-1))
+				run = 0
+			}
+			var index_pos byte = qoi_COLOR_HASH(px[0], px[1], px[2], px[3]) & 0b111111
+			if index[index_pos] == px {
+				ops = append(ops, qoi_INDEX|index_pos)
 			} else {
-				if run > 0 {
-					out.WriteByte(qoi_RUN | byte(run-1))
-					run = 0
-				}
-				var index_pos byte = qoi_COLOR_HASH(px[0], px[1], px[2], px[3]) & 0b111111
-				if index[index_pos] == px {
-					out.WriteByte(qoi_INDEX | index_pos)
-				} else {
-					index[index_pos] = px
-
-					if px[3] == px_prev[3] {
-						vr := int8(int(px[0]) - int(px_prev[0]))
-						vg := int8(int(px[1]) - int(px_prev[1]))
-						vb := int8(int(px[2]) - int(px_prev[2]))
-
-						vg_r := vr - vg
-						vg_b := vb - vg
-
-						if vr > -3 && vr < 2 && vg > -3 && vg < 2 && vb > -3 && vb < 2 {
-							out.WriteByte(qoi_DIFF | byte((vr+2)<<4|(vg+2)<<2|(vb+2)))
-						} else if vg_r > -9 && vg_r < 8 && vg > -33 && vg < 32 && vg_b > -9 && vg_b < 8 {
-							out.WriteByte(qoi_LUMA | byte(vg+32))
-							out.WriteByte(byte((vg_r+8)<<4) | byte(vg_b+8))
-						} else {
-							out.WriteByte(qoi_RGB)
-							out.WriteByte(px[0])
-							out.WriteByte(px[1])
-							out.WriteByte(px[2])
-						}
+				index[index_pos] = px
+
+				if px[3] == px_prev[3] {
+					vr := int8(int(px[0]) - int(px_prev[0]))
+					vg := int8(int(px[1]) - int(px_prev[1]))
+					vb := int8(int(px[2]) - int(px_prev[2]))
+
+					vg_r := vr - vg
+					vg_b := vb - vg
 
+					if vr > -3 && vr < 2 && vg > -3 && vg < 2 && vb > -3 && vb < 2 {
+						ops = append(ops, qoi_DIFF|byte((vr+2)<<4|(vg+2)<<2|(vb+2)))
+					} else if vg_r > -9 && vg_r < 8 && vg > -33 && vg < 32 && vg_b > -9 && vg_b < 8 {
+						ops = append(ops, qoi_LUMA|byte(vg+32), byte((vg_r+8)<<4)|byte(vg_b+8))
 					} else {
-						out.WriteByte(qoi_RGBA)
-						for i := 0; i < 4; i++ {
-							out.WriteByte(px[i])
-						}
+						ops = append(ops, qoi_RGB, px[0], px[1], px[2])
 					}
 
+				} else {
+					ops = append(ops, qoi_RGBA, px[0], px[1], px[2], px[3])
 				}
-			}
 
-			px_prev = px
+			}
 		}
+
+		px_prev = px
 	}
-	binary.Write(out, binary.BigEndian, uint32(0)) // padding
-	binary.Write(out, binary.BigEndian, uint32(1)) // padding
+	e.write(ops)
+	e.ops = ops
+	e.pxPrev = px_prev
+	e.run = run
+	e.opaque = opaque
+}
+
+// encodePixelsFast is like encodePixels, but only emits RUN, RGB and RGBA ops.
+func (e *opEncoder) encodePixelsFast(pixels []byte, bytesPerPixel int) {
+	ops := e.ops[:0]
+	px_prev := e.pxPrev
+	run := e.run
+	opaque := e.opaque
+	dropAlpha := e.options.dropAlpha || bytesPerPixel == 3
 
-	return out.Flush()
+	px := pixel{0, 0, 0, 255}
+	for i := 0; i+bytesPerPixel <= len(pixels); i += bytesPerPixel {
+		if len(ops) > cap(ops)-maxOpSize {
+			e.write(ops)
+			ops = ops[:0]
+		}
+		copy(px[:], pixels[i:i+bytesPerPixel])
+		if dropAlpha {
+			px[3] = 255
+		}
+		opaque = opaque && px[3] == 255
+
+		if px == px_prev {
+			run++
+			if run == 62 {
+				ops = append(ops, qoi_RUN|byte(run-1))
+				run = 0
+			}
+		} else {
+			if run > 0 {
+				ops = append(ops, qoi_RUN|byte(run-1))
+				run = 0
+			}
+			if px[3] == px_prev[3] {
+				ops = append(ops, qoi_RGB, px[0], px[1], px[2])
+			} else {
+				ops = append(ops, qoi_RGBA, px[0], px[1], px[2], px[3])
+			}
+		}
+
+		px_prev = px
+	}
+	e.write(ops)
+	e.ops = ops
+	e.pxPrev = px_prev
+	e.run = run
+	e.opaque = opaque
 }
 
-// DecodeHeader decodes only the header from the beginning of a QOI image and returns it, if it is valid.
-func DecodeHeader(r io.Reader) (header Header, err error) {
-	err = binary.Read(r, binary.BigEndian, &header.magic)
-	if err != nil {
-		return Header{}, fmt.Errorf("could not read header magic: %w", err)
+// write writes the complete ops of b to the output.
+func (e *opEncoder) write(b []byte) {
+	e.out.Write(b)
+	if e.options.stats != nil {
+		e.options.stats.addOps(b)
 	}
-	err = binary.Read(r, binary.BigEndian, &header.width)
-	if err != nil {
-		return Header{}, fmt.Errorf("could not read width: %w", err)
+}
+
+// finish emits the trailing run, if any. It must be called after the last pixel was passed to
+// encodePixels.
+func (e *opEncoder) finish() {
+	if e.run > 0 {
+		e.write([]byte{qoi_RUN | byte(e.run-1)})
+		e.run = 0
 	}
-	err = binary.Read(r, binary.BigEndian, &header.height)
-	if err != nil {
-		return Header{}, fmt.Errorf("could not read height: %w", err)
+}
+
+// finishImage emits the trailing run, the end marker, the CRC trailer if e sums up the pixels and the
+// metadata chunks, then flushes the output.
+func (e *opEncoder) finishImage() error {
+	e.finish()
+	e.out.Write(qoiEnd)
+	if e.sum != nil {
+		var trailer [qoiCRCTrailerSize]byte
+		e.out.Write(e.sum.appendTrailer(trailer[:0]))
 	}
-	err = binary.Read(r, binary.BigEndian, &header.channels)
-	if err != nil {
-		return Header{}, fmt.Errorf("could not read channels: %w", err)
+	if err := e.options.metadata.writeChunks(e.out); err != nil {
+		return err
 	}
-	err = binary.Read(r, binary.BigEndian, &header.colorspace)
-	if err != nil {
-		return Header{}, fmt.Errorf("could not read colorspace: %w", err)
+	return e.out.Flush()
+}
+
+// DecodeHeader decodes only the header from the beginning of a QOI image and returns it, if it is valid.
+// Headers stating zero width or height are invalid.
+func DecodeHeader(r io.Reader) (header Header, err error) {
+	var b [qoiHeaderSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return Header{}, fmt.Errorf("could not read header: %w", truncated(err))
 	}
+	return parseHeader(b[:])
+}
+
+// parseHeader decodes the header from the first qoiHeaderSize bytes of b and returns it, if it is valid.
+func parseHeader(b []byte) (header Header, err error) {
+	copy(header.magic[:], b[:4])
+	header.width = binary.BigEndian.Uint32(b[4:8])
+	header.height = binary.BigEndian.Uint32(b[8:12])
+	header.channels = b[12]
+	header.colorspace = Colorspace(b[13])
 	if string(header.magic[:4]) != qoiMagic {
-		return Header{}, fmt.Errorf("bad magic")
+		return Header{}, ErrBadMagic
 	}
 	if header.channels < 3 || header.channels > 4 {
-		return Header{}, fmt.Errorf("invalid amount of channels %d: must be 3 or 4", header.channels)
+		return Header{}, fmt.Errorf("%w %d: must be 3 or 4", ErrInvalidChannels, header.channels)
 	}
 	if header.colorspace != SRGB && header.colorspace != Linear {
-		return Header{}, fmt.Errorf("invalid colorspace %d: must be 0 (sRGB) or 1 (linear RGB)", header.colorspace)
+		return Header{}, fmt.Errorf("%w %d: must be 0 (sRGB) or 1 (linear RGB)", ErrInvalidColorspace, header.colorspace)
+	}
+	if header.width == 0 || header.height == 0 {
+		return Header{}, fmt.Errorf("%w: %dx%d", ErrEmptyImage, header.width, header.height)
 	}
 	return header, nil
 }
+
+// PeekHeader is like DecodeHeader, but does not consume the header from r, so r can be passed on to any
+// decode function afterwards.
+func PeekHeader(r *bufio.Reader) (Header, error) {
+	b, err := r.Peek(qoiHeaderSize)
+	if err != nil {
+		return Header{}, fmt.Errorf("could not peek header: %w", truncated(err))
+	}
+	return parseHeader(b)
+}
@@ -0,0 +1,286 @@
+// Package qoi16 implements QOI16, a non-standard extension of QOI to 16 bits per channel. Files start with
+// the magic "qo16" instead of "qoif", so standard QOI decoders reject them instead of misinterpreting them.
+//
+// The format mirrors QOI: the 14-byte header has the same layout, ops hash pixels into an index of 64
+// entries the same way, and files end with the same end marker. Channels are big-endian uint16 values, and
+// the ops are widened to the larger range of values:
+//
+//	INDEX  0b00iiiiii                              index position i
+//	DIFF   0b01gggggg rrrrbbbb                     dg in -32..31, dr-dg and db-dg in -8..7
+//	LUMA   0b10gggggg ggggrrrr rrbbbbbb            dg in -512..511, dr-dg and db-dg in -32..31
+//	RUN    0b11llllll                              run of l+1 pixels, l in 0..61
+//	RGB    0b11111110 r r g g b b                  full red, green and blue values
+//	RGBA   0b11111111 r r g g b b a a              full red, green, blue and alpha values
+//
+// Differences are computed modulo 65536 and stored with a bias, like in QOI. DIFF and LUMA ops keep the
+// alpha of the previous pixel.
+package qoi16
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/internal/ext"
+)
+
+const (
+	magic = "qo16"
+
+	opIndex = 0x00
+	opDiff  = 0x40
+	opLuma  = 0x80
+	opRun   = 0xc0
+	opRGB   = 0xfe
+	opRGBA  = 0xff
+	mask2   = 0xc0
+)
+
+// ErrBadMagic is returned when data does not start with the QOI16 magic bytes.
+var ErrBadMagic = errors.New("bad QOI16 magic")
+
+func init() {
+	image.RegisterFormat("qoi16", magic, func(r io.Reader) (image.Image, error) { return Decode(r) }, DecodeConfig)
+}
+
+type pixel [4]uint16
+
+func hash(px pixel) int {
+	return int(px[0]*3+px[1]*5+px[2]*7+px[3]*11) & 63
+}
+
+// Encode encodes img as a QOI16 file and writes it to w. Images whose pixels are all opaque are stored
+// with 3 channels, others with 4. The colorspace of a *qoi.Image is preserved, others are stored as sRGB.
+func Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if err := ext.CheckSize(width, height); err != nil {
+		return err
+	}
+	rowAt := pixelRows(img)
+	channels := byte(3)
+	for y := bounds.Min.Y; y < bounds.Max.Y && channels == 3; y++ {
+		for _, px := range rowAt(y) {
+			if px[3] != 0xffff {
+				channels = 4
+				break
+			}
+		}
+	}
+	colorspace := qoi.SRGB
+	if qimg, ok := img.(*qoi.Image); ok {
+		colorspace = qimg.Colorspace
+	}
+
+	out := bufio.NewWriter(w)
+	ext.WriteHeader(out, magic, ext.Header{Width: width, Height: height, Channels: channels, Colorspace: colorspace})
+
+	var index [64]pixel
+	prev := pixel{0, 0, 0, 0xffff}
+	run := 0
+	var op [9]byte
+	flushRun := func() {
+		if run > 0 {
+			out.WriteByte(opRun | byte(run-1))
+			run = 0
+		}
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for _, px := range rowAt(y) {
+			if px == prev {
+				run++
+				if run == 62 {
+					flushRun()
+				}
+				continue
+			}
+			flushRun()
+			h := hash(px)
+			switch {
+			case index[h] == px:
+				out.WriteByte(opIndex | byte(h))
+			case px[3] != prev[3]:
+				op[0] = opRGBA
+				for c := 0; c < 4; c++ {
+					binary.BigEndian.PutUint16(op[1+c*2:], px[c])
+				}
+				out.Write(op[:9])
+			default:
+				dr := int16(px[0] - prev[0])
+				dg := int16(px[1] - prev[1])
+				db := int16(px[2] - prev[2])
+				drdg, dbdg := dr-dg, db-dg
+				switch {
+				case dg >= -32 && dg <= 31 && drdg >= -8 && drdg <= 7 && dbdg >= -8 && dbdg <= 7:
+					out.WriteByte(opDiff | byte(dg+32))
+					out.WriteByte(byte(drdg+8)<<4 | byte(dbdg+8))
+				case dg >= -512 && dg <= 511 && drdg >= -32 && drdg <= 31 && dbdg >= -32 && dbdg <= 31:
+					g, r, b := uint32(dg+512), uint32(drdg+32), uint32(dbdg+32)
+					v := g<<12 | r<<6 | b
+					out.WriteByte(opLuma | byte(v>>16))
+					out.WriteByte(byte(v >> 8))
+					out.WriteByte(byte(v))
+				default:
+					op[0] = opRGB
+					for c := 0; c < 3; c++ {
+						binary.BigEndian.PutUint16(op[1+c*2:], px[c])
+					}
+					out.Write(op[:7])
+				}
+			}
+			index[h] = px
+			prev = px
+		}
+	}
+	flushRun()
+	out.Write(ext.EndMarker)
+	return out.Flush()
+}
+
+// pixelRows returns a function returning the pixels of row y of img as non-premultiplied 16-bit values.
+// The returned slice is reused between calls.
+func pixelRows(img image.Image) func(y int) []pixel {
+	bounds := img.Bounds()
+	row := make([]pixel, bounds.Dx())
+	if img, ok := img.(*image.NRGBA64); ok {
+		return func(y int) []pixel {
+			i := img.PixOffset(bounds.Min.X, y)
+			for x := range row {
+				p := img.Pix[i+x*8 : i+x*8+8]
+				row[x] = pixel{
+					uint16(p[0])<<8 | uint16(p[1]), uint16(p[2])<<8 | uint16(p[3]),
+					uint16(p[4])<<8 | uint16(p[5]), uint16(p[6])<<8 | uint16(p[7]),
+				}
+			}
+			return row
+		}
+	}
+	return func(y int) []pixel {
+		for x := range row {
+			c := img.At(bounds.Min.X+x, y)
+			// Widen 8-bit non-premultiplied colors directly, as converting them through premultiplied
+			// values would lose precision for translucent colors.
+			if n, ok := c.(color.NRGBA); ok {
+				row[x] = pixel{uint16(n.R) * 0x101, uint16(n.G) * 0x101, uint16(n.B) * 0x101, uint16(n.A) * 0x101}
+				continue
+			}
+			n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+			row[x] = pixel{n.R, n.G, n.B, n.A}
+		}
+		return row
+	}
+}
+
+// DecodeConfig returns the color model and dimensions of a QOI16 image without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	header, err := ext.ReadHeader(r, magic, ErrBadMagic, 3, 4)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBA64Model, Width: header.Width, Height: header.Height}, nil
+}
+
+// Decoder decodes QOI16 images with the given settings. Its zero value decodes like Decode.
+type Decoder struct {
+	// MaxBytes limits the size in bytes of the pixel data of images to decode, 8 bytes per pixel, so that
+	// hostile headers cannot cause huge allocations. Images exceeding it are rejected with qoi.ErrTooLarge
+	// before any pixel data is read. If 0, the size is not limited.
+	MaxBytes int
+}
+
+// Decode decodes a QOI16 image from r into a new *image.NRGBA64. Images with 3 channels are decoded as
+// opaque.
+func Decode(r io.Reader) (*image.NRGBA64, error) {
+	var dec Decoder
+	return dec.Decode(r)
+}
+
+// Decode is like the package-level Decode, but uses the settings of dec.
+func (dec *Decoder) Decode(r io.Reader) (*image.NRGBA64, error) {
+	header, err := ext.ReadHeader(r, magic, ErrBadMagic, 3, 4)
+	if err != nil {
+		return nil, err
+	}
+	if err := ext.CheckBytes(header, 8, dec.MaxBytes); err != nil {
+		return nil, err
+	}
+	in, ok := r.(io.ByteReader)
+	if !ok {
+		in = bufio.NewReader(r)
+	}
+	img := image.NewNRGBA64(image.Rect(0, 0, header.Width, header.Height))
+	var index [64]pixel
+	px := pixel{0, 0, 0, 0xffff}
+	run := 0
+	var raw [8]byte
+	readRaw := func(n int) error {
+		for i := 0; i < n; i++ {
+			b, err := in.ReadByte()
+			if err != nil {
+				return err
+			}
+			raw[i] = b
+		}
+		return nil
+	}
+	for i := 0; i < len(img.Pix); i += 8 {
+		if run > 0 {
+			run--
+		} else {
+			b1, err := in.ReadByte()
+			if err != nil {
+				return nil, ext.PixelError(err, i/8)
+			}
+			switch {
+			case b1 == opRGB:
+				if err := readRaw(6); err != nil {
+					return nil, ext.PixelError(err, i/8)
+				}
+				for c := 0; c < 3; c++ {
+					px[c] = binary.BigEndian.Uint16(raw[c*2:])
+				}
+			case b1 == opRGBA:
+				if err := readRaw(8); err != nil {
+					return nil, ext.PixelError(err, i/8)
+				}
+				for c := 0; c < 4; c++ {
+					px[c] = binary.BigEndian.Uint16(raw[c*2:])
+				}
+			case b1&mask2 == opIndex:
+				px = index[b1]
+			case b1&mask2 == opDiff:
+				if err := readRaw(1); err != nil {
+					return nil, ext.PixelError(err, i/8)
+				}
+				dg := uint16(b1&0x3f) - 32
+				px[0] += dg + uint16(raw[0]>>4) - 8
+				px[1] += dg
+				px[2] += dg + uint16(raw[0]&0x0f) - 8
+			case b1&mask2 == opLuma:
+				if err := readRaw(2); err != nil {
+					return nil, ext.PixelError(err, i/8)
+				}
+				v := uint32(b1&0x3f)<<16 | uint32(raw[0])<<8 | uint32(raw[1])
+				dg := uint16(v>>12) - 512
+				px[0] += dg + uint16(v>>6&0x3f) - 32
+				px[1] += dg
+				px[2] += dg + uint16(v&0x3f) - 32
+			default:
+				run = int(b1 & 0x3f)
+			}
+			index[hash(px)] = px
+		}
+		p := img.Pix[i : i+8]
+		for c := 0; c < 4; c++ {
+			binary.BigEndian.PutUint16(p[c*2:], px[c])
+		}
+	}
+	if err := ext.ReadEnd(in); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,104 @@
+package qoi16_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoi16"
+)
+
+// randomImage returns an image mixing smooth gradients, which exercise DIFF and LUMA ops, with runs, noise
+// and, unless opaque, changes in alpha.
+func randomImage(rng *rand.Rand, width, height int, opaque bool) *image.NRGBA64 {
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	c := color.NRGBA64{R: 1000, G: 30000, B: 60000, A: 0xffff}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch rng.Intn(6) {
+			case 0:
+				c.R, c.G, c.B = uint16(rng.Intn(1<<16)), uint16(rng.Intn(1<<16)), uint16(rng.Intn(1<<16))
+			case 1:
+				d := uint16(rng.Intn(64))
+				c.R, c.G, c.B = c.R+d, c.G+d-3, c.B+d+5
+			case 2:
+				c.R, c.G, c.B = c.R+uint16(rng.Intn(800)), c.G-uint16(rng.Intn(800)), c.B+1
+			case 3:
+				if !opaque {
+					c.A = uint16(rng.Intn(1 << 16))
+				}
+			}
+			img.SetNRGBA64(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, opaque := range []bool{true, false} {
+		img := randomImage(rng, 97, 61, opaque)
+		out := bytes.NewBuffer(nil)
+		if err := qoi16.Encode(out, img); err != nil {
+			t.Fatal(err)
+		}
+		data := out.Bytes()
+		if channels := data[12]; opaque != (channels == 3) {
+			t.Fatalf("opaque %v: got %d channels", opaque, channels)
+		}
+		decoded, err := qoi16.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Pix, img.Pix) {
+			t.Fatalf("opaque %v: decoded pixels differ", opaque)
+		}
+		generic, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil || format != "qoi16" {
+			t.Fatalf("expected image.Decode to detect qoi16, got %q, %v", format, err)
+		}
+		if !bytes.Equal(generic.(*image.NRGBA64).Pix, img.Pix) {
+			t.Fatal("pixels decoded through image.Decode differ")
+		}
+		if _, err = qoi16.Decode(bytes.NewReader(data[:len(data)-10])); !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %v, got %v", qoi.ErrTruncated, err)
+		}
+		if _, err = qoi.Decode(bytes.NewReader(data)); !errors.Is(err, qoi.ErrBadMagic) {
+			t.Fatalf("expected standard decoder to reject QOI16 with %v, got %v", qoi.ErrBadMagic, err)
+		}
+		dec := qoi16.Decoder{MaxBytes: len(img.Pix)}
+		if _, err = dec.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatalf("opaque %v: decoding within limit failed: %v", opaque, err)
+		}
+		dec.MaxBytes--
+		if _, err = dec.Decode(bytes.NewReader(data)); !errors.Is(err, qoi.ErrTooLarge) {
+			t.Fatalf("expected %v, got %v", qoi.ErrTooLarge, err)
+		}
+	}
+}
+
+func TestEncodeGeneric(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 4, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 37)
+	}
+	out := bytes.NewBuffer(nil)
+	if err := qoi16.Encode(out, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := qoi16.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if got, want := decoded.NRGBA64At(x, y), color.NRGBA64Model.Convert(img.At(x, y)); got != want {
+				t.Fatalf("pixel at (%d, %d) is %v, expected %v", x, y, got, want)
+			}
+		}
+	}
+}
@@ -1,11 +1,26 @@
 package qoi_test
 
 import (
+	"bufio"
 	"bytes"
+	"encoding"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
 	"image/png"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/Zyl9393/qoi"
 	testdataloader "github.com/peteole/testdata-loader"
@@ -54,6 +69,2867 @@ func TestDecodeWithBuffer(t *testing.T) {
 	}
 }
 
+func TestEncodeBestSpeed(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	enc := qoi.Encoder{CompressionLevel: qoi.BestSpeed}
+	err = enc.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeImg, err := qoi.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeBestCompression(t *testing.T) {
+	// The leading pixel equals the initial previous pixel and is thus encoded as a run.
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{100, 100, 100, 255})
+	img.SetNRGBA(2, 0, color.NRGBA{0, 0, 0, 255})
+	defaultEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(defaultEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bestEncode := bytes.NewBuffer(nil)
+	enc := qoi.Encoder{CompressionLevel: qoi.BestCompression}
+	err = enc.Encode(bestEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bestEncode.Len() >= defaultEncode.Len() {
+		t.Fatalf("BestCompression output of %d bytes is not smaller than default output of %d bytes", bestEncode.Len(), defaultEncode.Len())
+	}
+	decodeImg, err := qoi.Decode(bestEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeDecodeFile(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cyberpanel1.qoi")
+	err = qoi.EncodeFile(path, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeImg, err := qoi.DecodeFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New files get the mode os.Create gives them, replaced files keep theirs.
+	created, err := os.Create(filepath.Join(filepath.Dir(path), "created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Close()
+	want, err := os.Stat(created.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != want.Mode() {
+		t.Fatalf("expected mode %v of files created by os.Create, got %v", want.Mode(), fi.Mode())
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if err = os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = qoi.EncodeFile(path, img); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode of replaced file to stay -rw-r-----, got %v", fi.Mode())
+	}
+}
+
+func TestPool(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var paths []string
+	var images []image.Image
+	for i := 0; i < 8; i++ {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("%d.qoi", i)))
+		images = append(images, img)
+	}
+	pool := qoi.Pool{Workers: 3}
+	err = pool.EncodeAll(paths, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeImgs, err := pool.DecodeAll(append(paths, filepath.Join(dir, "missing.qoi")))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error for missing file, got %v", err)
+	}
+	for i, decodeImg := range decodeImgs[:len(paths)] {
+		err = imageEquals(decodeImg, img)
+		if err != nil {
+			t.Fatalf("image %d: %v", i, err)
+		}
+	}
+	if decodeImgs[len(paths)] != nil {
+		t.Fatalf("expected no image for missing file")
+	}
+}
+
+// opaqueImage hides the concrete type of an image.Image, so that encoding it takes the generic path.
+type opaqueImage struct {
+	image.Image
+}
+
+// rgba64Image hides the concrete type of an image.RGBA64Image, so that encoding it takes the RGBA64At path.
+type rgba64Image struct {
+	image.RGBA64Image
+}
+
+func TestEncodeImageTypes(t *testing.T) {
+	rect := image.Rect(1, 2, 9, 7)
+	fill := func(pix []byte) {
+		for i := range pix {
+			pix[i] = byte(i * 37 / 5)
+		}
+	}
+	nrgba := image.NewNRGBA(rect)
+	fill(nrgba.Pix)
+	rgba := image.NewRGBA(rect)
+	fill(rgba.Pix)
+	nrgba64 := image.NewNRGBA64(rect)
+	fill(nrgba64.Pix)
+	rgba64 := image.NewRGBA64(rect)
+	fill(rgba64.Pix)
+	gray := image.NewGray(rect)
+	fill(gray.Pix)
+	cmyk := image.NewCMYK(rect)
+	fill(cmyk.Pix)
+	paletted := image.NewPaletted(rect, color.Palette{color.NRGBA{1, 2, 3, 4}, color.RGBA{100, 50, 0, 200}, color.Gray{7}})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = byte(i % 3)
+	}
+	rgb := qoi.NewImage(8, 5, 3, qoi.SRGB)
+	fill(rgb.Pix)
+	for _, img := range []image.Image{nrgba, rgba, nrgba64, rgba64, gray, cmyk, paletted, rgb, nrgba.SubImage(image.Rect(2, 3, 5, 6))} {
+		fast := bytes.NewBuffer(nil)
+		err := qoi.Encode(fast, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generic := bytes.NewBuffer(nil)
+		err = qoi.Encode(generic, opaqueImage{img})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(fast.Bytes(), generic.Bytes()) {
+			t.Fatalf("%T: encoding differs from generic path", img)
+		}
+		if rgba64Img, ok := img.(image.RGBA64Image); ok {
+			viaRGBA64 := bytes.NewBuffer(nil)
+			err = qoi.Encode(viaRGBA64, rgba64Image{rgba64Img})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(viaRGBA64.Bytes(), generic.Bytes()) {
+				t.Fatalf("%T: encoding through RGBA64At differs from generic path", img)
+			}
+		}
+	}
+}
+
+func TestEncodeCRC(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 10)
+	}
+	enc := qoi.Encoder{CRC: true}
+	qoiEncode := bytes.NewBuffer(nil)
+	err := enc.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	plainEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(plainEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := append([]byte(nil), qoiContent...)
+	corrupted[16] ^= 1
+	dec := qoi.Decoder{VerifyCRC: true, Strict: true}
+	decoders := map[string]func(data []byte) error{
+		"Decode": func(data []byte) error {
+			_, err := dec.Decode(&countingReader{r: bytes.NewReader(data)})
+			return err
+		},
+		"DecodeBytes": func(data []byte) error {
+			_, err := dec.DecodeBytes(data)
+			return err
+		},
+		"DecodeAll": func(data []byte) error {
+			images, err := dec.DecodeAll(bytes.NewReader(append(append([]byte(nil), data...), data...)))
+			if err == nil && len(images) != 2 {
+				return fmt.Errorf("decoded %d images", len(images))
+			}
+			return err
+		},
+		"StreamDecoder": func(data []byte) error {
+			s := qoi.StreamDecoder{Decoder: dec}
+			for i := range data {
+				if _, err := s.Write(data[i : i+1]); err != nil {
+					return err
+				}
+			}
+			return s.Close()
+		},
+	}
+	for name, decode := range decoders {
+		if err := decode(qoiContent); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := decode(plainEncode.Bytes()); err != nil {
+			t.Errorf("%s: image without trailer: %v", name, err)
+		}
+		if err := decode(corrupted); !errors.Is(err, qoi.ErrChecksum) {
+			t.Errorf("%s: expected %v, got %v", name, qoi.ErrChecksum, err)
+		}
+	}
+	decodeImg, err := qoi.DecodeBytes(qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPixelWriter(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrgba := img.(*image.NRGBA)
+	for _, level := range []qoi.CompressionLevel{qoi.DefaultCompression, qoi.BestSpeed, qoi.BestCompression} {
+		enc := qoi.Encoder{CompressionLevel: level, Channels: 4, CRC: true}
+		want := bytes.NewBuffer(nil)
+		err = enc.Encode(want, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := bytes.NewBuffer(nil)
+		pw, err := enc.NewPixelWriter(got, 128, 128, 4, qoi.SRGB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Split pixels across calls.
+		for pix := nrgba.Pix; len(pix) > 0; {
+			n := 7
+			if n > len(pix) {
+				n = len(pix)
+			}
+			err = pw.WritePixels(pix[:n])
+			if err != nil {
+				t.Fatal(err)
+			}
+			pix = pix[n:]
+		}
+		err = pw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Fatalf("compression level %d: PixelWriter output differs from Encode", level)
+		}
+	}
+	pw, err := qoi.NewPixelWriter(io.Discard, 2, 1, 3, qoi.SRGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pw.WritePixels(make([]byte, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.Close(); err == nil {
+		t.Fatal("expected error for incomplete image")
+	}
+	pw, err = qoi.NewPixelWriter(io.Discard, 2, 1, 3, qoi.SRGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.WritePixels(make([]byte, 9)); err == nil {
+		t.Fatal("expected error for excess pixels")
+	}
+	if closeErr := pw.Close(); closeErr == nil || closeErr.Error() != err.Error() {
+		t.Fatalf("expected Close to report %v, got %v", err, closeErr)
+	}
+	if err = pw.Close(); err == nil {
+		t.Fatal("expected error for closing twice")
+	}
+	pw, err = qoi.NewPixelWriter(io.Discard, 2, 1, 3, qoi.SRGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.WritePixels(make([]byte, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.Close(); err == nil || !strings.Contains(err.Error(), "incomplete pixel") {
+		t.Fatalf("expected error for trailing partial pixel, got %v", err)
+	}
+}
+
+func TestRowWriter(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrgba := img.(*image.NRGBA)
+	enc := qoi.Encoder{Channels: 4}
+	want := bytes.NewBuffer(nil)
+	err = enc.Encode(want, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRows := func(w io.Writer) {
+		rw, err := enc.NewRowWriter(w, 128, 4, qoi.SRGB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 128; y++ {
+			err = rw.WriteRow(nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+128*4])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = rw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	buffered := bytes.NewBuffer(nil)
+	writeRows(buffered)
+	if !bytes.Equal(buffered.Bytes(), want.Bytes()) {
+		t.Fatal("RowWriter output to non-seekable writer differs from Encode")
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "rows.qoi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	writeRows(f)
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, want.Bytes()) {
+		t.Fatal("RowWriter output to seekable writer differs from Encode")
+	}
+	rw, err := qoi.NewRowWriter(io.Discard, 2, 3, qoi.SRGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rw.WriteRow(make([]byte, 5)); err == nil {
+		t.Fatal("expected error for row of wrong size")
+	}
+	if err = rw.Close(); !errors.Is(err, qoi.ErrEmptyImage) {
+		t.Fatalf("expected %v, got %v", qoi.ErrEmptyImage, err)
+	}
+	if err = rw.Close(); err == nil {
+		t.Fatal("expected error for closing twice")
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, enc := range []qoi.Encoder{{}, {CompressionLevel: qoi.BestSpeed, Channels: 3}, {CRC: true}} {
+		out := bytes.NewBuffer(nil)
+		if err = enc.Encode(out, img); err != nil {
+			t.Fatal(err)
+		}
+		size, err := enc.EncodedSize(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != int64(out.Len()) {
+			t.Fatalf("%+v: expected size %d, got %d", enc, out.Len(), size)
+		}
+	}
+}
+
+func TestDeltaEncoder(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := img.(*image.NRGBA)
+	cur := image.NewNRGBA(prev.Bounds())
+	copy(cur.Pix, prev.Pix)
+	draw.Draw(cur, image.Rect(40, 40, 60, 50), image.NewUniform(color.NRGBA{R: 200, G: 10, B: 30, A: 128}), image.Point{}, draw.Src)
+
+	var de qoi.DeltaEncoder
+	full := bytes.NewBuffer(nil)
+	if err = qoi.Encode(full, cur); err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range []*image.NRGBA{cur, prev} {
+		delta := bytes.NewBuffer(nil)
+		if err = de.Encode(delta, prev, frame); err != nil {
+			t.Fatal(err)
+		}
+		if delta.Len() >= full.Len()/10 {
+			t.Fatalf("expected delta to be much smaller than %d bytes, got %d", full.Len(), delta.Len())
+		}
+		decoded, err := qoi.DecodeDelta(delta, prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = imageEquals(decoded, frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = de.Encode(io.Discard, prev, prev.SubImage(image.Rect(0, 0, 10, 10))); err == nil {
+		t.Fatal("expected error for frames of different size")
+	}
+
+	// Alpha is thresholded in the frames, not in their difference, relative to the previous frame as it
+	// decodes.
+	de.Encoder = qoi.Encoder{CutoutAlpha: true, AlphaThreshold: 128}
+	before, after := image.NewNRGBA(image.Rect(0, 0, 2, 1)), image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	copy(before.Pix, []byte{200, 50, 50, 100, 10, 10, 10, 255})
+	copy(after.Pix, []byte{100, 100, 100, 255, 10, 10, 10, 20})
+	delta := bytes.NewBuffer(nil)
+	if err = de.Encode(delta, before, after); err != nil {
+		t.Fatal(err)
+	}
+	decodedBefore := qoi.NewImage(2, 1, 4, qoi.SRGB)
+	copy(decodedBefore.Pix, []byte{0, 0, 0, 0, 10, 10, 10, 255})
+	decoded, err := qoi.DecodeDelta(delta, decodedBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{100, 100, 100, 255, 0, 0, 0, 0}; !bytes.Equal(decoded.Pix, want) {
+		t.Fatalf("expected pixels %v, got %v", want, decoded.Pix)
+	}
+}
+
+func TestDecodeFS(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := bytes.NewBuffer(nil)
+	if err = qoi.Encode(qoiContent, img); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"sprites/a.qoi":   {Data: qoiContent.Bytes()},
+		"sprites/b.qoi":   {Data: qoiContent.Bytes()},
+		"sprites/c.png":   {Data: pngContent},
+		"broken/bad.qoi":  {Data: qoiContent.Bytes()[:100]},
+		"broken/good.qoi": {Data: qoiContent.Bytes()},
+	}
+	decoded, err := qoi.DecodeFS(fsys, "sprites/a.qoi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = imageEquals(decoded, img); err != nil {
+		t.Fatal(err)
+	}
+	images, err := qoi.DecodeAllFS(fsys, "sprites/*.qoi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images["sprites/a.qoi"] == nil || images["sprites/b.qoi"] == nil {
+		t.Fatalf("expected images a.qoi and b.qoi, got %v", images)
+	}
+	_, err = qoi.DecodeAllFS(fsys, "broken/*.qoi")
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "broken/bad.qoi" || !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected truncation error for broken/bad.qoi, got %v", err)
+	}
+	if _, err = qoi.DecodeFS(fsys, "missing.qoi"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := img.(*image.NRGBA).SubImage(image.Rect(10, 20, 42, 44))
+	anim := &qoi.Animation{LoopCount: 2}
+	for i := 0; i < 3; i++ {
+		frame := image.NewNRGBA(image.Rect(0, 0, 32, 24))
+		draw.Draw(frame, frame.Bounds(), img, image.Pt(i*8, i*4), draw.Src)
+		anim.Frames = append(anim.Frames, qoi.Frame{Image: frame, Delay: time.Duration(i+1) * 40 * time.Millisecond})
+	}
+	anim.Frames = append(anim.Frames, qoi.Frame{Image: sub, Delay: time.Second})
+	out := bytes.NewBuffer(nil)
+	if err = qoi.EncodeAnimation(out, anim); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	decoded, err := qoi.DecodeAnimation(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.LoopCount != anim.LoopCount || len(decoded.Frames) != len(anim.Frames) {
+		t.Fatalf("expected %d frames looping %d times, got %d frames looping %d times", len(anim.Frames), anim.LoopCount, len(decoded.Frames), decoded.LoopCount)
+	}
+	for i, frame := range decoded.Frames {
+		if frame.Delay != anim.Frames[i].Delay {
+			t.Fatalf("frame %d: expected delay %v, got %v", i, anim.Frames[i].Delay, frame.Delay)
+		}
+		if equal, at := qoi.ImagesEqual(frame.Image, anim.Frames[i].Image, 0); !equal {
+			t.Fatalf("frame %d: pixel at %v differs", i, at)
+		}
+	}
+
+	dec := qoi.Decoder{Strict: true}
+	if _, err = dec.DecodeAnimation(bytes.NewReader(data)); err != nil {
+		t.Fatalf("strict decoding failed: %v", err)
+	}
+	if _, err = qoi.DecodeAnimation(bytes.NewReader(data[:len(data)-20])); !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected %v, got %v", qoi.ErrTruncated, err)
+	}
+	if _, err = qoi.DecodeAnimation(bytes.NewReader(data[20:])); !errors.Is(err, qoi.ErrBadMagic) {
+		t.Fatalf("expected %v, got %v", qoi.ErrBadMagic, err)
+	}
+	anim.Frames = append(anim.Frames, qoi.Frame{Image: img})
+	if err = qoi.EncodeAnimation(io.Discard, anim); err == nil {
+		t.Fatal("expected error for frames of different size")
+	}
+}
+
+func TestAnimationDeltaFrames(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Frames of a screen capture, each changing a small part of the previous one.
+	anim := &qoi.Animation{}
+	frame := image.NewNRGBA(img.Bounds())
+	draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+	for i := 0; i < 5; i++ {
+		next := image.NewNRGBA(frame.Bounds())
+		copy(next.Pix, frame.Pix)
+		draw.Draw(next, image.Rect(i*10, i*10, i*10+8, i*10+8), image.NewUniform(color.NRGBA{R: uint8(i * 50), G: 99, A: 200}), image.Point{}, draw.Src)
+		anim.Frames = append(anim.Frames, qoi.Frame{Image: next, Delay: 16 * time.Millisecond})
+		frame = next
+	}
+	full, deltas := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	if err = qoi.EncodeAnimation(full, anim); err != nil {
+		t.Fatal(err)
+	}
+	enc := qoi.Encoder{DeltaFrames: true}
+	if err = enc.EncodeAnimation(deltas, anim); err != nil {
+		t.Fatal(err)
+	}
+	if deltas.Len() >= full.Len()/2 {
+		t.Fatalf("expected delta frames to be much smaller than %d bytes, got %d", full.Len(), deltas.Len())
+	}
+	dec := qoi.Decoder{FlipVertical: true, BGRA: true}
+	decoded, err := dec.DecodeAnimation(deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range decoded.Frames {
+		qimg := frame.Image.(*qoi.Image)
+		qimg.FlipVertical()
+		for y := 0; y < qimg.Height; y++ {
+			row := qimg.Pix[qimg.PixOffset(0, y) : qimg.PixOffset(0, y)+qimg.Width*int(qimg.Channels)]
+			for x := 0; x < len(row); x += int(qimg.Channels) {
+				row[x], row[x+2] = row[x+2], row[x]
+			}
+		}
+		if err = imageEquals(qimg, anim.Frames[i].Image); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+
+	// Settings changing pixels apply to the frames, not to their differences, and decoding delta frames
+	// yields what decoding full frames does.
+	for _, enc := range []qoi.Encoder{{Gamma: 2}, {CutoutAlpha: true, AlphaThreshold: 128}} {
+		full.Reset()
+		if err = enc.EncodeAnimation(full, anim); err != nil {
+			t.Fatal(err)
+		}
+		want, err := qoi.DecodeAnimation(bytes.NewReader(full.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.DeltaFrames = true
+		deltas.Reset()
+		if err = enc.EncodeAnimation(deltas, anim); err != nil {
+			t.Fatal(err)
+		}
+		if deltas.Len() >= full.Len()/2 {
+			t.Fatalf("%+v: expected delta frames to be much smaller than %d bytes, got %d", enc, full.Len(), deltas.Len())
+		}
+		decoded, err := qoi.DecodeAnimation(deltas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, frame := range decoded.Frames {
+			if equal, at := qoi.ImagesEqual(frame.Image, want.Frames[i].Image, 0); !equal {
+				t.Fatalf("%+v: frame %d: pixel at %v differs from full frame", enc, i, at)
+			}
+		}
+	}
+
+	// Frames are transformed as images decoded by Decode are, converting the channels first.
+	dec = qoi.Decoder{Channels: 3, CompositeAlpha: true, Background: color.NRGBA{R: 40, G: 80, B: 120}, Gamma: 2.2, BGRA: true}
+	deltas.Reset()
+	if err = enc.EncodeAnimation(deltas, anim); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = dec.DecodeAnimation(deltas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range decoded.Frames {
+		single := bytes.NewBuffer(nil)
+		if err = qoi.Encode(single, anim.Frames[i].Image); err != nil {
+			t.Fatal(err)
+		}
+		want, err := dec.Decode(single)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equal, at := qoi.ImagesEqual(frame.Image, want, 0); !equal {
+			t.Fatalf("frame %d: pixel at %v differs from frame decoded as image", i, at)
+		}
+	}
+}
+
+func TestGIF(t *testing.T) {
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	pal := color.Palette{color.RGBA{}, red, blue}
+	frame0 := image.NewPaletted(image.Rect(0, 0, 4, 4), pal)
+	for i := range frame0.Pix {
+		frame0.Pix[i] = 1
+	}
+	// frame1 covers the center, drawing one blue pixel and leaving the others transparent.
+	frame1 := image.NewPaletted(image.Rect(1, 1, 3, 3), pal)
+	frame1.SetColorIndex(1, 1, 2)
+	frame2 := image.NewPaletted(image.Rect(0, 0, 1, 1), pal)
+	frame2.SetColorIndex(0, 0, 2)
+	g := &gif.GIF{
+		Image:     []*image.Paletted{frame0, frame1, frame2, frame2},
+		Delay:     []int{10, 20, 30, 40},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		LoopCount: -1,
+		Config:    image.Config{Width: 4, Height: 4},
+	}
+	anim, err := qoi.FromGIF(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Frames) != 4 || anim.LoopCount != -1 || anim.Frames[1].Delay != 200*time.Millisecond {
+		t.Fatalf("unexpected animation %+v", anim)
+	}
+	at := func(frame, x, y int) color.NRGBA {
+		return anim.Frames[frame].Image.(*image.NRGBA).NRGBAAt(x, y)
+	}
+	opaqueRed, opaqueBlue := color.NRGBA{R: 255, A: 255}, color.NRGBA{B: 255, A: 255}
+	if at(1, 1, 1) != opaqueBlue || at(1, 2, 2) != opaqueRed {
+		t.Fatalf("frame 1 not drawn over frame 0: %v, %v", at(1, 1, 1), at(1, 2, 2))
+	}
+	// Disposing frame 1 to the background clears its rectangle before frame 2 is drawn.
+	if at(2, 0, 0) != opaqueBlue || at(2, 2, 2) != (color.NRGBA{}) || at(2, 3, 3) != opaqueRed {
+		t.Fatalf("frame 1 not disposed to background: %v, %v, %v", at(2, 0, 0), at(2, 2, 2), at(2, 3, 3))
+	}
+	// Disposing frame 2 to the previous canvas restores the red pixel under it.
+	for frame := 2; frame < 4; frame++ {
+		if at(frame, 0, 0) != opaqueBlue {
+			t.Fatalf("frame %d: expected blue pixel, got %v", frame, at(frame, 0, 0))
+		}
+	}
+
+	converted, err := qoi.ToGIF(anim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.NewBuffer(nil)
+	if err = gif.EncodeAll(out, converted); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := gif.DecodeAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTripped, err := qoi.FromGIF(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range roundTripped.Frames {
+		if frame.Delay != anim.Frames[i].Delay {
+			t.Fatalf("frame %d: expected delay %v, got %v", i, anim.Frames[i].Delay, frame.Delay)
+		}
+		if equal, at := qoi.ImagesEqual(frame.Image, anim.Frames[i].Image, 0); !equal {
+			t.Fatalf("frame %d: pixel at %v differs after round trip", i, at)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := &qoi.Metadata{
+		ICCProfile: []byte("not really an ICC profile"),
+		EXIF:       []byte("II*\x00"),
+		Comments:   []string{"first", "second"},
+	}
+	for _, crc := range []bool{false, true} {
+		enc := qoi.Encoder{Metadata: metadata, CRC: crc}
+		out := bytes.NewBuffer(nil)
+		if err = enc.Encode(out, img); err != nil {
+			t.Fatal(err)
+		}
+		data := out.Bytes()
+		// Vanilla decoders are unaffected.
+		decoded, err := qoi.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = imageEquals(decoded, img); err != nil {
+			t.Fatal(err)
+		}
+		readers := map[string]func() io.Reader{
+			"sized":    func() io.Reader { return bytes.NewReader(data) },
+			"buffered": func() io.Reader { return bufio.NewReader(bytes.NewReader(data)) },
+			"plain":    func() io.Reader { return &countingReader{r: bytes.NewReader(data)} },
+		}
+		for name, reader := range readers {
+			dec := qoi.Decoder{Strict: true, VerifyCRC: crc}
+			decoded, m, err := dec.DecodeWithMetadata(reader())
+			if err != nil {
+				t.Fatalf("%s, CRC %v: %v", name, crc, err)
+			}
+			if err = imageEquals(decoded, img); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(m.ICCProfile, metadata.ICCProfile) || !bytes.Equal(m.EXIF, metadata.EXIF) || strings.Join(m.Comments, ",") != "first,second" {
+				t.Fatalf("%s, CRC %v: expected metadata %+v, got %+v", name, crc, metadata, m)
+			}
+		}
+		_, _, err = qoi.DecodeWithMetadata(bytes.NewReader(data[:len(data)-3]))
+		if !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %v for truncated chunk, got %v", qoi.ErrTruncated, err)
+		}
+		// Strict decoding rejects data too short to be a chunk following the last one.
+		short := append(append([]byte(nil), data...), "qt"...)
+		for name, reader := range map[string]io.Reader{"sized": bytes.NewReader(short), "plain": &countingReader{r: bytes.NewReader(short)}} {
+			dec := qoi.Decoder{Strict: true}
+			if _, _, err = dec.DecodeWithMetadata(reader); err == nil || !strings.Contains(err.Error(), "too short for a metadata chunk") {
+				t.Fatalf("%s, CRC %v: expected error for trailing data too short for a chunk, got %v", name, crc, err)
+			}
+		}
+		if _, _, err = qoi.DecodeWithMetadata(bytes.NewReader(short)); err != nil {
+			t.Fatalf("CRC %v: %v", crc, err)
+		}
+	}
+	plain := bytes.NewBuffer(nil)
+	if err = qoi.Encode(plain, img); err != nil {
+		t.Fatal(err)
+	}
+	_, m, err := qoi.DecodeWithMetadata(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ICCProfile != nil || m.EXIF != nil || m.Comments != nil {
+		t.Fatalf("expected empty metadata, got %+v", m)
+	}
+}
+
+func TestLargeMetadata(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	// The profile is larger than the 5 bytes per pixel any encoding of the pixels can take.
+	metadata := &qoi.Metadata{ICCProfile: bytes.Repeat([]byte("icc!"), 1000), Comments: []string{"large"}}
+	out := bytes.NewBuffer(nil)
+	if err := (&qoi.Encoder{Metadata: metadata}).Encode(out, img); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	readers := map[string]func() io.Reader{
+		"bytes.Reader": func() io.Reader { return bytes.NewReader(data) },
+		"bytes.Buffer": func() io.Reader { return bytes.NewBuffer(data) },
+	}
+	for name, reader := range readers {
+		for _, strict := range []bool{false, true} {
+			dec := qoi.Decoder{Strict: strict}
+			decoded, m, err := dec.DecodeWithMetadata(reader())
+			if err != nil {
+				t.Fatalf("%s, strict %v: %v", name, strict, err)
+			}
+			if err = imageEquals(decoded, img); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(m.ICCProfile, metadata.ICCProfile) || strings.Join(m.Comments, ",") != "large" {
+				t.Fatalf("%s, strict %v: expected %d-byte profile and comment, got %d-byte profile and %q", name, strict, len(metadata.ICCProfile), len(m.ICCProfile), m.Comments)
+			}
+		}
+	}
+
+	// Looking for a CRC trailer leaves the chunks following the image unread.
+	r := bytes.NewReader(data)
+	if _, err := (&qoi.Decoder{VerifyCRC: true}).Decode(r); err != nil {
+		t.Fatal(err)
+	}
+	if rest := len(metadata.ICCProfile) + len("large") + 2*8; r.Len() != rest {
+		t.Fatalf("expected %d bytes left unread, got %d", rest, r.Len())
+	}
+}
+
+func TestPaletted(t *testing.T) {
+	red, green := color.NRGBA{R: 255, A: 255}, color.NRGBA{G: 255, A: 128}
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			switch {
+			case x < 3:
+				img.SetNRGBA(x, y, red)
+			case x < 6:
+				img.SetNRGBA(x, y, green)
+			}
+		}
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := qoi.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+
+	pal := color.Palette{color.NRGBA{}, color.NRGBA{R: 200, A: 255}, color.NRGBA{G: 200, A: 128}, color.White}
+	paletted, err := qoi.DecodePaletted(bytes.NewReader(qoiContent), pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint8{1, 1, 1, 2, 2, 2, 0, 0} {
+		if got := paletted.ColorIndexAt(i, 4); got != want {
+			t.Fatalf("pixel %d: expected index %d, got %d", i, want, got)
+		}
+	}
+
+	quantized, err := qoi.DecodeQuantized(bytes.NewReader(qoiContent), 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quantized.Palette) != 3 {
+		t.Fatalf("expected 3 colors, got %d", len(quantized.Palette))
+	}
+	if equal, at := qoi.ImagesEqual(quantized, img, 0); !equal {
+		t.Fatalf("pixel at %v differs although the image has few enough colors", at)
+	}
+	quantized, err = qoi.DecodeQuantized(bytes.NewReader(qoiContent), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quantized.Palette) != 2 {
+		t.Fatalf("expected 2 colors, got %d", len(quantized.Palette))
+	}
+	// Red and transparent black are closest to each other, but red covers more pixels.
+	if c := quantized.At(0, 0).(color.NRGBA); c.G != 0 || c.R < 128 {
+		t.Fatalf("unexpected color %v for red pixel", c)
+	}
+
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	photo, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode.Reset()
+	if err = qoi.Encode(qoiEncode, photo); err != nil {
+		t.Fatal(err)
+	}
+	quantized, err = qoi.DecodeQuantized(qoiEncode, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quantized.Palette) != 16 || quantized.Bounds().Size() != photo.Bounds().Size() {
+		t.Fatalf("unexpected %v image with %d colors", quantized.Bounds(), len(quantized.Palette))
+	}
+	if _, err = qoi.DecodeQuantized(bytes.NewReader(qoiContent), 0); err == nil {
+		t.Fatal("expected error for empty palette")
+	}
+}
+
+func TestQuantizer(t *testing.T) {
+	colors := []color.NRGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	var q qoi.Quantizer
+	var decoded []*qoi.Image
+	// Each image holds a single color, so only the Quantizer sees all of them.
+	for _, c := range colors {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		qoiEncode := bytes.NewBuffer(nil)
+		if err := qoi.Encode(qoiEncode, img); err != nil {
+			t.Fatal(err)
+		}
+		img2, err := q.Decode(qoiEncode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, img2)
+	}
+	pal := q.Quantize(make(color.Palette, 0, 256), decoded[0])
+	if len(pal) != len(colors) {
+		t.Fatalf("expected %d colors, got %d", len(colors), len(pal))
+	}
+	for _, img := range decoded {
+		out := bytes.NewBuffer(nil)
+		if err := gif.Encode(out, img, &gif.Options{NumColors: 256, Quantizer: &q}); err != nil {
+			t.Fatal(err)
+		}
+		g, err := gif.Decode(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equal, at := qoi.ImagesEqual(g, img, 0); !equal {
+			t.Fatalf("pixel at %v differs after round trip through GIF", at)
+		}
+	}
+
+	var fresh qoi.Quantizer
+	if pal = fresh.Quantize(make(color.Palette, 1, 4), decoded[0]); len(pal) != 2 {
+		t.Fatalf("expected 1 color appended to palette, got %d", len(pal)-1)
+	}
+}
+
+func TestColorspace(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 128, G: 255, B: 0, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 100, G: 200, B: 128, A: 77})
+
+	enc := qoi.Encoder{ConvertColorspace: true, Colorspace: qoi.Linear}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := enc.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	if cs := qoiContent[13]; cs != byte(qoi.Linear) {
+		t.Fatalf("expected linear colorspace in header, got %d", cs)
+	}
+	linear, err := qoi.DecodeBytes(qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Mid-gray in sRGB is about 21.6% intensity.
+	if c := linear.NRGBAAt(0, 0); c != (color.NRGBA{R: 55, G: 255, B: 0, A: 255}) {
+		t.Fatalf("unexpected linear color %v", c)
+	}
+	if c := linear.NRGBAAt(1, 0); c.A != 77 {
+		t.Fatalf("alpha changed to %d by conversion", c.A)
+	}
+
+	dec := qoi.Decoder{ConvertColorspace: true, Colorspace: qoi.SRGB}
+	decoded, err := dec.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Colorspace != qoi.SRGB {
+		t.Fatalf("expected sRGB image, got colorspace %d", decoded.Colorspace)
+	}
+	// Linear RGB has fewer distinct dark values, so converting back is slightly off.
+	if equal, at := qoi.ImagesEqual(decoded, img, 2); !equal {
+		t.Fatalf("pixel at %v differs after converting back", at)
+	}
+	err = dec.DecodeRows(bytes.NewReader(qoiContent), func(y int, row []byte) error {
+		if !bytes.Equal(row, decoded.Pix) {
+			return fmt.Errorf("row %v differs from decoded image %v", row, decoded.Pix)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := streamDecode(dec, qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(streamed.Pix, decoded.Pix) || streamed.Colorspace != qoi.SRGB {
+		t.Fatalf("StreamDecoder decoded %v in colorspace %d, Decode %v", streamed.Pix, streamed.Colorspace, decoded.Pix)
+	}
+
+	qoi.ConvertColorspace(linear, qoi.SRGB)
+	if !bytes.Equal(linear.Pix, decoded.Pix) || linear.Colorspace != qoi.SRGB {
+		t.Fatal("ConvertColorspace differs from converting while decoding")
+	}
+	// Converting to the colorspace an image is already in leaves it untouched.
+	qoi.ConvertColorspace(linear, qoi.SRGB)
+	if !bytes.Equal(linear.Pix, decoded.Pix) {
+		t.Fatal("converting to the same colorspace changed pixels")
+	}
+
+	dec.Colorspace = 2
+	if _, err = dec.Decode(bytes.NewReader(qoiContent)); !errors.Is(err, qoi.ErrInvalidColorspace) {
+		t.Fatalf("expected ErrInvalidColorspace, got %v", err)
+	}
+	if _, err = streamDecode(dec, qoiContent); !errors.Is(err, qoi.ErrInvalidColorspace) {
+		t.Fatalf("expected ErrInvalidColorspace from StreamDecoder, got %v", err)
+	}
+}
+
+func TestPremultiply(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, G: 128, B: 0, A: 128})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+	img.SetNRGBA(2, 0, color.NRGBA{R: 200, G: 100, B: 50, A: 0})
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := qoi.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+
+	// Decoding with Premultiply matches what drawing into an *image.RGBA yields.
+	want := image.NewRGBA(img.Bounds())
+	draw.Draw(want, want.Bounds(), img, image.Point{}, draw.Src)
+	dec := qoi.Decoder{Premultiply: true}
+	premultiplied, err := dec.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(premultiplied.Pix, want.Pix) {
+		t.Fatalf("expected premultiplied pixels %v, got %v", want.Pix, premultiplied.Pix)
+	}
+	err = dec.DecodeRows(bytes.NewReader(qoiContent), func(y int, row []byte) error {
+		if !bytes.Equal(row, want.Pix) {
+			return fmt.Errorf("expected premultiplied row %v, got %v", want.Pix, row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := streamDecode(dec, qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(streamed.Pix, want.Pix) {
+		t.Fatalf("expected premultiplied pixels from StreamDecoder %v, got %v", want.Pix, streamed.Pix)
+	}
+
+	plain, err := qoi.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Premultiply()
+	if !bytes.Equal(plain.Pix, want.Pix) {
+		t.Fatal("Premultiply differs from premultiplying while decoding")
+	}
+	plain.Unpremultiply()
+	// Fully transparent pixels lose their color, others survive premultiplying at this alpha.
+	visible := image.Rect(0, 0, 2, 1)
+	if equal, at := qoi.ImagesEqual(plain.SubImage(visible), img.SubImage(visible), 1); !equal {
+		t.Fatalf("pixel at %v differs after unpremultiplying", at)
+	}
+
+	enc := qoi.Encoder{Unpremultiply: true}
+	qoiEncode.Reset()
+	if err = enc.Encode(qoiEncode, premultiplied); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := qoi.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Pix, plain.Pix) {
+		t.Fatalf("expected unpremultiplied pixels %v, got %v", plain.Pix, decoded.Pix)
+	}
+}
+
+func TestCompositeAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 255, A: 0})
+	img.SetNRGBA(2, 0, color.NRGBA{R: 255, A: 128})
+	background := color.NRGBA{B: 255, A: 255}
+	want := []byte{255, 0, 0, 0, 0, 255, 128, 0, 127, 0, 0, 255, 0, 0, 255, 0, 0, 255}
+	enc := qoi.Encoder{CRC: true}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := enc.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+
+	dec := qoi.Decoder{Channels: 3, CompositeAlpha: true, Background: background, VerifyCRC: true}
+	decoded, err := dec.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Channels != 3 || !bytes.Equal(decoded.Pix, want) {
+		t.Fatalf("expected composited pixels %v, got %v", want, decoded.Pix)
+	}
+	streamed, err := streamDecode(dec, qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamed.Channels != 3 || !bytes.Equal(streamed.Pix, want) {
+		t.Fatalf("expected composited pixels from StreamDecoder %v, got %v", want, streamed.Pix)
+	}
+
+	decoded, err = qoi.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded.DropAlphaOver(background)
+	if decoded.Channels != 3 || !bytes.Equal(decoded.Pix, want) {
+		t.Fatalf("expected DropAlphaOver to yield %v, got %v", want, decoded.Pix)
+	}
+
+	// Salvaged pixels are composited as well.
+	dec.VerifyCRC = false
+	dec.Salvage = true
+	dec.SalvageColor = color.NRGBA{G: 255, A: 0}
+	decoded, err = dec.Decode(bytes.NewReader(qoiContent[:len(qoiContent)-20]))
+	if !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if last := decoded.Pix[len(decoded.Pix)-3:]; !bytes.Equal(last, []byte{0, 0, 255}) {
+		t.Fatalf("expected salvaged pixel composited over background, got %v", last)
+	}
+}
+
+func TestDecodeResized(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err = qoi.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	size := img.Bounds().Size()
+
+	same, err := qoi.DecodeResized(bytes.NewReader(qoiContent), size.X, size.Y+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = imageEquals(same, img); err != nil {
+		t.Fatalf("image which fits already: %v", err)
+	}
+
+	half, err := qoi.DecodeResized(bytes.NewReader(qoiContent), size.X/2, size.Y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if half.Width != size.X/2 || half.Height != (size.Y+1)/2 {
+		t.Fatalf("expected size %dx%d, got %dx%d", size.X/2, (size.Y+1)/2, half.Width, half.Height)
+	}
+
+	// Each output pixel of an image halved in size averages 2x2 pixels, weighting colors by alpha.
+	quad := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	quad.SetNRGBA(0, 0, color.NRGBA{R: 200, A: 255})
+	quad.SetNRGBA(1, 0, color.NRGBA{R: 100, A: 255})
+	quad.SetNRGBA(0, 1, color.NRGBA{R: 200, A: 255})
+	quad.SetNRGBA(1, 1, color.NRGBA{R: 100, A: 255})
+	quad.SetNRGBA(2, 0, color.NRGBA{G: 255, A: 100})
+	quad.SetNRGBA(3, 1, color.NRGBA{B: 255, A: 0})
+	quadEncode := bytes.NewBuffer(nil)
+	if err = qoi.Encode(quadEncode, quad); err != nil {
+		t.Fatal(err)
+	}
+	dec := qoi.Decoder{FlipVertical: true}
+	small, err := dec.DecodeResized(quadEncode, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{150, 0, 0, 255, 0, 255, 0, 25}
+	if small.Width != 2 || small.Height != 1 || !bytes.Equal(small.Pix, want) {
+		t.Fatalf("expected %dx%d image %v, got %dx%d image %v", 2, 1, want, small.Width, small.Height, small.Pix)
+	}
+
+	if _, err = qoi.DecodeResized(bytes.NewReader(qoiContent), 0, 10); err == nil {
+		t.Fatal("expected error for empty maximum size")
+	}
+	// A header of a huge image which fits is rejected before allocating the image.
+	hostile := []byte("qoif\x00\x00\x40\x00\x00\x00\x40\x00\x04\x00")
+	limited := qoi.Decoder{MaxBytes: 1 << 20}
+	if _, err = limited.DecodeResized(bytes.NewReader(hostile), 1<<20, 1<<20); !errors.Is(err, qoi.ErrTooLarge) {
+		t.Fatalf("expected %v for huge image, got %v", qoi.ErrTooLarge, err)
+	}
+
+	thumb, err := qoi.DecodeThumbnail(bytes.NewReader(qoiContent), image.Pt(size.X/2, size.Y))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = imageEquals(thumb, half); err != nil {
+		t.Fatalf("thumbnail differs from resized image: %v", err)
+	}
+}
+
+func TestDither(t *testing.T) {
+	// The gradient stays within one 8-bit step, so truncating it yields a single color.
+	gradient := image.NewNRGBA64(image.Rect(0, 0, 64, 16))
+	var sum float64
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint16(0x1000 + x*4)
+			gradient.SetNRGBA64(x, y, color.NRGBA64{R: v, G: v, B: v, A: 0xffff})
+			sum += float64(v) / 257
+		}
+	}
+	want := sum / (64 * 16)
+	for _, dither := range []qoi.Dither{qoi.NoDither, qoi.OrderedDither, qoi.FloydSteinbergDither} {
+		enc := qoi.Encoder{Dither: dither}
+		qoiEncode := bytes.NewBuffer(nil)
+		if err := enc.Encode(qoiEncode, gradient); err != nil {
+			t.Fatal(err)
+		}
+		img, err := qoi.Decode(qoiEncode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got float64
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 64; x++ {
+				got += float64(img.NRGBAAt(x, y).R)
+			}
+		}
+		got /= 64 * 16
+		if off := math.Abs(got - want); (dither == qoi.NoDither) != (off > 0.1) {
+			t.Fatalf("dither %d: average %.3f is %.3f off from %.3f", dither, got, off, want)
+		}
+	}
+
+	// 8-bit values widened to 16 bits are not dithered.
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	photo, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wide := image.NewRGBA64(photo.Bounds())
+	draw.Draw(wide, wide.Bounds(), photo, photo.Bounds().Min, draw.Src)
+	for _, dither := range []qoi.Dither{qoi.OrderedDither, qoi.FloydSteinbergDither} {
+		enc := qoi.Encoder{Dither: dither}
+		qoiEncode := bytes.NewBuffer(nil)
+		if err := enc.Encode(qoiEncode, wide); err != nil {
+			t.Fatal(err)
+		}
+		img, err := qoi.Decode(qoiEncode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equal, at := qoi.ImagesEqual(img, wide, 0); !equal {
+			t.Fatalf("dither %d: pixel at %v differs", dither, at)
+		}
+	}
+}
+
+func TestDecodeYCbCr(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 3))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 37)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := qoi.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	ycbcr := func(x, y int) (uint8, uint8, uint8) {
+		c := img.NRGBAAt(x, y)
+		return color.RGBToYCbCr(c.R, c.G, c.B)
+	}
+
+	full, err := qoi.DecodeYCbCr(bytes.NewReader(qoiContent), image.YCbCrSubsampleRatio444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			yy, cb, cr := ycbcr(x, y)
+			if got := full.YCbCrAt(x, y); got != (color.YCbCr{Y: yy, Cb: cb, Cr: cr}) {
+				t.Fatalf("pixel (%d, %d): expected %v, got %v", x, y, color.YCbCr{Y: yy, Cb: cb, Cr: cr}, got)
+			}
+		}
+	}
+
+	dec := qoi.Decoder{FlipVertical: true}
+	sub, err := dec.DecodeYCbCr(bytes.NewReader(qoiContent), image.YCbCrSubsampleRatio420)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if yy, _, _ := ycbcr(0, 0); sub.Y[sub.YOffset(0, 2)] != yy {
+		t.Fatalf("expected flipped luma %d, got %d", yy, sub.Y[sub.YOffset(0, 2)])
+	}
+	// The bottom-right chroma sample covers the first pixel only, as the image is flipped.
+	_, cb, _ := ycbcr(2, 0)
+	if got := sub.Cb[sub.COffset(2, 2)]; got != cb {
+		t.Fatalf("expected chroma %d of lone pixel, got %d", cb, got)
+	}
+	var sum int
+	for _, p := range []image.Point{{0, 1}, {1, 1}, {0, 2}, {1, 2}} {
+		_, cb, _ := ycbcr(p.X, p.Y)
+		sum += int(cb)
+	}
+	if got := sub.Cb[sub.COffset(0, 0)]; int(got) != (sum+2)/4 {
+		t.Fatalf("expected averaged chroma %d, got %d", (sum+2)/4, got)
+	}
+
+	if _, err = qoi.DecodeYCbCr(bytes.NewReader(qoiContent), image.YCbCrSubsampleRatio422); err == nil {
+		t.Fatal("expected error for unsupported subsample ratio")
+	}
+}
+
+func TestGamma(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 64, G: 128, B: 255, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 0, G: 200, B: 100, A: 10})
+	enc := qoi.Encoder{Gamma: 2}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := enc.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	adjusted, err := qoi.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := adjusted.NRGBAAt(0, 0); c != (color.NRGBA{R: 16, G: 64, B: 255, A: 255}) {
+		t.Fatalf("unexpected gamma-adjusted color %v", c)
+	}
+	if c := adjusted.NRGBAAt(1, 0); c.A != 10 {
+		t.Fatalf("alpha changed to %d by gamma", c.A)
+	}
+
+	dec := qoi.Decoder{Gamma: 0.5}
+	decoded, err := dec.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Squaring loses precision in dark values, which taking the square root cannot restore.
+	if equal, at := qoi.ImagesEqual(decoded, img, 2); !equal {
+		t.Fatalf("pixel at %v differs after reverting gamma", at)
+	}
+
+	enc.Gamma = -1
+	if err = enc.Encode(io.Discard, img); err == nil {
+		t.Fatal("expected error for negative gamma")
+	}
+	s := qoi.StreamDecoder{Decoder: dec}
+	if _, err = s.Write(qoiContent); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.Image().Pix, decoded.Pix) {
+		t.Fatalf("StreamDecoder decoded %v, Decode %v", s.Image().Pix, decoded.Pix)
+	}
+
+	for _, gamma := range []float64{-1, math.NaN()} {
+		dec.Gamma = gamma
+		if _, err = dec.Decode(bytes.NewReader(qoiContent)); err == nil {
+			t.Fatalf("expected error for gamma %v", gamma)
+		}
+		s = qoi.StreamDecoder{Decoder: dec}
+		if _, err = s.Write(qoiContent); err == nil {
+			t.Fatalf("expected error from StreamDecoder for gamma %v", gamma)
+		}
+	}
+}
+
+func TestColorTransformer(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inverted := image.NewNRGBA(img.Bounds())
+	copy(inverted.Pix, img.(*image.NRGBA).Pix)
+	for i := 0; i < len(inverted.Pix); i += 4 {
+		inverted.Pix[i], inverted.Pix[i+1], inverted.Pix[i+2] = 255-inverted.Pix[i], 255-inverted.Pix[i+1], 255-inverted.Pix[i+2]
+	}
+	var rows int
+	invert := qoi.ColorTransformerFunc(func(row []byte, channels int) {
+		for i := 0; i < len(row); i += channels {
+			row[i], row[i+1], row[i+2] = 255-row[i], 255-row[i+1], 255-row[i+2]
+		}
+		rows++
+	})
+
+	enc := qoi.Encoder{ColorTransformer: invert}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err = enc.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := qoi.Decode(bytes.NewReader(qoiEncode.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = imageEquals(decoded, inverted); err != nil {
+		t.Fatalf("encoding with ColorTransformer: %v", err)
+	}
+
+	dec := qoi.Decoder{ColorTransformer: invert}
+	decoded, err = dec.Decode(bytes.NewReader(qoiEncode.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = imageEquals(decoded, img); err != nil {
+		t.Fatalf("decoding with ColorTransformer: %v", err)
+	}
+	if height := img.Bounds().Dy(); rows != 2*height {
+		t.Fatalf("expected %d rows to be transformed, got %d", 2*height, rows)
+	}
+}
+
+func TestCutoutAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 10, G: 20, B: 30, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 40, G: 50, B: 60, A: 128})
+	img.SetNRGBA(2, 0, color.NRGBA{R: 70, G: 80, B: 90, A: 127})
+	img.SetNRGBA(3, 0, color.NRGBA{R: 100, G: 110, B: 120, A: 1})
+	want := []byte{10, 20, 30, 255, 40, 50, 60, 255, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	enc := qoi.Encoder{CutoutAlpha: true, AlphaThreshold: 128}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := enc.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := qoi.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Pix, want) {
+		t.Fatalf("expected pixels %v, got %v", want, decoded.Pix)
+	}
+
+	qimg := qoi.NewImage(4, 1, 4, qoi.SRGB)
+	copy(qimg.Pix, img.Pix)
+	qimg.ThresholdAlpha(128)
+	if !bytes.Equal(qimg.Pix, want) {
+		t.Fatalf("expected ThresholdAlpha to yield %v, got %v", want, qimg.Pix)
+	}
+}
+
+func TestSwizzle(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 1, G: 2, B: 3, A: 4})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 5, G: 6, B: 7, A: 255})
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := qoi.Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+
+	for _, tc := range []struct {
+		dec  qoi.Decoder
+		want []byte
+	}{
+		{qoi.Decoder{Swizzle: "ARGB"}, []byte{4, 1, 2, 3, 255, 5, 6, 7}},
+		{qoi.Decoder{Swizzle: "ABGR"}, []byte{4, 3, 2, 1, 255, 7, 6, 5}},
+		{qoi.Decoder{Swizzle: "ARGB", Channels: 3}, []byte{1, 2, 3, 5, 6, 7}},
+		{qoi.Decoder{Swizzle: "BGRA", Channels: 3}, []byte{3, 2, 1, 7, 6, 5}},
+		// Premultiplying happens before swizzling.
+		{qoi.Decoder{Swizzle: "ARGB", Premultiply: true}, []byte{4, 0, 0, 0, 255, 5, 6, 7}},
+	} {
+		decoded, err := tc.dec.Decode(bytes.NewReader(qoiContent))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Pix, tc.want) {
+			t.Fatalf("%+v: expected %v, got %v", tc.dec, tc.want, decoded.Pix)
+		}
+		var rows []byte
+		err = tc.dec.DecodeRows(bytes.NewReader(qoiContent), func(y int, row []byte) error {
+			rows = append(rows, row...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rows, tc.want) {
+			t.Fatalf("%+v: expected rows %v, got %v", tc.dec, tc.want, rows)
+		}
+		streamed, err := streamDecode(tc.dec, qoiContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(streamed.Pix, tc.want) {
+			t.Fatalf("%+v: expected streamed pixels %v, got %v", tc.dec, tc.want, streamed.Pix)
+		}
+	}
+
+	enc := qoi.Encoder{Swizzle: "ARGB"}
+	out := bytes.NewBuffer(nil)
+	rw, err := enc.NewRowWriter(out, 2, 4, qoi.SRGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rw.WriteRow([]byte{4, 1, 2, 3, 255, 5, 6, 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err = rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), qoiContent) {
+		t.Fatal("RowWriter with Swizzle differs from encoding the image")
+	}
+	out.Reset()
+	pw, err := enc.NewPixelWriter(out, 2, 1, 4, qoi.SRGB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Split a pixel across calls.
+	if err = pw.WritePixels([]byte{4, 1, 2, 3, 255, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.WritePixels([]byte{6, 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err = pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), qoiContent) {
+		t.Fatal("PixelWriter with Swizzle differs from encoding the image")
+	}
+
+	for _, dec := range []qoi.Decoder{{Swizzle: "RGGB"}, {Swizzle: "RGB"}, {Swizzle: "BGRA", BGRA: true}} {
+		if _, err = dec.Decode(bytes.NewReader(qoiContent)); err == nil {
+			t.Fatalf("%+v: expected error", dec)
+		}
+		s := qoi.StreamDecoder{Decoder: dec}
+		if _, err = s.Write(qoiContent); err == nil {
+			t.Fatalf("%+v: expected error from StreamDecoder", dec)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels := img.Bounds().Dx() * img.Bounds().Dy()
+	for _, level := range []qoi.CompressionLevel{qoi.DefaultCompression, qoi.BestSpeed, qoi.BestCompression} {
+		var stats qoi.Stats
+		enc := qoi.Encoder{CompressionLevel: level, CRC: true, Stats: &stats}
+		qoiContent := bytes.NewBuffer(nil)
+		if err := enc.Encode(qoiContent, img); err != nil {
+			t.Fatal(err)
+		}
+		total, runPixels := 0, 0
+		for _, n := range stats.Pixels {
+			total += n
+		}
+		for n, count := range stats.RunLengths {
+			runPixels += n * count
+		}
+		if total != pixels || runPixels != stats.Pixels[qoi.OpRun] {
+			t.Fatalf("level %d: ops account for %d of %d pixels, runs for %d of %d", level, total, pixels, runPixels, stats.Pixels[qoi.OpRun])
+		}
+		if stats.OutputBytes != int64(qoiContent.Len()) || stats.InputBytes != int64(pixels*3) {
+			t.Fatalf("level %d: unexpected sizes %d and %d", level, stats.InputBytes, stats.OutputBytes)
+		}
+		hitRate := stats.IndexHitRate()
+		if level == qoi.BestSpeed {
+			if hitRate != 0 || stats.Ops[qoi.OpDiff] != 0 || stats.Ops[qoi.OpLuma] != 0 {
+				t.Fatalf("expected only RUN, RGB and RGBA ops for BestSpeed, got %v", stats.Ops)
+			}
+			continue
+		}
+		if hitRate <= 0 || hitRate >= 1 {
+			t.Fatalf("level %d: unexpected index hit rate %v", level, hitRate)
+		}
+		if ratio := stats.Ratio(); ratio <= 0 || ratio >= 1 {
+			t.Fatalf("level %d: unexpected ratio %v", level, ratio)
+		}
+	}
+	if qoi.OpLuma.String() != "LUMA" {
+		t.Fatalf("unexpected name %q", qoi.OpLuma)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	if err := (&qoi.Encoder{Channels: 4}).Encode(qoiEncode, img); err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	decoded, err := qoi.DecodeBytes(qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traced := image.NewNRGBA(decoded.Bounds())
+	offset := int64(14)
+	header, err := qoi.Trace(bytes.NewReader(qoiContent), func(op qoi.TracedOp) error {
+		if op.Offset != offset {
+			t.Fatalf("expected op at offset %d, got %d", offset, op.Offset)
+		}
+		offset += int64(op.Size)
+		if op.Pos != image.Pt(op.Pixel%traced.Rect.Dx(), op.Pixel/traced.Rect.Dx()) {
+			t.Fatalf("position %v does not match pixel %d", op.Pos, op.Pixel)
+		}
+		for i := op.Pixel; i < op.Pixel+op.Pixels && i*4 < len(traced.Pix); i++ {
+			traced.Pix[i*4], traced.Pix[i*4+1], traced.Pix[i*4+2], traced.Pix[i*4+3] = op.Color.R, op.Color.G, op.Color.B, op.Color.A
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Width() != decoded.Width || offset != int64(len(qoiContent)-8) {
+		t.Fatalf("unexpected header %+v or end of ops at %d", header, offset)
+	}
+	if equal, at := qoi.ImagesEqual(traced, decoded, 0); !equal {
+		t.Fatalf("traced colors differ from decoded pixels at %v", at)
+	}
+
+	ops := 0
+	_, err = qoi.Trace(bytes.NewReader(qoiContent[:len(qoiContent)/2]), func(op qoi.TracedOp) error {
+		ops++
+		return nil
+	})
+	if !errors.Is(err, qoi.ErrTruncated) || ops == 0 {
+		t.Fatalf("expected ErrTruncated after some ops for truncated stream, got %v after %d ops", err, ops)
+	}
+	stop := errors.New("stop")
+	if _, err := qoi.Trace(bytes.NewReader(qoiContent), func(op qoi.TracedOp) error { return stop }); err != stop {
+		t.Fatalf("expected error of fn, got %v", err)
+	}
+}
+
+func TestCostMap(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 2))
+	for x := 0; x < 64; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{R: 200, G: 10, B: 10, A: 255})
+		img.SetNRGBA(x, 1, color.NRGBA{R: 200, G: 10, B: 10, A: uint8(x*2 + 1)})
+	}
+	qoiContent := bytes.NewBuffer(nil)
+	if err := qoi.Encode(qoiContent, img); err != nil {
+		t.Fatal(err)
+	}
+
+	costs, err := qoi.DecodeCostMap(bytes.NewReader(qoiContent.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if costs.Bounds() != img.Bounds() {
+		t.Fatalf("expected bounds %v, got %v", img.Bounds(), costs.Bounds())
+	}
+	// The first pixel is an RGB op of 32 bits, followed by a run of 62 pixels and one of a single pixel.
+	if got := costs.GrayAt(0, 0).Y; got != 204 {
+		t.Fatalf("expected 204 for RGB op, got %d", got)
+	}
+	for x := 1; x < 63; x++ {
+		if got := costs.GrayAt(x, 0).Y; got > 1 {
+			t.Fatalf("expected at most 1 for pixel %d of run, got %d", x, got)
+		}
+	}
+	for x := 0; x < 64; x++ {
+		if got := costs.GrayAt(x, 1).Y; got != 255 {
+			t.Fatalf("expected 255 for RGBA op at %d, got %d", x, got)
+		}
+	}
+
+	dec := qoi.Decoder{MaxBytes: 64}
+	if _, err := dec.DecodeCostMap(bytes.NewReader(qoiContent.Bytes())); !errors.Is(err, qoi.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge for cost map exceeding MaxBytes, got %v", err)
+	}
+	if _, err := qoi.DecodeCostMap(bytes.NewReader(qoiContent.Bytes()[:40])); !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected ErrTruncated for truncated stream, got %v", err)
+	}
+}
+
+func TestEncodeSeekable(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "opaque.qoi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prefix := []byte("prefix")
+	_, err = f.Write(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = qoi.Encode(f, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("suffix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channels := content[len(prefix)+12]; channels != 3 {
+		t.Fatalf("expected backpatched channels 3, got %d", channels)
+	}
+	if !bytes.HasSuffix(content, []byte("suffix")) {
+		t.Fatal("write after Encode did not append to the end of the file")
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	bounds := img.Bounds().Add(image.Pt(3, 5))
+
+	nrgba := image.NewNRGBA(bounds)
+	err = qoi.DecodeInto(bytes.NewReader(qoiContent), nrgba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(nrgba, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rgba := image.NewRGBA(bounds)
+	err = qoi.DecodeInto(bytes.NewReader(qoiContent), rgba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRGBA := image.NewRGBA(bounds)
+	draw.Draw(wantRGBA, bounds, img, img.Bounds().Min, draw.Src)
+	err = imageEquals(rgba, wantRGBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rgba, err = qoi.DecodeRGBA(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(rgba, wantRGBA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, channels := range []uint8{3, 4} {
+		enc := qoi.Encoder{Channels: channels}
+		out := bytes.NewBuffer(nil)
+		if err = enc.Encode(out, img); err != nil {
+			t.Fatal(err)
+		}
+		nrgba, err = qoi.DecodeNRGBA(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := img
+		if channels == 3 {
+			opaque := image.NewNRGBA(bounds)
+			copy(opaque.Pix, img.(*image.NRGBA).Pix)
+			for i := 3; i < len(opaque.Pix); i += 4 {
+				opaque.Pix[i] = 255
+			}
+			want = opaque
+		}
+		err = imageEquals(nrgba, want)
+		if err != nil {
+			t.Fatalf("%d channels: %v", channels, err)
+		}
+	}
+
+	nrgba64, err := qoi.DecodeNRGBA64(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNRGBA64 := image.NewNRGBA64(nrgba64.Bounds())
+	draw.Draw(wantNRGBA64, wantNRGBA64.Bounds(), img, img.Bounds().Min, draw.Src)
+	err = imageEquals(nrgba64, wantNRGBA64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = qoi.DecodeInto(bytes.NewReader(qoiContent), image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	if err == nil {
+		t.Fatal("expected error for mismatched dst dimensions")
+	}
+}
+
+func TestDecodeWithStride(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const stride = 1024
+	bigBuf := make([]byte, stride*img.Bounds().Dy())
+	for i := range bigBuf {
+		bigBuf[i] = 0xaa
+	}
+	decodeImg, err := qoi.DecodeWithStride(qoiEncode, bigBuf, stride)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rowSize := decodeImg.Width * int(decodeImg.Channels)
+	for y := 0; y < decodeImg.Height; y++ {
+		for _, b := range bigBuf[y*stride+rowSize : (y+1)*stride] {
+			if b != 0xaa {
+				t.Fatalf("padding of row %d was overwritten", y)
+			}
+		}
+	}
+}
+
+func TestDecodeForcedChannels(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{40, 50, 60, 255})
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := qoi.Decoder{Channels: 4}
+	decodeImg, err := dec.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodeImg.Channels != 4 {
+		t.Fatalf("expected 4 channels, got %d", decodeImg.Channels)
+	}
+	if !bytes.Equal(decodeImg.Pix, img.Pix) {
+		t.Fatalf("expected Pix %v, got %v", img.Pix, decodeImg.Pix)
+	}
+}
+
+func TestDecodeRows(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	want, err := qoi.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	numRows := 0
+	err = qoi.DecodeRows(bytes.NewReader(qoiContent), func(y int, row []byte) error {
+		if y != numRows {
+			return fmt.Errorf("expected row %d, got %d", numRows, y)
+		}
+		numRows++
+		if !bytes.Equal(row, want.Pix[y*want.Stride:(y+1)*want.Stride]) {
+			return fmt.Errorf("row %d differs", y)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numRows != want.Height {
+		t.Fatalf("expected %d rows, got %d", want.Height, numRows)
+	}
+}
+
+func TestDecodeFlipVertical(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := qoi.Decoder{FlipVertical: true}
+	decodeImg, err := dec.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := img.Bounds()
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if decodeImg.At(x, bounds.Dy()-1-y) != img.At(bounds.Min.X+x, bounds.Min.Y+y) {
+				t.Fatalf("pixel (%d, %d) not flipped", x, y)
+			}
+		}
+	}
+}
+
+func TestDecodeBGRA(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 40})
+	img.SetNRGBA(1, 0, color.NRGBA{50, 60, 70, 80})
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := qoi.Decoder{BGRA: true}
+	decodeImg, err := dec.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{30, 20, 10, 40, 70, 60, 50, 80}
+	if !bytes.Equal(decodeImg.Pix, want) {
+		t.Fatalf("expected Pix %v, got %v", want, decodeImg.Pix)
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := qoi.DecodeHeader(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Width() != img.Bounds().Dx() || header.Height() != img.Bounds().Dy() {
+		t.Fatalf("expected size %v, got %dx%d", img.Bounds().Size(), header.Width(), header.Height())
+	}
+	if header.Channels() != 3 && header.Channels() != 4 {
+		t.Fatalf("invalid channels %d", header.Channels())
+	}
+	if header.Colorspace() != qoi.SRGB {
+		t.Fatalf("expected colorspace %d, got %d", qoi.SRGB, header.Colorspace())
+	}
+}
+
+func TestDecodeExtendedConfig(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	cfg, err := qoi.DecodeExtendedConfig(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeImg, err := qoi.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != decodeImg.Width || cfg.Height != decodeImg.Height || cfg.Channels != decodeImg.Channels || cfg.Colorspace != decodeImg.Colorspace {
+		t.Fatalf("config %+v does not match decoded image", cfg)
+	}
+	if cfg.PixLen() != len(decodeImg.Pix) {
+		t.Fatalf("expected PixLen %d, got %d", len(decodeImg.Pix), cfg.PixLen())
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 40})
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	dec := qoi.Decoder{Strict: true}
+	_, err = dec.Decode(bytes.NewReader(qoiContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dec.Decode(bytes.NewReader(qoiContent[:len(qoiContent)-1]))
+	if err == nil {
+		t.Fatal("expected error for truncated end marker")
+	}
+	_, err = dec.Decode(bytes.NewReader(append(qoiContent[:len(qoiContent):len(qoiContent)], 0)))
+	if err == nil {
+		t.Fatal("expected error for trailing data")
+	}
+}
+
+func TestDecodeMaxBytes(t *testing.T) {
+	header := []byte{'q', 'o', 'i', 'f', 0, 0, 0xff, 0xff, 0, 0, 0xff, 0xff, 4, 0}
+	dec := qoi.Decoder{MaxBytes: 1024 * 1024}
+	_, err := dec.Decode(bytes.NewReader(header))
+	if err == nil {
+		t.Fatal("expected error for image exceeding MaxBytes")
+	}
+}
+
+func TestDecodeHugeHeader(t *testing.T) {
+	// 65537*65537*4 overflows uint32 to a small value.
+	header := []byte{'q', 'o', 'i', 'f', 0, 1, 0, 1, 0, 1, 0, 1, 4, 0}
+	_, err := qoi.DecodeIntoBuffer(bytes.NewReader(header), make([]byte, 1024))
+	if err == nil {
+		t.Fatal("expected error for image exceeding buffer")
+	}
+}
+
+// hugeImage is an image with bounds whose area overflows int.
+type hugeImage struct {
+	image.Image
+}
+
+func (hugeImage) Bounds() image.Rectangle {
+	half := int(^uint(0)>>1)/2 + 1
+	return image.Rect(0, 0, half, half)
+}
+
+func TestEncodeHugeBounds(t *testing.T) {
+	err := qoi.Encode(io.Discard, hugeImage{})
+	if !errors.Is(err, qoi.ErrTooLarge) {
+		t.Fatalf("expected %v, got %v", qoi.ErrTooLarge, err)
+	}
+	// Max < Min makes for negative dimensions.
+	err = qoi.Encode(io.Discard, &image.NRGBA{Rect: image.Rectangle{Min: image.Pt(5, 5), Max: image.Pt(2, 2)}})
+	if err == nil || errors.Is(err, qoi.ErrTooLarge) || errors.Is(err, qoi.ErrEmptyImage) {
+		t.Fatalf("expected error for negative size, got %v", err)
+	}
+	half := int(^uint(0)>>1)/2 + 1
+	cfg := qoi.Config{Config: image.Config{Width: half, Height: half}, Channels: 4}
+	if n := cfg.PixLen(); n != -1 {
+		t.Fatalf("expected PixLen to report overflow, got %d", n)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 40})
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	withByte := func(i int, b byte) []byte {
+		content := append([]byte(nil), qoiContent...)
+		content[i] = b
+		return content
+	}
+	tests := []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"bad magic", withByte(0, 'x'), qoi.ErrBadMagic},
+		{"invalid channels", withByte(12, 5), qoi.ErrInvalidChannels},
+		{"invalid colorspace", withByte(13, 2), qoi.ErrInvalidColorspace},
+		{"zero width", withByte(7, 0), qoi.ErrEmptyImage},
+		{"truncated header", qoiContent[:10], qoi.ErrTruncated},
+		{"truncated body", qoiContent[:16], qoi.ErrTruncated},
+	}
+	for _, test := range tests {
+		_, err := qoi.Decode(bytes.NewReader(test.content))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+	dec := qoi.Decoder{MaxBytes: 1}
+	_, err = dec.Decode(bytes.NewReader(qoiContent))
+	if !errors.Is(err, qoi.ErrTooLarge) {
+		t.Errorf("expected %v, got %v", qoi.ErrTooLarge, err)
+	}
+	_, err = qoi.DecodeIntoBuffer(bytes.NewReader(withByte(7, 0)), make([]byte, 16))
+	if !errors.Is(err, qoi.ErrEmptyImage) {
+		t.Errorf("expected %v, got %v", qoi.ErrEmptyImage, err)
+	}
+	err = qoi.Encode(io.Discard, image.NewNRGBA(image.Rect(0, 0, 0, 5)))
+	if !errors.Is(err, qoi.ErrEmptyImage) {
+		t.Errorf("expected %v, got %v", qoi.ErrEmptyImage, err)
+	}
+}
+
+func TestDecodeTruncatedDiagnostics(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 10)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each pixel is encoded as a 5 byte RGBA op. Cut the third op short.
+	data := qoiEncode.Bytes()[:14+5+5+2]
+	want := "unexpected EOF at offset 26 in row 0, column 2 after 2 pixels: expected 6, last op 0xff at offset 24"
+	decoders := map[string]func() error{
+		"Decode": func() error {
+			_, err := qoi.Decode(&countingReader{r: bytes.NewReader(data)})
+			return err
+		},
+		"DecodeBytes": func() error {
+			_, err := qoi.DecodeBytes(data)
+			return err
+		},
+		"StreamDecoder": func() error {
+			var s qoi.StreamDecoder
+			s.Write(data)
+			return s.Close()
+		},
+	}
+	for name, decode := range decoders {
+		err := decode()
+		if !errors.Is(err, qoi.ErrTruncated) || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+func TestDecodeSalvage(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 10)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each pixel is encoded as a 5 byte RGBA op. Cut the third op short.
+	data := qoiEncode.Bytes()[:14+5+5+2]
+	dec := qoi.Decoder{Salvage: true, SalvageColor: color.NRGBA{1, 2, 3, 4}, FlipVertical: true, BGRA: true}
+	for _, decode := range []func() (*qoi.Image, error){
+		func() (*qoi.Image, error) { return dec.DecodeBytes(data) },
+		func() (*qoi.Image, error) { return dec.Decode(&countingReader{r: bytes.NewReader(data)}) },
+	} {
+		salvaged, err := decode()
+		if !errors.Is(err, qoi.ErrTruncated) {
+			t.Fatalf("expected %v, got %v", qoi.ErrTruncated, err)
+		}
+		want := []byte{
+			3, 2, 1, 4, 3, 2, 1, 4, 3, 2, 1, 4,
+			20, 10, 0, 30, 60, 50, 40, 70, 3, 2, 1, 4,
+		}
+		if !bytes.Equal(salvaged.Pix, want) {
+			t.Fatalf("expected salvaged pixels %v, got %v", want, salvaged.Pix)
+		}
+	}
+}
+
+func TestDecodeStrictRunOverflow(t *testing.T) {
+	content := []byte{'q', 'o', 'i', 'f', 0, 0, 0, 2, 0, 0, 0, 1, 4, 0}
+	content = append(content, 0b11_000010) // run of 3 pixels
+	content = append(content, 0, 0, 0, 0, 0, 0, 0, 1)
+	_, err := qoi.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := qoi.Decoder{Strict: true}
+	_, err = dec.Decode(bytes.NewReader(content))
+	if err == nil {
+		t.Fatal("expected error for run extending past the last pixel")
+	}
+	if !strings.Contains(err.Error(), "offset 14") {
+		t.Fatalf("expected error to state offset 14, got %v", err)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	small.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 40})
+	frames := []image.Image{img, small, img}
+	qoiEncode := bytes.NewBuffer(nil)
+	for _, frame := range frames {
+		err = qoi.Encode(qoiEncode, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	decodeImgs, err := qoi.DecodeAll(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decodeImgs) != len(frames) {
+		t.Fatalf("expected %d images, got %d", len(frames), len(decodeImgs))
+	}
+	for i, frame := range frames {
+		err = imageEquals(decodeImgs[i], frame)
+		if err != nil {
+			t.Fatalf("image %d: %v", i, err)
+		}
+	}
+}
+
+func TestDecodeBytes(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	dec := qoi.Decoder{Strict: true}
+	decodeImg, err := dec.DecodeBytes(qoiContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = qoi.DecodeBytes(qoiContent[:len(qoiContent)/2])
+	if !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected %v, got %v", qoi.ErrTruncated, err)
+	}
+}
+
+func TestDecodeByteReader(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 40})
+	qoiEncode := bytes.NewBuffer(nil)
+	err := qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode.WriteString("tail")
+	in := bytes.NewReader(qoiEncode.Bytes())
+	_, err = qoi.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 0, 0, 0, 0, 1, 't', 'a', 'i', 'l'}
+	if !bytes.Equal(rest, want) {
+		t.Fatalf("expected remaining input %v, got %v", want, rest)
+	}
+}
+
+// countingReader counts the calls to its Read method.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	cr.reads++
+	return cr.r.Read(p)
+}
+
+func TestDecodeBufferSize(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	dec := qoi.Decoder{BufferSize: len(qoiContent)}
+	in := &countingReader{r: bytes.NewReader(qoiContent)}
+	decodeImg, err := dec.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header is read through the same buffer as the body.
+	if in.reads > 1 {
+		t.Fatalf("expected body to be read at once, but Read was called %d times", in.reads)
+	}
+}
+
+func TestDecodeAllocs(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	// countingReader does not implement io.ByteReader, so decoding needs a buffer, which must be pooled.
+	in := &countingReader{r: bytes.NewReader(qoiContent)}
+	allocs := testing.AllocsPerRun(100, func() {
+		in.r.(*bytes.Reader).Reset(qoiContent)
+		if _, err := qoi.Decode(in); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// One allocation for the Image, one for its Pix.
+	if allocs > 2 {
+		t.Fatalf("expected at most 2 allocations per Decode, got %v", allocs)
+	}
+}
+
+func TestDecodeSized(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode.WriteString("suffix")
+	in := bytes.NewReader(qoiEncode.Bytes())
+	decodeImg, err := qoi.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without Strict, the end marker is not consumed either.
+	if string(rest) != "\x00\x00\x00\x00\x00\x00\x00\x01suffix" {
+		t.Fatalf("expected data following the pixels to be left unread, got %q", rest)
+	}
+	_, err = qoi.Decode(bytes.NewReader(qoiEncode.Bytes()[:qoiEncode.Len()-100]))
+	if !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+
+	// Images followed by more data than they can take up are decoded from a stream, which leaves the data
+	// unread just the same.
+	suffix := bytes.Repeat([]byte("suffix"), 128*128)
+	qoiEncode.Write(suffix)
+	f, err := os.Create(filepath.Join(t.TempDir(), "suffixed.qoi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(qoiEncode.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = qoi.Decode(f); err != nil {
+		t.Fatal(err)
+	}
+	rest, err = io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\x00\x00\x00\x00\x00\x00\x00\x01suffix" + string(suffix); string(rest) != want {
+		t.Fatalf("expected %d bytes following the pixels to be left unread, got %d", len(want), len(rest))
+	}
+}
+
+func TestStreamDecoder(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	s := &qoi.StreamDecoder{Decoder: qoi.Decoder{Strict: true}}
+	completedRows := 0
+	for i := 0; i < len(qoiContent); i += 7 {
+		end := i + 7
+		if end > len(qoiContent) {
+			end = len(qoiContent)
+		}
+		_, err = s.Write(qoiContent[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.CompletedRows() < completedRows {
+			t.Fatalf("completed rows decreased from %d to %d", completedRows, s.CompletedRows())
+		}
+		completedRows = s.CompletedRows()
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(s.Image(), img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s = &qoi.StreamDecoder{}
+	_, err = s.Write(qoiContent[:len(qoiContent)/2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Done() {
+		t.Fatal("expected incomplete image")
+	}
+	if err = s.Close(); !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected %v, got %v", qoi.ErrTruncated, err)
+	}
+}
+
+// streamDecode decodes data with a StreamDecoder using the settings of dec, writing a few bytes at a time.
+func streamDecode(dec qoi.Decoder, data []byte) (*qoi.Image, error) {
+	s := qoi.StreamDecoder{Decoder: dec}
+	for i := 0; i < len(data); i += 3 {
+		end := i + 3
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := s.Write(data[i:end]); err != nil {
+			return nil, err
+		}
+	}
+	return s.Image(), s.Close()
+}
+
+func TestPeekHeader(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := bufio.NewReader(qoiEncode)
+	header, err := qoi.PeekHeader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Width() != img.Bounds().Dx() || header.Height() != img.Bounds().Dy() {
+		t.Fatalf("expected size %v, got %dx%d", img.Bounds().Size(), header.Width(), header.Height())
+	}
+	decodeImg, err := qoi.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = imageEquals(decodeImg, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImagePixOffset(t *testing.T) {
+	img := &qoi.Image{Pix: make([]byte, 2*16), Stride: 16, Width: 3, Height: 2, Channels: 4}
+	if offset := img.PixOffset(2, 1); offset != 16+2*4 {
+		t.Fatalf("expected offset %d, got %d", 16+2*4, offset)
+	}
+	img.Stride = 0
+	if offset := img.PixOffset(2, 1); offset != 3*4+2*4 {
+		t.Fatalf("expected offset %d for packed rows, got %d", 3*4+2*4, offset)
+	}
+}
+
+func TestImageSet(t *testing.T) {
+	img := &qoi.Image{Pix: make([]byte, 2*2*4), Width: 2, Height: 2, Channels: 4}
+	var _ draw.Image = img
+	draw.Draw(img, image.Rect(1, 0, 2, 2), image.NewUniform(color.NRGBA{10, 20, 30, 40}), image.Point{}, draw.Src)
+	want := []byte{0, 0, 0, 0, 10, 20, 30, 40, 0, 0, 0, 0, 10, 20, 30, 40}
+	if !bytes.Equal(img.Pix, want) {
+		t.Fatalf("expected Pix %v, got %v", want, img.Pix)
+	}
+	img.Set(2, 0, color.White)
+	if !bytes.Equal(img.Pix, want) {
+		t.Fatal("Set out of bounds modified Pix")
+	}
+}
+
+func TestImageSubImage(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeImg, err := qoi.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := image.Rect(10, 20, 50, 30)
+	sub := decodeImg.SubImage(r)
+	err = imageEquals(sub, img.(*image.NRGBA).SubImage(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subSub := sub.(*qoi.Image).SubImage(image.Rect(20, 25, 60, 60))
+	err = imageEquals(subSub, img.(*image.NRGBA).SubImage(image.Rect(20, 25, 50, 30)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Bounds() != r {
+		t.Fatalf("expected bounds %v, got %v", r, sub.Bounds())
+	}
+	sub.(*qoi.Image).Set(r.Min.X, r.Min.Y, color.NRGBA{1, 2, 3, 255})
+	if decodeImg.At(r.Min.X, r.Min.Y) != (color.NRGBA{1, 2, 3, 255}) {
+		t.Fatal("sub-image does not share pixels with its parent")
+	}
+}
+
+func TestImageOpaque(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{1, 2, 3, 255, 4, 5, 6, 255}, Width: 2, Height: 1, Channels: 4}
+	if !img.Opaque() {
+		t.Fatal("expected opaque image")
+	}
+	img.Pix[7] = 254
+	if img.Opaque() {
+		t.Fatal("expected non-opaque image")
+	}
+	rgb := &qoi.Image{Pix: []byte{1, 2, 3, 4, 5, 6}, Width: 2, Height: 1, Channels: 3}
+	if !rgb.Opaque() {
+		t.Fatal("expected 3-channel image to be opaque")
+	}
+}
+
+func TestImageNRGBAAt(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{1, 2, 3, 4, 5, 6}, Width: 2, Height: 1, Channels: 3}
+	if c := img.NRGBAAt(1, 0); c != (color.NRGBA{4, 5, 6, 255}) {
+		t.Fatalf("unexpected color %v", c)
+	}
+	if c := img.NRGBAAt(2, 0); c != (color.NRGBA{}) {
+		t.Fatalf("expected zero color out of bounds, got %v", c)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { img.NRGBAAt(1, 0) }); allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestImageRGBA64At(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{10, 20, 30, 128}, Width: 1, Height: 1, Channels: 4}
+	var _ interface{ RGBA64At(x, y int) color.RGBA64 } = img
+	want := color.RGBA64Model.Convert(img.At(0, 0)).(color.RGBA64)
+	if c := img.RGBA64At(0, 0); c != want {
+		t.Fatalf("expected %v, got %v", want, c)
+	}
+}
+
+func TestNewImage(t *testing.T) {
+	img := qoi.NewImage(3, 2, 4, qoi.Linear)
+	if len(img.Pix) != 3*2*4 || img.Stride != 3*4 || img.Colorspace != qoi.Linear {
+		t.Fatalf("unexpected image %+v", img)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for invalid channels")
+		}
+	}()
+	qoi.NewImage(3, 2, 2, qoi.SRGB)
+}
+
+func TestImageToNRGBAToRGBA(t *testing.T) {
+	pngContent := testdataloader.GetTestFile("testdata/cyberpanel1.png")
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	for _, channels := range []uint8{3, 4} {
+		dec := qoi.Decoder{Channels: channels}
+		decodeImg, err := dec.DecodeBytes(qoiContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := image.NewNRGBA(img.Bounds())
+		draw.Draw(want, want.Bounds(), decodeImg, image.Point{}, draw.Src)
+		err = imageEquals(decodeImg.ToNRGBA(), want)
+		if err != nil {
+			t.Fatalf("%d channels: %v", channels, err)
+		}
+		wantRGBA := image.NewRGBA(img.Bounds())
+		draw.Draw(wantRGBA, wantRGBA.Bounds(), decodeImg, image.Point{}, draw.Src)
+		err = imageEquals(decodeImg.ToRGBA(), wantRGBA)
+		if err != nil {
+			t.Fatalf("%d channels: %v", channels, err)
+		}
+	}
+}
+
+func TestImageClone(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{1, 2, 3, 0, 4, 5, 6, 0}, Stride: 4, Width: 1, Height: 2, Channels: 3}
+	clone := img.Clone()
+	err := imageEquals(clone, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.Pix[0] = 9
+	if clone.Pix[0] != 1 {
+		t.Fatal("clone shares pixels with the original")
+	}
+}
+
+func TestImageExpandDropAlpha(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, Width: 2, Height: 2, Channels: 3}
+	want := img.Clone()
+	img.ExpandAlpha()
+	if img.Channels != 4 || len(img.Pix) != 16 {
+		t.Fatalf("unexpected image %+v after ExpandAlpha", img)
+	}
+	err := imageEquals(img, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.Pix[3] = 0
+	if img.DropAlpha(true) {
+		t.Fatal("DropAlpha(true) converted non-opaque image")
+	}
+	img.Pix[3] = 255
+	if !img.DropAlpha(true) {
+		t.Fatal("DropAlpha(true) did not convert opaque image")
+	}
+	if !bytes.Equal(img.Pix, want.Pix) {
+		t.Fatalf("expected Pix %v, got %v", want.Pix, img.Pix)
+	}
+	convert := []func(img *qoi.Image){
+		(*qoi.Image).ExpandAlpha,
+		func(img *qoi.Image) { img.DropAlpha(false) },
+		func(img *qoi.Image) { img.DropAlphaOver(color.NRGBA{}) },
+	}
+	for i, convert := range convert {
+		channels := uint8(3)
+		if i > 0 {
+			channels = 4
+		}
+		parent := &qoi.Image{Pix: make([]byte, 4*3*int(channels)), Width: 4, Height: 3, Channels: channels}
+		for j := range parent.Pix {
+			parent.Pix[j] = uint8(j)
+		}
+		if channels == 4 {
+			for j := 3; j < len(parent.Pix); j += 4 {
+				parent.Pix[j] = 255
+			}
+		}
+		want := parent.Clone()
+		for _, r := range []image.Rectangle{image.Rect(1, 0, 3, 2), image.Rect(0, 0, 4, 2)} {
+			sub := parent.SubImage(r).(*qoi.Image)
+			convert(sub)
+			if !bytes.Equal(parent.Pix, want.Pix) {
+				t.Fatalf("conversion %d of sub-image %v changed its parent", i, r)
+			}
+			if err := imageEquals(sub, want.SubImage(r)); err != nil {
+				t.Fatalf("conversion %d of sub-image %v: %v", i, r, err)
+			}
+		}
+	}
+}
+
+func TestImagesEqual(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	b := image.NewNRGBA(image.Rect(5, 5, 7, 7))
+	b.SetNRGBA(6, 5, color.NRGBA{0, 3, 0, 0})
+	if equal, p := qoi.ImagesEqual(a, b, 0); equal || p != image.Pt(1, 0) {
+		t.Fatalf("expected difference at (1, 0), got %v, %v", equal, p)
+	}
+	if equal, _ := qoi.ImagesEqual(a, b, 3); !equal {
+		t.Fatal("expected images to be equal within tolerance")
+	}
+	if equal, _ := qoi.ImagesEqual(a, image.NewNRGBA(image.Rect(0, 0, 2, 3)), 255); equal {
+		t.Fatal("expected images of different size to differ")
+	}
+}
+
+func TestImageTransforms(t *testing.T) {
+	// 1 2 3
+	// 4 5 6
+	newImg := func() *qoi.Image {
+		return &qoi.Image{Pix: []byte{1, 1, 1, 2, 2, 2, 3, 3, 3, 4, 4, 4, 5, 5, 5, 6, 6, 6}, Width: 3, Height: 2, Channels: 3}
+	}
+	firstChannels := func(img *qoi.Image) []byte {
+		var b []byte
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				b = append(b, img.NRGBAAt(x, y).R)
+			}
+		}
+		return b
+	}
+	tests := []struct {
+		name      string
+		transform func(img *qoi.Image)
+		want      []byte
+	}{
+		{"FlipVertical", (*qoi.Image).FlipVertical, []byte{4, 5, 6, 1, 2, 3}},
+		{"FlipHorizontal", (*qoi.Image).FlipHorizontal, []byte{3, 2, 1, 6, 5, 4}},
+		{"Rotate90 clockwise", func(img *qoi.Image) { img.Rotate90(true) }, []byte{4, 1, 5, 2, 6, 3}},
+		{"Rotate90 counter-clockwise", func(img *qoi.Image) { img.Rotate90(false) }, []byte{3, 6, 2, 5, 1, 4}},
+	}
+	for _, test := range tests {
+		img := newImg()
+		test.transform(img)
+		if got := firstChannels(img); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestImageMarshalBinary(t *testing.T) {
+	img := &qoi.Image{Pix: []byte{1, 2, 3, 255, 4, 5, 6, 255}, Width: 2, Height: 1, Channels: 4, Colorspace: qoi.Linear}
+	var _ encoding.BinaryMarshaler = img
+	data, err := img.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodeImg qoi.Image
+	var _ encoding.BinaryUnmarshaler = &decodeImg
+	err = decodeImg.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodeImg.Channels != img.Channels || decodeImg.Colorspace != img.Colorspace || !bytes.Equal(decodeImg.Pix, img.Pix) {
+		t.Fatalf("expected %+v, got %+v", img, decodeImg)
+	}
+}
+
+func TestEncodeChannels(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 40})
+	qoiEncode := bytes.NewBuffer(nil)
+	enc := qoi.Encoder{Channels: 3}
+	err := enc.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeImg, err := qoi.Decode(qoiEncode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{10, 20, 30, 0, 0, 0}
+	if decodeImg.Channels != 3 || !bytes.Equal(decodeImg.Pix, want) {
+		t.Fatalf("expected 3 channels with Pix %v, got %d channels with Pix %v", want, decodeImg.Channels, decodeImg.Pix)
+	}
+}
+
+func TestSeedCorpus(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	seeds, err := qoi.SeedCorpus(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) != 18 {
+		t.Fatalf("expected 18 seeds, got %d", len(seeds))
+	}
+	dir := t.TempDir()
+	err = qoi.WriteSeedCorpus(dir, "FuzzDecode", seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "testdata", "fuzz", "FuzzDecode", "seed-0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("go test fuzz v1\n[]byte(%q)\n", seeds[0]); string(content) != want {
+		t.Fatalf("expected corpus file %q, got %q", want, content)
+	}
+}
+
 func imageEquals(a, b image.Image) error {
 	if !sameRectDimensions(a.Bounds(), b.Bounds()) {
 		return fmt.Errorf("dimensions not equal")
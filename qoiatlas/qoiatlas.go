@@ -0,0 +1,198 @@
+// Package qoiatlas packs many small images, such as the sprites of a game, into one large QOI image and
+// loads them back from it.
+//
+// An atlas consists of the QOI image and a manifest stating the rectangle each sprite occupies in it. The
+// manifest is a plain struct, which can be stored alongside the image as JSON, or embedded in Go code.
+package qoiatlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// DefaultMaxWidth is the width atlases are limited to if Options.MaxWidth is 0.
+const DefaultMaxWidth = 2048
+
+// Sprite is an image to pack into an atlas.
+type Sprite struct {
+	Name  string
+	Image image.Image
+}
+
+// Options configures how sprites are packed.
+type Options struct {
+	// MaxWidth is the maximum width of the atlas. If 0, DefaultMaxWidth is used.
+	MaxWidth int
+	// Padding is the amount of transparent pixels left between sprites, so filtering while sampling one
+	// sprite does not bleed in pixels of its neighbors.
+	Padding int
+}
+
+// Manifest states where the sprites of an atlas are located.
+type Manifest struct {
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+	Sprites []SpriteRect `json:"sprites"`
+}
+
+// SpriteRect is the location of a sprite in an atlas.
+type SpriteRect struct {
+	Name   string `json:"name"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Rect returns the bounds of the sprite in the atlas.
+func (r SpriteRect) Rect() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+// Build packs sprites into an atlas, returning its image and manifest. Sprites are placed on shelves,
+// tallest first: each shelf is filled from left to right until the next sprite does not fit into
+// opts.MaxWidth, then a new shelf is started below it. The sprites of the manifest are in the order of
+// sprites. Pixels are copied losslessly, as Encode would read them.
+func Build(sprites []Sprite, opts Options) (*image.NRGBA, *Manifest, error) {
+	maxWidth := opts.MaxWidth
+	if maxWidth == 0 {
+		maxWidth = DefaultMaxWidth
+	}
+	if len(sprites) == 0 {
+		return nil, nil, fmt.Errorf("no sprites to pack")
+	}
+	manifest := &Manifest{Sprites: make([]SpriteRect, len(sprites))}
+	names := make(map[string]bool, len(sprites))
+	for i, s := range sprites {
+		if names[s.Name] {
+			return nil, nil, fmt.Errorf("duplicate sprite name %q", s.Name)
+		}
+		names[s.Name] = true
+		size := s.Image.Bounds().Size()
+		if size.X == 0 || size.Y == 0 {
+			return nil, nil, fmt.Errorf("sprite %q has no pixels", s.Name)
+		}
+		if size.X > maxWidth {
+			return nil, nil, fmt.Errorf("sprite %q of width %d exceeds maximum atlas width %d", s.Name, size.X, maxWidth)
+		}
+		manifest.Sprites[i] = SpriteRect{Name: s.Name, Width: size.X, Height: size.Y}
+	}
+
+	order := make([]int, len(sprites))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return manifest.Sprites[order[i]].Height > manifest.Sprites[order[j]].Height
+	})
+	x, y, shelfHeight := 0, 0, 0
+	for _, i := range order {
+		r := &manifest.Sprites[i]
+		if x > 0 && x+r.Width > maxWidth {
+			x, y = 0, y+shelfHeight+opts.Padding
+			shelfHeight = 0
+		}
+		r.X, r.Y = x, y
+		x += r.Width + opts.Padding
+		if r.Height > shelfHeight {
+			shelfHeight = r.Height
+		}
+		if r.X+r.Width > manifest.Width {
+			manifest.Width = r.X + r.Width
+		}
+	}
+	manifest.Height = y + shelfHeight
+
+	atlas := image.NewNRGBA(image.Rect(0, 0, manifest.Width, manifest.Height))
+	for i, s := range sprites {
+		copyNRGBA(atlas, manifest.Sprites[i].Rect().Min, s.Image)
+	}
+	return atlas, manifest, nil
+}
+
+// copyNRGBA copies the pixels of src into dst at p, converting them like qoi.Encode.
+func copyNRGBA(dst *image.NRGBA, p image.Point, src image.Image) {
+	b := src.Bounds()
+	nrgbaSrc, ok := src.(interface {
+		NRGBAAt(x, y int) color.NRGBA
+	})
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var c color.NRGBA
+			if ok {
+				c = nrgbaSrc.NRGBAAt(x, y)
+			} else {
+				c = color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			}
+			dst.SetNRGBA(p.X+x-b.Min.X, p.Y+y-b.Min.Y, c)
+		}
+	}
+}
+
+// Write builds an atlas from sprites like Build, then encodes its image as QOI to w and its manifest as JSON
+// to manifest.
+func Write(w, manifest io.Writer, sprites []Sprite, opts Options) error {
+	atlas, m, err := Build(sprites, opts)
+	if err != nil {
+		return err
+	}
+	if err = qoi.Encode(w, atlas); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(manifest)
+	enc.SetIndent("", "\t")
+	return enc.Encode(m)
+}
+
+// Atlas is a decoded atlas.
+type Atlas struct {
+	Image    *qoi.Image
+	Manifest *Manifest
+	rects    map[string]image.Rectangle
+}
+
+// Load decodes an atlas from its QOI image read from r and its JSON manifest read from manifest.
+func Load(r, manifest io.Reader) (*Atlas, error) {
+	var m Manifest
+	if err := json.NewDecoder(manifest).Decode(&m); err != nil {
+		return nil, fmt.Errorf("could not decode manifest: %w", err)
+	}
+	img, err := qoi.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode atlas: %w", err)
+	}
+	return New(img, &m)
+}
+
+// New returns the Atlas consisting of img and manifest, after checking that all sprites lie within img.
+func New(img *qoi.Image, manifest *Manifest) (*Atlas, error) {
+	a := &Atlas{Image: img, Manifest: manifest, rects: make(map[string]image.Rectangle, len(manifest.Sprites))}
+	bounds := img.Bounds()
+	for _, s := range manifest.Sprites {
+		r := s.Rect().Add(bounds.Min)
+		if s.Width <= 0 || s.Height <= 0 || !r.In(bounds) {
+			return nil, fmt.Errorf("sprite %q at %v is not within atlas of bounds %v", s.Name, r, bounds)
+		}
+		if _, ok := a.rects[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate sprite name %q", s.Name)
+		}
+		a.rects[s.Name] = r
+	}
+	return a, nil
+}
+
+// Sprite returns the sprite called name as a view sharing pixels with the atlas image, or nil if there is
+// no such sprite.
+func (a *Atlas) Sprite(name string) *qoi.Image {
+	r, ok := a.rects[name]
+	if !ok {
+		return nil
+	}
+	return a.Image.SubImage(r).(*qoi.Image)
+}
@@ -0,0 +1,66 @@
+package qoiatlas_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/rand"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoiatlas"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestAtlas(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var sprites []qoiatlas.Sprite
+	for i := 0; i < 20; i++ {
+		sprites = append(sprites, qoiatlas.Sprite{
+			Name: fmt.Sprintf("sprite%d", i),
+			Image: qoitest.RandomImage(rng, qoitest.ImageOptions{
+				Width: 1 + rng.Intn(40), Height: 1 + rng.Intn(40), Alpha: qoitest.RandomAlpha, Colors: 32,
+			}),
+		})
+	}
+	opts := qoiatlas.Options{MaxWidth: 100, Padding: 1}
+	atlasContent, manifestContent := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	if err := qoiatlas.Write(atlasContent, manifestContent, sprites, opts); err != nil {
+		t.Fatal(err)
+	}
+	atlas, err := qoiatlas.Load(atlasContent, manifestContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atlas.Manifest.Width > opts.MaxWidth {
+		t.Fatalf("atlas width %d exceeds maximum width %d", atlas.Manifest.Width, opts.MaxWidth)
+	}
+	for i, s := range sprites {
+		r := atlas.Manifest.Sprites[i]
+		if r.Name != s.Name {
+			t.Fatalf("expected sprite %d to be %q, got %q", i, s.Name, r.Name)
+		}
+		for _, other := range atlas.Manifest.Sprites[:i] {
+			if padded := other.Rect().Inset(-opts.Padding); padded.Overlaps(r.Rect()) {
+				t.Fatalf("sprite %q at %v overlaps padded sprite %q at %v", r.Name, r.Rect(), other.Name, padded)
+			}
+		}
+		sprite := atlas.Sprite(s.Name)
+		if sprite.Bounds() != r.Rect() {
+			t.Fatalf("sprite %q has bounds %v, expected %v", r.Name, sprite.Bounds(), r.Rect())
+		}
+		if equal, at := qoi.ImagesEqual(sprite, s.Image, 0); !equal {
+			t.Fatalf("sprite %q differs at %v", r.Name, at)
+		}
+	}
+	if atlas.Sprite("missing") != nil {
+		t.Fatal("expected nil for missing sprite")
+	}
+
+	if _, _, err = qoiatlas.Build([]qoiatlas.Sprite{{Name: "wide", Image: image.NewNRGBA(image.Rect(0, 0, 101, 1))}}, opts); err == nil {
+		t.Fatal("expected error for sprite exceeding maximum width")
+	}
+	if _, _, err = qoiatlas.Build(append(sprites[:1:1], sprites[0]), opts); err == nil {
+		t.Fatal("expected error for duplicate sprite names")
+	}
+}
@@ -0,0 +1,181 @@
+// Package qoibench provides helpers for benchmarking QOI encoders and decoders against a corpus of images,
+// such as the official QOI benchmark suite available at https://qoiformat.org/benchmark/.
+package qoibench
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// Sample is an image of a corpus, along with its QOI encoding.
+type Sample struct {
+	// Name is the path of the image relative to the corpus directory.
+	Name  string
+	Image image.Image
+	// QOI is the image encoded by qoi.Encode.
+	QOI []byte
+}
+
+// pixels returns the amount of pixels of s.
+func (s Sample) pixels() int {
+	return s.Image.Bounds().Dx() * s.Image.Bounds().Dy()
+}
+
+// LoadCorpus loads all PNG images in dir and its subdirectories, in lexical order of their paths. The
+// official benchmark suite stores a QOI encoding next to each PNG image, which is not read; the QOI of
+// each Sample is encoded by this package instead.
+func LoadCorpus(dir string) ([]Sample, error) {
+	var samples []Sample
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".png") {
+			return err
+		}
+		sample, err := loadSample(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		sample.Name, err = filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, sample)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+	return samples, nil
+}
+
+func loadSample(path string) (Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return Sample{}, err
+	}
+	var buf bytes.Buffer
+	if err := qoi.Encode(&buf, img); err != nil {
+		return Sample{}, err
+	}
+	return Sample{Image: img, QOI: buf.Bytes()}, nil
+}
+
+// EncodeFunc encodes img and writes it to w.
+type EncodeFunc func(w io.Writer, img image.Image) error
+
+// DecodeFunc decodes a QOI image from r.
+type DecodeFunc func(r io.Reader) (image.Image, error)
+
+// Encode is an EncodeFunc using this package's qoi.Encode.
+func Encode(w io.Writer, img image.Image) error {
+	return qoi.Encode(w, img)
+}
+
+// Decode is a DecodeFunc using this package's qoi.Decode.
+func Decode(r io.Reader) (image.Image, error) {
+	return qoi.Decode(r)
+}
+
+// BenchmarkEncode runs b.N iterations of encoding all samples with encode and reports the throughput in
+// megapixels per second as "Mpx/s".
+func BenchmarkEncode(b *testing.B, samples []Sample, encode EncodeFunc) {
+	pixels := 0
+	for _, s := range samples {
+		pixels += s.pixels()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for _, s := range samples {
+			if err := encode(io.Discard, s.Image); err != nil {
+				b.Fatalf("%s: %v", s.Name, err)
+			}
+		}
+	}
+	reportPixels(b, pixels, time.Since(start))
+}
+
+// BenchmarkDecode runs b.N iterations of decoding the QOI of all samples with decode and reports the
+// throughput in megapixels per second as "Mpx/s".
+func BenchmarkDecode(b *testing.B, samples []Sample, decode DecodeFunc) {
+	pixels := 0
+	for _, s := range samples {
+		pixels += s.pixels()
+	}
+	r := bytes.NewReader(nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for _, s := range samples {
+			r.Reset(s.QOI)
+			if _, err := decode(r); err != nil {
+				b.Fatalf("%s: %v", s.Name, err)
+			}
+		}
+	}
+	reportPixels(b, pixels, time.Since(start))
+}
+
+// BenchmarkSamples runs BenchmarkEncode and BenchmarkDecode as sub-benchmarks for each sample, named after
+// the sample.
+func BenchmarkSamples(b *testing.B, samples []Sample, encode EncodeFunc, decode DecodeFunc) {
+	for _, s := range samples {
+		one := []Sample{s}
+		b.Run("encode/"+s.Name, func(b *testing.B) {
+			BenchmarkEncode(b, one, encode)
+		})
+		b.Run("decode/"+s.Name, func(b *testing.B) {
+			BenchmarkDecode(b, one, decode)
+		})
+	}
+}
+
+// BenchmarkChannels runs BenchmarkEncode as sub-benchmarks for each sample, once on the sample converted to
+// a 3-channel *qoi.Image and once on the same pixels with 4 channels, named "3/" and "4/" followed by the name
+// of the sample. Both encode the same ops, so the difference is the cost of expanding 3-channel rows to
+// 4 channels while encoding.
+func BenchmarkChannels(b *testing.B, samples []Sample) {
+	dec := qoi.Decoder{Channels: 3}
+	for _, s := range samples {
+		rgb, err := dec.DecodeBytes(s.QOI)
+		if err != nil {
+			b.Fatalf("%s: %v", s.Name, err)
+		}
+		rgba := rgb.Clone()
+		rgba.ExpandAlpha()
+		enc := qoi.Encoder{Channels: 4}
+		for _, img := range []*qoi.Image{rgb, rgba} {
+			one := []Sample{{Name: s.Name, Image: img}}
+			b.Run(fmt.Sprintf("%d/%s", img.Channels, s.Name), func(b *testing.B) {
+				BenchmarkEncode(b, one, enc.Encode)
+			})
+		}
+	}
+}
+
+func reportPixels(b *testing.B, pixels int, elapsed time.Duration) {
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		b.ReportMetric(float64(pixels)*float64(b.N)/seconds/1e6, "Mpx/s")
+	}
+}
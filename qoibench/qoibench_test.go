@@ -0,0 +1,36 @@
+package qoibench_test
+
+import (
+	"testing"
+
+	"github.com/Zyl9393/qoi/qoibench"
+)
+
+func BenchmarkCorpus(b *testing.B) {
+	samples, err := qoibench.LoadCorpus("../testdata")
+	if err != nil {
+		b.Fatal(err)
+	}
+	qoibench.BenchmarkSamples(b, samples, qoibench.Encode, qoibench.Decode)
+}
+
+func BenchmarkChannels(b *testing.B) {
+	samples, err := qoibench.LoadCorpus("../testdata")
+	if err != nil {
+		b.Fatal(err)
+	}
+	qoibench.BenchmarkChannels(b, samples)
+}
+
+func TestLoadCorpus(t *testing.T) {
+	samples, err := qoibench.LoadCorpus("../testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Name != "cyberpanel1.png" {
+		t.Fatalf("expected corpus to consist of cyberpanel1.png, got %d samples", len(samples))
+	}
+	if len(samples[0].QOI) == 0 {
+		t.Fatalf("expected sample to have been encoded")
+	}
+}
@@ -0,0 +1,228 @@
+// Package qoigray implements QOIG, a non-standard extension of QOI to grayscale images with 1 channel for
+// gray or 2 channels for gray and alpha. Files start with the magic "qoig" instead of "qoif", so standard
+// QOI decoders reject them instead of misinterpreting them.
+//
+// The format mirrors QOI: the 14-byte header has the same layout, with 1 or 2 channels, ops hash pixels
+// into an index of 64 entries, and files end with the same end marker. As there is only one color channel,
+// the ops are laid out differently:
+//
+//	INDEX       0b00iiiiii          index position i
+//	DIFF        0x40 + dv + 64      dv in -64..63, covering 0x40 to 0xbf
+//	RUN         0b11llllll          run of l+1 pixels, l in 0..61
+//	GRAY        0xfe v              full gray value
+//	GRAYALPHA   0xff v a            full gray and alpha values
+//
+// Differences are computed modulo 256. DIFF ops keep the alpha of the previous pixel. The previous pixel
+// starts out as opaque black, and the index position of a pixel is (v*3 + a*11) % 64.
+package qoigray
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/internal/ext"
+)
+
+const (
+	magic = "qoig"
+
+	opDiff      = 0x40
+	opRun       = 0xc0
+	opGray      = 0xfe
+	opGrayAlpha = 0xff
+)
+
+// ErrBadMagic is returned when data does not start with the QOIG magic bytes.
+var ErrBadMagic = errors.New("bad QOIG magic")
+
+func init() {
+	image.RegisterFormat("qoig", magic, Decode, DecodeConfig)
+}
+
+// pixel holds a gray value and an alpha value.
+type pixel [2]uint8
+
+func hash(px pixel) int {
+	return (int(px[0])*3 + int(px[1])*11) & 63
+}
+
+// Encode encodes img as a QOIG file and writes it to w. Colors are converted to their luminance, like
+// color.GrayModel does for opaque colors. Images whose pixels are all opaque are stored with 1 channel,
+// others with 2. The colorspace of a *qoi.Image is preserved, others are stored as sRGB.
+func Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if err := ext.CheckSize(width, height); err != nil {
+		return err
+	}
+	rowAt := pixelRows(img)
+	channels := byte(1)
+	for y := bounds.Min.Y; y < bounds.Max.Y && channels == 1; y++ {
+		for _, px := range rowAt(y) {
+			if px[1] != 255 {
+				channels = 2
+				break
+			}
+		}
+	}
+	colorspace := qoi.SRGB
+	if qimg, ok := img.(*qoi.Image); ok {
+		colorspace = qimg.Colorspace
+	}
+
+	out := bufio.NewWriter(w)
+	ext.WriteHeader(out, magic, ext.Header{Width: width, Height: height, Channels: channels, Colorspace: colorspace})
+
+	var index [64]pixel
+	prev := pixel{0, 255}
+	run := 0
+	flushRun := func() {
+		if run > 0 {
+			out.WriteByte(opRun | byte(run-1))
+			run = 0
+		}
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for _, px := range rowAt(y) {
+			if px == prev {
+				run++
+				if run == 62 {
+					flushRun()
+				}
+				continue
+			}
+			flushRun()
+			h := hash(px)
+			dv := int8(px[0] - prev[0])
+			switch {
+			case index[h] == px:
+				out.WriteByte(byte(h))
+			case px[1] != prev[1]:
+				out.Write([]byte{opGrayAlpha, px[0], px[1]})
+			case dv >= -64 && dv <= 63:
+				out.WriteByte(byte(opDiff + 64 + int(dv)))
+			default:
+				out.Write([]byte{opGray, px[0]})
+			}
+			index[h] = px
+			prev = px
+		}
+	}
+	flushRun()
+	out.Write(ext.EndMarker)
+	return out.Flush()
+}
+
+// pixelRows returns a function returning the pixels of row y of img. The returned slice is reused between
+// calls.
+func pixelRows(img image.Image) func(y int) []pixel {
+	bounds := img.Bounds()
+	row := make([]pixel, bounds.Dx())
+	if img, ok := img.(*image.Gray); ok {
+		return func(y int) []pixel {
+			i := img.PixOffset(bounds.Min.X, y)
+			for x := range row {
+				row[x] = pixel{img.Pix[i+x], 255}
+			}
+			return row
+		}
+	}
+	return func(y int) []pixel {
+		for x := range row {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, y)).(color.NRGBA)
+			row[x] = pixel{luminance(c), c.A}
+		}
+		return row
+	}
+}
+
+// luminance returns the gray value of c, computed like color.GrayModel does, but from non-premultiplied
+// values, so that translucent pixels keep their gray value.
+func luminance(c color.NRGBA) uint8 {
+	r, g, b := uint32(c.R)*0x101, uint32(c.G)*0x101, uint32(c.B)*0x101
+	return uint8((19595*r + 38470*g + 7471*b + 1<<15) >> 24)
+}
+
+// DecodeConfig returns the color model and dimensions of a QOIG image without decoding the entire image.
+// The color model is color.GrayModel for images with 1 channel and color.NRGBAModel for images with 2.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	header, err := ext.ReadHeader(r, magic, ErrBadMagic, 1, 2)
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.GrayModel
+	if header.Channels == 2 {
+		model = color.NRGBAModel
+	}
+	return image.Config{ColorModel: model, Width: header.Width, Height: header.Height}, nil
+}
+
+// Decode decodes a QOIG image from r. Images with 1 channel are returned as *image.Gray, images with 2
+// channels as *image.NRGBA with equal red, green and blue.
+func Decode(r io.Reader) (image.Image, error) {
+	header, err := ext.ReadHeader(r, magic, ErrBadMagic, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	width, height := header.Width, header.Height
+	in, ok := r.(io.ByteReader)
+	if !ok {
+		in = bufio.NewReader(r)
+	}
+	var set func(i int, px pixel)
+	var img image.Image
+	if header.Channels == 1 {
+		gray := image.NewGray(image.Rect(0, 0, width, height))
+		set = func(i int, px pixel) { gray.Pix[i] = px[0] }
+		img = gray
+	} else {
+		nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+		set = func(i int, px pixel) {
+			p := nrgba.Pix[i*4 : i*4+4]
+			p[0], p[1], p[2], p[3] = px[0], px[0], px[0], px[1]
+		}
+		img = nrgba
+	}
+	var index [64]pixel
+	px := pixel{0, 255}
+	run := 0
+	for i := 0; i < width*height; i++ {
+		if run > 0 {
+			run--
+		} else {
+			b1, err := in.ReadByte()
+			if err != nil {
+				return nil, ext.PixelError(err, i)
+			}
+			switch {
+			case b1 == opGray:
+				if px[0], err = in.ReadByte(); err != nil {
+					return nil, ext.PixelError(err, i)
+				}
+			case b1 == opGrayAlpha:
+				if px[0], err = in.ReadByte(); err != nil {
+					return nil, ext.PixelError(err, i)
+				}
+				if px[1], err = in.ReadByte(); err != nil {
+					return nil, ext.PixelError(err, i)
+				}
+			case b1 < opDiff:
+				px = index[b1]
+			case b1 < opRun:
+				px[0] += b1 - opDiff - 64
+			default:
+				run = int(b1 & 0x3f)
+			}
+			index[hash(px)] = px
+		}
+		set(i, px)
+	}
+	if err := ext.ReadEnd(in); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,108 @@
+package qoigray_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoigray"
+)
+
+// randomGray returns a grayscale image resembling a scan: runs of paper, smooth strokes and some noise.
+func randomGray(rng *rand.Rand, width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	v := uint8(240)
+	for i := range img.Pix {
+		switch rng.Intn(8) {
+		case 0:
+			v = uint8(rng.Intn(256))
+		case 1, 2:
+			v += uint8(rng.Intn(21) - 10)
+		case 3:
+			v += uint8(rng.Intn(161) - 80)
+		}
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gray := randomGray(rng, 120, 80)
+	out := bytes.NewBuffer(nil)
+	if err := qoigray.Encode(out, gray); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	if data[12] != 1 {
+		t.Fatalf("expected 1 channel for opaque image, got %d", data[12])
+	}
+	decoded, err := qoigray.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.(*image.Gray).Pix, gray.Pix) {
+		t.Fatal("decoded gray pixels differ")
+	}
+	rgb := bytes.NewBuffer(nil)
+	if err = qoi.Encode(rgb, gray); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() >= rgb.Len() {
+		t.Fatalf("expected QOIG file to be smaller than QOI file of %d bytes, got %d", rgb.Len(), out.Len())
+	}
+	if _, format, err := image.Decode(bytes.NewReader(data)); err != nil || format != "qoig" {
+		t.Fatalf("expected image.Decode to detect qoig, got %q, %v", format, err)
+	}
+	if _, err = qoigray.Decode(bytes.NewReader(data[:len(data)-9])); !errors.Is(err, qoi.ErrTruncated) {
+		t.Fatalf("expected %v, got %v", qoi.ErrTruncated, err)
+	}
+
+	withAlpha := image.NewNRGBA(gray.Bounds())
+	for i, v := range gray.Pix {
+		withAlpha.Pix[i*4], withAlpha.Pix[i*4+1], withAlpha.Pix[i*4+2] = v, v, v
+		withAlpha.Pix[i*4+3] = 255
+		if i%7 == 0 {
+			withAlpha.Pix[i*4+3] = uint8(i)
+		}
+	}
+	out.Reset()
+	if err = qoigray.Encode(out, withAlpha); err != nil {
+		t.Fatal(err)
+	}
+	if out.Bytes()[12] != 2 {
+		t.Fatalf("expected 2 channels for translucent image, got %d", out.Bytes()[12])
+	}
+	decoded, err = qoigray.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.(*image.NRGBA).Pix, withAlpha.Pix) {
+		t.Fatal("decoded gray and alpha pixels differ")
+	}
+}
+
+func TestEncodeColor(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	colors := []color.NRGBA{{R: 255, A: 255}, {G: 200, B: 100, A: 255}, {R: 10, G: 20, B: 30, A: 255}}
+	for x, c := range colors {
+		img.SetNRGBA(x, 0, c)
+	}
+	out := bytes.NewBuffer(nil)
+	if err := qoigray.Encode(out, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := qoigray.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, c := range colors {
+		if got, want := decoded.At(x, 0), color.GrayModel.Convert(c); got != want {
+			t.Fatalf("pixel %d is %v, expected luminance %v", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package qoihttp provides helpers for serving QOI images over HTTP.
+package qoihttp
+
+import (
+	"image"
+	"net/http"
+	"strconv"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// ContentType is the media type QOI images are served as.
+const ContentType = "image/qoi"
+
+// ServeImage replies to r with img encoded as a QOI file.
+func ServeImage(w http.ResponseWriter, r *http.Request, img image.Image) {
+	var enc qoi.Encoder
+	ServeImageWith(w, r, img, &enc)
+}
+
+// ServeImageWith is like ServeImage, but encodes img using the settings of enc.
+//
+// The image is encoded twice: once to determine the Content-Length, once more while streaming the response
+// body, so no buffer holding the whole file is needed. HEAD requests only encode the image once and receive
+// no body. If img cannot be encoded, the reply is an internal server error.
+func ServeImageWith(w http.ResponseWriter, r *http.Request, img image.Image, enc *qoi.Encoder) {
+	size, err := enc.EncodedSize(img)
+	if err != nil {
+		http.Error(w, "could not encode image: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	// The status has been sent already, so a failure here means the client went away and cannot be told.
+	_ = enc.Encode(w, img)
+}
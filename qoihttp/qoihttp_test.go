@@ -0,0 +1,53 @@
+package qoihttp_test
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoihttp"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestServeImage(t *testing.T) {
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 64, Height: 48, Alpha: qoitest.RandomAlpha, RunLength: 4, Colors: 16,
+	})
+	want := bytes.NewBuffer(nil)
+	if err := qoi.Encode(want, img); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		rec := httptest.NewRecorder()
+		qoihttp.ServeImage(rec, httptest.NewRequest(method, "/image.qoi", nil), img)
+		res := rec.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", method, http.StatusOK, res.StatusCode)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != qoihttp.ContentType {
+			t.Fatalf("%s: expected Content-Type %q, got %q", method, qoihttp.ContentType, ct)
+		}
+		if cl := res.Header.Get("Content-Length"); cl != strconv.Itoa(want.Len()) {
+			t.Fatalf("%s: expected Content-Length %d, got %s", method, want.Len(), cl)
+		}
+		body := rec.Body.Bytes()
+		if method == http.MethodHead {
+			if len(body) != 0 {
+				t.Fatalf("HEAD: expected empty body, got %d bytes", len(body))
+			}
+		} else if !bytes.Equal(body, want.Bytes()) {
+			t.Fatalf("GET: body differs from Encode output")
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	qoihttp.ServeImage(rec, httptest.NewRequest(http.MethodGet, "/", nil), image.NewNRGBA(image.Rect(0, 0, 0, 0)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d for empty image, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
@@ -0,0 +1,191 @@
+package qoihttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// DefaultMaxPixels is the maximum amount of pixels of images a Transcoder with zero MaxPixels transcodes.
+const DefaultMaxPixels = 1 << 26
+
+// Transcoder is an http.Handler transcoding PNG and JPEG images served by Handler to QOI for clients which
+// state image/qoi in their Accept header. Other responses and requests are passed through unchanged.
+//
+// The response body of Handler is decoded while it is being written, so it is never buffered as a whole.
+// Only the decoded image is held in memory, whose size is limited by MaxPixels.
+type Transcoder struct {
+	Handler http.Handler
+	// Encoder holds the settings used to encode transcoded images.
+	Encoder qoi.Encoder
+	// MaxPixels is the maximum amount of pixels of images to transcode. If 0, DefaultMaxPixels is used.
+	// Responses with larger images are replaced with an internal server error.
+	MaxPixels int
+}
+
+// Transcode returns a Transcoder wrapping h with default settings.
+func Transcode(h http.Handler) http.Handler {
+	return &Transcoder{Handler: h}
+}
+
+func (t *Transcoder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	if !acceptsQOI(r.Header.Values("Accept")) {
+		t.Handler.ServeHTTP(w, r)
+		return
+	}
+	inner := r
+	if r.Method == http.MethodHead {
+		// The image must be decoded to know the size of the QOI file, so its body is needed after all.
+		inner = r.Clone(r.Context())
+		inner.Method = http.MethodGet
+	}
+	tw := &transcodingWriter{t: t, w: w}
+	completed := false
+	defer func() {
+		if !completed && tw.pw != nil {
+			// Handler panicked: stop the decoding goroutine before the panic propagates.
+			tw.pw.CloseWithError(errors.New("handler did not complete"))
+			<-tw.done
+		}
+	}()
+	t.Handler.ServeHTTP(tw, inner)
+	completed = true
+	tw.finish(r)
+}
+
+// acceptsQOI reports whether the Accept header values explicitly list image/qoi with a non-zero quality.
+// Wildcards are not considered, as clients accepting image/* may well not know QOI.
+func acceptsQOI(accept []string) bool {
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mediaType != ContentType {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// imageCodec holds the functions decoding a transcoded image format.
+type imageCodec struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+}
+
+var codecs = map[string]imageCodec{
+	"image/png":  {png.Decode, png.DecodeConfig},
+	"image/jpeg": {jpeg.Decode, jpeg.DecodeConfig},
+}
+
+// transcodingWriter is the http.ResponseWriter passed to the handler wrapped by a Transcoder. Once the
+// handler sends a transcodable response, its body is piped to a goroutine decoding the image.
+type transcodingWriter struct {
+	t           *Transcoder
+	w           http.ResponseWriter
+	wroteHeader bool
+	// pw is the pipe to the decoding goroutine, which sends its result to done. Both are nil unless the
+	// response is transcoded.
+	pw   *io.PipeWriter
+	done chan transcodeResult
+}
+
+type transcodeResult struct {
+	img image.Image
+	err error
+}
+
+func (tw *transcodingWriter) Header() http.Header {
+	return tw.w.Header()
+}
+
+func (tw *transcodingWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	h := tw.w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	codec, ok := codecs[mediaType]
+	if code != http.StatusOK || !ok || h.Get("Content-Encoding") != "" {
+		tw.w.WriteHeader(code)
+		return
+	}
+	pr, pw := io.Pipe()
+	tw.pw = pw
+	tw.done = make(chan transcodeResult, 1)
+	go func() {
+		img, err := tw.t.decode(pr, codec)
+		if err == nil {
+			// Drain the rest of the body, so the handler does not block on writing it.
+			_, err = io.Copy(io.Discard, pr)
+		}
+		// On failure, make further writes of the handler fail instead of block.
+		pr.CloseWithError(err)
+		tw.done <- transcodeResult{img, err}
+	}()
+}
+
+func (tw *transcodingWriter) Write(p []byte) (int, error) {
+	if !tw.wroteHeader {
+		if tw.w.Header().Get("Content-Type") == "" {
+			tw.w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.pw != nil {
+		return tw.pw.Write(p)
+	}
+	return tw.w.Write(p)
+}
+
+// finish completes the response after the handler returned, encoding the transcoded image if any.
+func (tw *transcodingWriter) finish(r *http.Request) {
+	if tw.pw == nil {
+		return
+	}
+	tw.pw.Close()
+	res := <-tw.done
+	h := tw.w.Header()
+	// The validators and size describe the original image, not the QOI file.
+	h.Del("Content-Length")
+	h.Del("ETag")
+	if res.err != nil {
+		http.Error(tw.w, "could not transcode image: "+res.err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ServeImageWith(tw.w, r, res.img, &tw.t.Encoder)
+}
+
+// decode decodes an image from r, after checking its size against MaxPixels.
+func (t *Transcoder) decode(r io.Reader, codec imageCodec) (image.Image, error) {
+	maxPixels := t.MaxPixels
+	if maxPixels == 0 {
+		maxPixels = DefaultMaxPixels
+	}
+	// Keep the bytes consumed by decodeConfig, so decode can read them again.
+	var head bytes.Buffer
+	cfg, err := codec.decodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(cfg.Width)*uint64(cfg.Height) > uint64(maxPixels) {
+		return nil, fmt.Errorf("%w: %dx%d image exceeds limit of %d pixels", qoi.ErrTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+	return codec.decode(io.MultiReader(&head, r))
+}
@@ -0,0 +1,81 @@
+package qoihttp_test
+
+import (
+	"bytes"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoihttp"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestTranscoder(t *testing.T) {
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 64, Height: 48, Alpha: qoitest.BinaryAlpha, RunLength: 4, Colors: 16,
+	})
+	pngContent := bytes.NewBuffer(nil)
+	if err := png.Encode(pngContent, img); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(pngContent.Len()))
+		w.Write(pngContent.Bytes())
+	})
+	mux.HandleFunc("/sniffed", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngContent.Bytes())
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	tc := &qoihttp.Transcoder{Handler: mux}
+
+	serve := func(method, path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		tc.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, path := range []string{"/image.png", "/sniffed"} {
+		rec := serve(http.MethodGet, path, "image/qoi, image/png;q=0.8")
+		if ct := rec.Header().Get("Content-Type"); ct != qoihttp.ContentType {
+			t.Fatalf("%s: expected Content-Type %q, got %q", path, qoihttp.ContentType, ct)
+		}
+		if cl := rec.Header().Get("Content-Length"); cl != strconv.Itoa(rec.Body.Len()) {
+			t.Fatalf("%s: Content-Length %s does not match body of %d bytes", path, cl, rec.Body.Len())
+		}
+		decoded, err := qoi.DecodeBytes(rec.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		qoitest.RequireImagesEqual(t, decoded, img)
+	}
+
+	rec := serve(http.MethodHead, "/image.png", "image/qoi")
+	if rec.Header().Get("Content-Type") != qoihttp.ContentType || rec.Body.Len() != 0 {
+		t.Fatalf("HEAD: expected QOI headers and empty body, got %q with %d bytes", rec.Header().Get("Content-Type"), rec.Body.Len())
+	}
+	for _, accept := range []string{"", "image/*", "image/qoi;q=0"} {
+		rec = serve(http.MethodGet, "/image.png", accept)
+		if !bytes.Equal(rec.Body.Bytes(), pngContent.Bytes()) {
+			t.Fatalf("Accept %q: expected PNG to be passed through", accept)
+		}
+	}
+	if rec = serve(http.MethodGet, "/text", "image/qoi"); rec.Body.String() != "hello" {
+		t.Fatalf("expected non-image response to be passed through, got %q", rec.Body.String())
+	}
+
+	tc.MaxPixels = 64*48 - 1
+	if rec = serve(http.MethodGet, "/image.png", "image/qoi"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d for image exceeding MaxPixels, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
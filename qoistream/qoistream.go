@@ -0,0 +1,151 @@
+// Package qoistream implements a simple container for sequences of QOI images, e.g. recordings of a screen
+// or camera, to be written to files or sent over sockets.
+//
+// A stream starts with the 8 bytes "qoistrm" followed by the version 1. Each frame follows as a big-endian
+// int64 timestamp in nanoseconds, a big-endian uint32 length and that many bytes holding a QOI file. The
+// stream ends where a frame would start.
+package qoistream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"time"
+
+	"github.com/Zyl9393/qoi"
+)
+
+const (
+	magic           = "qoistrm\x01"
+	frameHeaderSize = 12
+)
+
+// ErrBadMagic is returned when a stream does not start with the magic bytes of a version 1 stream.
+var ErrBadMagic = errors.New("bad stream magic")
+
+// StreamWriter writes frames to a stream.
+type StreamWriter struct {
+	// Encoder holds the settings WriteFrame encodes images with.
+	Encoder qoi.Encoder
+
+	w   io.Writer
+	buf bytes.Buffer
+	err error
+}
+
+// NewStreamWriter returns a StreamWriter writing to w, after writing the magic bytes of the stream.
+func NewStreamWriter(w io.Writer) (*StreamWriter, error) {
+	if _, err := io.WriteString(w, magic); err != nil {
+		return nil, err
+	}
+	return &StreamWriter{w: w}, nil
+}
+
+// WriteFrame encodes img and writes it as a frame with the given timestamp, which is usually the time since
+// the start of the recording.
+func (sw *StreamWriter) WriteFrame(timestamp time.Duration, img image.Image) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	// The length precedes the frame, so the frame needs to be encoded in full before it can be written.
+	sw.buf.Reset()
+	if err := sw.Encoder.Encode(&sw.buf, img); err != nil {
+		return err
+	}
+	return sw.WriteEncodedFrame(timestamp, sw.buf.Bytes())
+}
+
+// WriteEncodedFrame writes data as a frame with the given timestamp. data should hold a QOI file, e.g. one
+// written by qoi.DeltaEncoder, but is not checked.
+func (sw *StreamWriter) WriteEncodedFrame(timestamp time.Duration, data []byte) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if uint64(len(data)) > math.MaxUint32 {
+		return fmt.Errorf("frame of %d bytes exceeds maximum frame size of %d bytes", len(data), uint32(math.MaxUint32))
+	}
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:8], uint64(timestamp))
+	binary.BigEndian.PutUint32(header[8:], uint32(len(data)))
+	if _, err := sw.w.Write(header[:]); err != nil {
+		sw.err = err
+		return err
+	}
+	if _, err := sw.w.Write(data); err != nil {
+		sw.err = err
+		return err
+	}
+	return nil
+}
+
+// StreamReader reads frames from a stream.
+type StreamReader struct {
+	// Decoder holds the settings ReadFrame decodes images with.
+	Decoder qoi.Decoder
+
+	r   *bufio.Reader
+	buf bytes.Buffer
+	err error
+}
+
+// NewStreamReader returns a StreamReader reading from r, after reading and checking the magic bytes of the
+// stream.
+func NewStreamReader(r io.Reader) (*StreamReader, error) {
+	br := bufio.NewReader(r)
+	var b [len(magic)]byte
+	if _, err := io.ReadFull(br, b[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("could not read stream magic: %w", err)
+	}
+	if string(b[:]) != magic {
+		return nil, fmt.Errorf("%w: %q", ErrBadMagic, b[:])
+	}
+	return &StreamReader{r: br}, nil
+}
+
+// ReadEncodedFrame reads the next frame, returning its timestamp and data. The data is only valid until the
+// next call to ReadEncodedFrame or ReadFrame. At the end of the stream, it returns io.EOF. If the stream
+// ends within a frame, it returns io.ErrUnexpectedEOF.
+func (sr *StreamReader) ReadEncodedFrame() (time.Duration, []byte, error) {
+	if sr.err != nil {
+		return 0, nil, sr.err
+	}
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(sr.r, header[:]); err != nil {
+		sr.err = err
+		return 0, nil, err
+	}
+	timestamp := time.Duration(binary.BigEndian.Uint64(header[:8]))
+	n := int64(binary.BigEndian.Uint32(header[8:]))
+	// Copy instead of allocating n bytes up front, so a corrupt length cannot cause a huge allocation.
+	sr.buf.Reset()
+	if _, err := io.CopyN(&sr.buf, sr.r, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		sr.err = fmt.Errorf("could not read frame of %d bytes at %v: %w", n, timestamp, err)
+		return 0, nil, sr.err
+	}
+	return timestamp, sr.buf.Bytes(), nil
+}
+
+// ReadFrame reads the next frame and decodes it, returning its timestamp and image. At the end of the
+// stream, it returns io.EOF.
+func (sr *StreamReader) ReadFrame() (time.Duration, *qoi.Image, error) {
+	timestamp, data, err := sr.ReadEncodedFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+	img, err := sr.Decoder.DecodeBytes(data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not decode frame at %v: %w", timestamp, err)
+	}
+	return timestamp, img, nil
+}
@@ -0,0 +1,72 @@
+package qoistream_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zyl9393/qoi/qoistream"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+func TestStream(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	frames := make([]qoitest.ImageOptions, 3)
+	for i := range frames {
+		frames[i] = qoitest.ImageOptions{Width: 16 + i, Height: 8, Alpha: qoitest.BinaryAlpha, RunLength: 3, Colors: 8}
+	}
+	out := bytes.NewBuffer(nil)
+	sw, err := qoistream.NewStreamWriter(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := make([]image.Image, len(frames))
+	for i, opts := range frames {
+		img := qoitest.RandomImage(rng, opts)
+		images[i] = img
+		if err = sw.WriteFrame(time.Duration(i)*time.Second/30, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := out.Bytes()
+
+	sr, err := qoistream.NewStreamReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range frames {
+		timestamp, img, err := sr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := time.Duration(i) * time.Second / 30; timestamp != want {
+			t.Fatalf("frame %d: expected timestamp %v, got %v", i, want, timestamp)
+		}
+		qoitest.RequireImagesEqual(t, img, images[i])
+	}
+	if _, _, err = sr.ReadFrame(); err != io.EOF {
+		t.Fatalf("expected io.EOF at end of stream, got %v", err)
+	}
+
+	sr, err = qoistream.NewStreamReader(bytes.NewReader(data[:len(data)-5]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(frames)-1; i++ {
+		if _, _, err = sr.ReadEncodedFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err = sr.ReadEncodedFrame(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF for truncated frame, got %v", err)
+	}
+
+	if _, err = qoistream.NewStreamReader(strings.NewReader("qoifxxxx")); !errors.Is(err, qoistream.ErrBadMagic) {
+		t.Fatalf("expected %v, got %v", qoistream.ErrBadMagic, err)
+	}
+}
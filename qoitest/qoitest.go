@@ -0,0 +1,136 @@
+package qoitest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// RequireRoundTrip encodes img at every qoi.CompressionLevel, decodes each encoding strictly and fails t
+// unless the decoded image has the pixels of img. It returns the image decoded from the default encoding.
+func RequireRoundTrip(t testing.TB, img image.Image) *qoi.Image {
+	t.Helper()
+	var first *qoi.Image
+	for _, level := range []qoi.CompressionLevel{qoi.DefaultCompression, qoi.BestSpeed, qoi.BestCompression} {
+		enc := qoi.Encoder{CompressionLevel: level}
+		var buf bytes.Buffer
+		if err := enc.Encode(&buf, img); err != nil {
+			t.Fatalf("compression level %d: could not encode: %v", level, err)
+		}
+		dec := qoi.Decoder{Strict: true}
+		decoded, err := dec.DecodeBytes(buf.Bytes())
+		if err != nil {
+			t.Fatalf("compression level %d: could not decode: %v", level, err)
+		}
+		if equal, at := qoi.ImagesEqual(decoded, img, 0); !equal {
+			t.Fatalf("compression level %d: decoded pixel at %v is %v, expected %v", level, at, decoded.At(at.X, at.Y), img.At(img.Bounds().Min.X+at.X, img.Bounds().Min.Y+at.Y))
+		}
+		if first == nil {
+			first = decoded
+		}
+	}
+	return first
+}
+
+// RequireImagesEqual fails t unless got and want have the same bounds and the same non-premultiplied
+// pixels.
+func RequireImagesEqual(t testing.TB, got, want image.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds are %v, expected %v", got.Bounds(), want.Bounds())
+	}
+	if equal, at := qoi.ImagesEqual(got, want, 0); !equal {
+		t.Fatalf("pixel at %v is %v, expected %v", at, got.At(at.X, at.Y), want.At(at.X, at.Y))
+	}
+}
+
+// RequireQOIEqual fails t unless got and want have the same size, channels, colorspace and pixels. Their
+// Stride and the padding between rows may differ.
+func RequireQOIEqual(t testing.TB, got, want *qoi.Image) {
+	t.Helper()
+	if got.Width != want.Width || got.Height != want.Height {
+		t.Fatalf("size is %dx%d, expected %dx%d", got.Width, got.Height, want.Width, want.Height)
+	}
+	if got.Channels != want.Channels {
+		t.Fatalf("image has %d channels, expected %d", got.Channels, want.Channels)
+	}
+	if got.Colorspace != want.Colorspace {
+		t.Fatalf("colorspace is %d, expected %d", got.Colorspace, want.Colorspace)
+	}
+	RequireImagesEqual(t, got, want)
+}
+
+// Alpha selects the alpha values of the pixels of images generated by RandomImage.
+type Alpha int
+
+const (
+	// Opaque makes all pixels opaque.
+	Opaque Alpha = iota
+	// BinaryAlpha makes each pixel either fully transparent or opaque.
+	BinaryAlpha
+	// RandomAlpha gives each pixel a random alpha value.
+	RandomAlpha
+)
+
+// ImageOptions controls the characteristics of images generated by RandomImage, and thereby which ops
+// their encodings consist of.
+type ImageOptions struct {
+	Width, Height int
+	Alpha         Alpha
+	// RunLength is the average length of runs of identical pixels, which are encoded as RUN ops. If 0 or 1,
+	// identical pixels only follow each other by chance.
+	RunLength int
+	// Colors limits the amount of distinct colors, so that INDEX ops become likely. If 0, colors are not
+	// limited.
+	Colors int
+	// Smooth makes each color differ only slightly from the one before it, so that DIFF and LUMA ops become
+	// likely. It has no effect if Colors is set.
+	Smooth bool
+}
+
+// RandomImage returns an image with the characteristics given by opts, with pixels drawn from rng.
+func RandomImage(rng *rand.Rand, opts ImageOptions) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	palette := make([]color.NRGBA, opts.Colors)
+	for i := range palette {
+		palette[i] = randomColor(rng, opts.Alpha)
+	}
+	c := randomColor(rng, opts.Alpha)
+	for i := 0; i < len(img.Pix); i += 4 {
+		repeat := i > 0 && opts.RunLength > 1 && rng.Intn(opts.RunLength) != 0
+		switch {
+		case repeat:
+		case len(palette) > 0:
+			c = palette[rng.Intn(len(palette))]
+		case opts.Smooth:
+			c.R += uint8(rng.Intn(9)) - 4
+			c.G += uint8(rng.Intn(9)) - 4
+			c.B += uint8(rng.Intn(9)) - 4
+			if opts.Alpha == RandomAlpha && rng.Intn(8) == 0 {
+				c.A = uint8(rng.Intn(256))
+			}
+		default:
+			c = randomColor(rng, opts.Alpha)
+		}
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func randomColor(rng *rand.Rand, alpha Alpha) color.NRGBA {
+	v := rng.Uint32()
+	c := color.NRGBA{R: uint8(v), G: uint8(v >> 8), B: uint8(v >> 16), A: 255}
+	switch alpha {
+	case BinaryAlpha:
+		if v>>24&1 == 0 {
+			c.A = 0
+		}
+	case RandomAlpha:
+		c.A = uint8(v >> 24)
+	}
+	return c
+}
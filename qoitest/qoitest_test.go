@@ -0,0 +1,81 @@
+package qoitest_test
+
+import (
+	"bytes"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoitest"
+)
+
+// TestReferenceImages verifies this package against the official test images, if QOI_TEST_IMAGES points
+// to a directory holding them.
+func TestReferenceImages(t *testing.T) {
+	dir := os.Getenv("QOI_TEST_IMAGES")
+	if dir == "" {
+		t.Skip("QOI_TEST_IMAGES is not set")
+	}
+	if err := qoitest.VerifyReferenceImages(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyReferenceImages(t *testing.T) {
+	pngContent, err := os.ReadFile("../testdata/cyberpanel1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := qoitest.VerifyReferenceImages(dir); err == nil {
+		t.Fatalf("expected error for directory without images")
+	}
+	err = os.WriteFile(filepath.Join(dir, "cyberpanel1.png"), pngContent, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiEncode := bytes.NewBuffer(nil)
+	err = qoi.Encode(qoiEncode, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qoiContent := qoiEncode.Bytes()
+	err = os.WriteFile(filepath.Join(dir, "cyberpanel1.qoi"), qoiContent, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qoitest.VerifyReferenceImages(dir); err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the start of the body.
+	qoiContent[14+1] ^= 1
+	err = os.WriteFile(filepath.Join(dir, "cyberpanel1.qoi"), qoiContent, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qoitest.VerifyReferenceImages(dir); err == nil {
+		t.Fatalf("expected error for corrupted image")
+	}
+}
+
+func TestRequireRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, opts := range []qoitest.ImageOptions{
+		{Width: 31, Height: 17},
+		{Width: 31, Height: 17, Alpha: qoitest.BinaryAlpha, RunLength: 70},
+		{Width: 31, Height: 17, Alpha: qoitest.RandomAlpha, Colors: 5},
+		{Width: 31, Height: 17, Alpha: qoitest.RandomAlpha, Smooth: true},
+	} {
+		img := qoitest.RandomImage(rng, opts)
+		decoded := qoitest.RequireRoundTrip(t, img)
+		qoitest.RequireImagesEqual(t, decoded, img)
+		qoitest.RequireQOIEqual(t, decoded.Clone(), decoded)
+	}
+}
@@ -0,0 +1,98 @@
+// Package qoitest provides helpers for testing code built on package qoi, and for testing package qoi
+// itself against reference files.
+package qoitest
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// VerifyReferenceImages checks this package against pairs of NAME.qoi and NAME.png files in dir, such as the
+// official test images available at https://qoiformat.org/qoi_test_images.zip. For each pair, the QOI file
+// must decode to the pixels of the PNG file, and re-encoding the decoded image with the channels stated in
+// the QOI header must reproduce the QOI file byte for byte, as the reference encoder emits the same ops.
+// Encoding the PNG image must also decode to its pixels. The error for the first failing pair is returned.
+// An error is also returned if dir holds no pairs at all.
+func VerifyReferenceImages(dir string) error {
+	qoiPaths, err := filepath.Glob(filepath.Join(dir, "*.qoi"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(qoiPaths)
+	pairs := 0
+	for _, qoiPath := range qoiPaths {
+		pngPath := strings.TrimSuffix(qoiPath, ".qoi") + ".png"
+		if _, err := os.Stat(pngPath); os.IsNotExist(err) {
+			continue
+		}
+		if err := verifyReferenceImage(qoiPath, pngPath); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(qoiPath), err)
+		}
+		pairs++
+	}
+	if pairs == 0 {
+		return fmt.Errorf("no pairs of .qoi and .png files in %s", dir)
+	}
+	return nil
+}
+
+func verifyReferenceImage(qoiPath, pngPath string) error {
+	qoiContent, err := os.ReadFile(qoiPath)
+	if err != nil {
+		return err
+	}
+	pngContent, err := os.ReadFile(pngPath)
+	if err != nil {
+		return err
+	}
+	pngImg, err := png.Decode(bytes.NewReader(pngContent))
+	if err != nil {
+		return err
+	}
+	dec := qoi.Decoder{Strict: true}
+	img, err := dec.DecodeBytes(qoiContent)
+	if err != nil {
+		return err
+	}
+	if equal, at := qoi.ImagesEqual(img, pngImg, 0); !equal {
+		return fmt.Errorf("decoded image differs from PNG at %v", at)
+	}
+
+	enc := qoi.Encoder{Channels: img.Channels}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), qoiContent) {
+		return fmt.Errorf("re-encoded image differs from QOI file at offset %d", mismatch(buf.Bytes(), qoiContent))
+	}
+
+	buf.Reset()
+	if err := qoi.Encode(&buf, pngImg); err != nil {
+		return err
+	}
+	roundTrip, err := dec.DecodeBytes(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("could not decode encoded PNG image: %w", err)
+	}
+	if equal, at := qoi.ImagesEqual(roundTrip, pngImg, 0); !equal {
+		return fmt.Errorf("encoded PNG image decodes differently at %v", at)
+	}
+	return nil
+}
+
+// mismatch returns the index of the first byte differing between a and b.
+func mismatch(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
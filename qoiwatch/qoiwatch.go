@@ -0,0 +1,204 @@
+// Package qoiwatch keeps a directory of QOI images in sync with a directory of PNG and JPEG images, as
+// needed by asset pipelines.
+package qoiwatch
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zyl9393/qoi"
+)
+
+// DefaultInterval is the interval at which a Watcher with zero Interval scans its source directory.
+const DefaultInterval = time.Second
+
+// Watcher transcodes the PNG and JPEG files in a source directory and its subdirectories to QOI files in a
+// target directory. A file is transcoded if its QOI file does not exist yet or if its modification time
+// differs from that of the QOI file, which is set to that of the source file after transcoding. Hence, no
+// state needs to be kept between scans, and files changed while the Watcher was not running are picked up.
+//
+// Changes are detected by scanning the source directory periodically, so no platform-specific file system
+// notifications are required.
+type Watcher struct {
+	// Source is the directory holding the images to transcode.
+	Source string
+	// Target is the directory to write QOI files to.
+	Target string
+	// Interval is the time between scans of Run. If 0, DefaultInterval is used.
+	Interval time.Duration
+	// Workers is the maximum amount of files transcoded at once. If 0, runtime.GOMAXPROCS(0) is used.
+	Workers int
+	Encoder qoi.Encoder
+
+	// Name returns the path of the QOI file relative to Target for the path of a source file relative to
+	// Source, both slash-separated. If nil, the extension of the source file is replaced with ".qoi".
+	Name func(name string) string
+	// Process is called with each decoded source image, returning the image to encode instead, e.g. a
+	// resized version of it. If nil, images are encoded as decoded.
+	Process func(name string, img image.Image) (image.Image, error)
+	// OnDone is called after each attempt to transcode a file with the name of the source file, the path
+	// of the QOI file and the error which occurred, if any. It may be called from multiple goroutines
+	// concurrently.
+	OnDone func(name, target string, err error)
+}
+
+// Run scans the source directory until ctx is done, returning ctx.Err() then. Failing to transcode a file
+// does not stop Run, such errors are reported through OnDone; failing to scan the source directory does.
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.scan(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan transcodes all files of the source directory which changed since they were last transcoded, then
+// returns the first error which occurred.
+func (w *Watcher) Scan(ctx context.Context) error {
+	fileErr, err := w.scan(ctx)
+	if err != nil {
+		return err
+	}
+	return fileErr
+}
+
+type job struct {
+	name    string
+	modTime time.Time
+}
+
+// scan transcodes all changed files, returning the first error transcoding a file and the error which
+// stopped scanning the source directory separately.
+func (w *Watcher) scan(ctx context.Context) (fileErr, err error) {
+	workers := w.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := w.transcode(j); err != nil {
+					mu.Lock()
+					if fileErr == nil {
+						fileErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	err = filepath.WalkDir(w.Source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || decoderFor(path) == nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(w.Source, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if target, err := os.Stat(w.targetPath(name)); err == nil && target.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+		jobs <- job{name, info.ModTime()}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	return fileErr, err
+}
+
+func (w *Watcher) targetPath(name string) string {
+	var targetName string
+	if w.Name != nil {
+		targetName = w.Name(name)
+	} else {
+		targetName = strings.TrimSuffix(name, filepath.Ext(name)) + ".qoi"
+	}
+	return filepath.Join(w.Target, filepath.FromSlash(targetName))
+}
+
+// transcode transcodes the source file j, reporting the result to OnDone.
+func (w *Watcher) transcode(j job) error {
+	target := w.targetPath(j.name)
+	err := w.transcodeFile(j, target)
+	if err != nil {
+		err = fmt.Errorf("could not transcode %s: %w", j.name, err)
+	}
+	if w.OnDone != nil {
+		w.OnDone(j.name, target, err)
+	}
+	return err
+}
+
+func (w *Watcher) transcodeFile(j job, target string) error {
+	f, err := os.Open(filepath.Join(w.Source, filepath.FromSlash(j.name)))
+	if err != nil {
+		return err
+	}
+	img, err := decoderFor(j.name)(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if w.Process != nil {
+		if img, err = w.Process(j.name, img); err != nil {
+			return err
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err = w.Encoder.EncodeFile(target, img); err != nil {
+		return err
+	}
+	return os.Chtimes(target, j.modTime, j.modTime)
+}
+
+// decoderFor returns the function decoding the file at path judging by its extension, or nil if it is not
+// an image to transcode.
+func decoderFor(path string) func(io.Reader) (image.Image, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return png.Decode
+	case ".jpg", ".jpeg":
+		return jpeg.Decode
+	}
+	return nil
+}
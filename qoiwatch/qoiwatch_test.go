@@ -0,0 +1,110 @@
+package qoiwatch_test
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Zyl9393/qoi"
+	"github.com/Zyl9393/qoi/qoitest"
+	"github.com/Zyl9393/qoi/qoiwatch"
+)
+
+func TestWatcher(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	img := qoitest.RandomImage(rand.New(rand.NewSource(1)), qoitest.ImageOptions{
+		Width: 32, Height: 16, Alpha: qoitest.BinaryAlpha, RunLength: 3, Colors: 8,
+	})
+	writePNG := func(name string) {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err = png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePNG("a.png")
+	writePNG("sprites/b.PNG")
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var done []string
+	w := &qoiwatch.Watcher{
+		Source: src,
+		Target: dst,
+		Name: func(name string) string {
+			return strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name))) + ".qoi"
+		},
+		Process: func(name string, img image.Image) (image.Image, error) {
+			return img.(interface {
+				SubImage(image.Rectangle) image.Image
+			}).SubImage(image.Rect(0, 0, 8, 8)), nil
+		},
+		OnDone: func(name, target string, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			done = append(done, name)
+			mu.Unlock()
+		},
+	}
+	if err := w.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Fatalf("expected 2 files to be transcoded, got %v", done)
+	}
+	for _, name := range []string{"a.qoi", "sprites/b.qoi"} {
+		decoded, err := qoi.DecodeFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Width != 8 || decoded.Height != 8 {
+			t.Fatalf("%s: expected processed 8x8 image, got %dx%d", name, decoded.Width, decoded.Height)
+		}
+	}
+
+	if err := w.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Fatalf("expected unchanged files to be skipped, got %v", done)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(src, "a.png"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w.Interval = 10 * time.Millisecond
+	if err := w.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(done) != 3 || done[2] != "a.png" {
+		t.Fatalf("expected only a.png to be transcoded again, got %v", done)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "broken.png"), []byte("not a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.OnDone = nil
+	if err := w.Scan(context.Background()); err == nil || !strings.Contains(err.Error(), "broken.png") {
+		t.Fatalf("expected error for broken.png, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package qoi
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// DecodeResized decodes a QOI image from r, downscaled to fit into maxWidth x maxHeight while keeping its
+// aspect ratio. Images which already fit are decoded at their size. Rows are box-filtered as they are
+// decoded, so only the downscaled image is held in memory, never the image at its full size.
+func DecodeResized(r io.Reader, maxWidth, maxHeight int) (*Image, error) {
+	var dec Decoder
+	return dec.DecodeResized(r, maxWidth, maxHeight)
+}
+
+// DecodeResized is like the package-level DecodeResized, but uses the settings of dec. MaxBytes limits the
+// size of the downscaled image rather than that of the image at its full size.
+func (dec *Decoder) DecodeResized(r io.Reader, maxWidth, maxHeight int) (*Image, error) {
+	if maxWidth <= 0 || maxHeight <= 0 {
+		return nil, fmt.Errorf("invalid maximum size %dx%d: must be positive", maxWidth, maxHeight)
+	}
+	in, header, err := dec.peekHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := dec.outputChannels(header)
+	if err != nil {
+		return nil, err
+	}
+	width, height := int(header.width), int(header.height)
+	outWidth, outHeight := fitSize(width, height, maxWidth, maxHeight)
+	// Check the size of the downscaled image like that of any image before allocating it.
+	outHeader := header
+	outHeader.width, outHeader.height = uint32(outWidth), uint32(outHeight)
+	if err := dec.checkSize(outHeader, channels); err != nil {
+		return nil, err
+	}
+	if _, err := outHeader.pixLen(channels); err != nil {
+		return nil, err
+	}
+	colorspace := header.colorspace
+	if dec.ConvertColorspace {
+		colorspace = dec.Colorspace
+	}
+	img := NewImage(outWidth, outHeight, channels, colorspace)
+
+	// Pixels are averaged before premultiplying and swizzling them, which is done for the downscaled image instead.
+	rowDec := *dec
+	rowDec.MaxBytes, rowDec.Premultiply, rowDec.Swizzle = 0, false, ""
+	f := newBoxFilter(width, outWidth, int(channels))
+	outY := -1
+	err = rowDec.DecodeRows(in, func(y int, row []byte) error {
+		// With FlipVertical, rows arrive bottom-up, so each output row is complete once rows move on to the
+		// next one in either direction.
+		if y := y * outHeight / height; y != outY {
+			if outY >= 0 {
+				f.flush(img.Pix[img.offset(0, outY) : img.offset(0, outY)+outWidth*int(channels)])
+			}
+			outY = y
+		}
+		f.addRow(row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.flush(img.Pix[img.offset(0, outY) : img.offset(0, outY)+outWidth*int(channels)])
+	if dec.Premultiply {
+		img.Premultiply()
+	}
+	if dec.Swizzle != "" {
+		swizzleImage(img, dec.Swizzle)
+	}
+	return img, nil
+}
+
+// peekHeader wraps r in a buffer of dec.BufferSize bytes and returns it along with the header at its start,
+// which is left unread, so that the image can be decoded from the buffer once its header is known.
+func (dec *Decoder) peekHeader(r io.Reader) (*bufio.Reader, Header, error) {
+	bufferSize := dec.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	in := bufio.NewReaderSize(r, bufferSize)
+	b, err := in.Peek(qoiHeaderSize)
+	if err != nil {
+		return nil, Header{}, fmt.Errorf("could not decode header: could not read header: %w", truncated(err))
+	}
+	header, err := parseHeader(b)
+	if err != nil {
+		return nil, Header{}, fmt.Errorf("could not decode header: %w", err)
+	}
+	return in, header, nil
+}
+
+// DecodeThumbnail decodes a QOI image from r as a thumbnail fitting into fit.X x fit.Y, downscaled while
+// keeping its aspect ratio like DecodeResized does.
+func DecodeThumbnail(r io.Reader, fit image.Point) (*image.NRGBA, error) {
+	var dec Decoder
+	return dec.DecodeThumbnail(r, fit)
+}
+
+// DecodeThumbnail is like the package-level DecodeThumbnail, but uses the settings of dec. Premultiply and
+// Swizzle are ignored, as an *image.NRGBA holds non-premultiplied colors in RGBA order.
+func (dec *Decoder) DecodeThumbnail(r io.Reader, fit image.Point) (*image.NRGBA, error) {
+	thumbDec := *dec
+	thumbDec.Premultiply, thumbDec.Swizzle = false, ""
+	if thumbDec.Channels == 0 {
+		// Decode 4 channels right away, so that the pixels need not be copied to expand them.
+		thumbDec.Channels = 4
+	}
+	img, err := thumbDec.DecodeResized(r, fit.X, fit.Y)
+	if err != nil {
+		return nil, err
+	}
+	return img.ToNRGBA(), nil
+}
+
+// fitSize returns the size of an image of the given size scaled down to fit into maxWidth x maxHeight while
+// keeping its aspect ratio, or its size if it fits already. Neither dimension becomes less than 1.
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+	// Scale by the smaller of maxWidth/width and maxHeight/height, compared without division.
+	if uint64(maxWidth)*uint64(height) <= uint64(maxHeight)*uint64(width) {
+		return maxWidth, max1(int((uint64(height)*uint64(maxWidth) + uint64(width)/2) / uint64(width)))
+	}
+	return max1(int((uint64(width)*uint64(maxHeight) + uint64(height)/2) / uint64(height))), maxHeight
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// boxFilter averages the pixels of source rows of width pixels into rows of outWidth pixels, each source
+// pixel contributing to the output pixel covering it. Colors are weighted by alpha, so that the colors of
+// transparent pixels do not bleed into their neighbours.
+type boxFilter struct {
+	channels int
+	// columns maps each source column to its output column.
+	columns []int
+	// sums holds the alpha-weighted color and the alpha of the pixels added to each output pixel so far, and
+	// counts holds their amount.
+	sums   [][4]uint64
+	counts []uint64
+}
+
+func newBoxFilter(width, outWidth, channels int) *boxFilter {
+	f := &boxFilter{
+		channels: channels,
+		columns:  make([]int, width),
+		sums:     make([][4]uint64, outWidth),
+		counts:   make([]uint64, outWidth),
+	}
+	for x := range f.columns {
+		f.columns[x] = x * outWidth / width
+	}
+	return f
+}
+
+// addRow adds the pixels of the source row to the sums.
+func (f *boxFilter) addRow(row []byte) {
+	for x, outX := range f.columns {
+		px := row[x*f.channels : x*f.channels+f.channels]
+		a := uint64(255)
+		if f.channels == 4 {
+			a = uint64(px[3])
+		}
+		sum := &f.sums[outX]
+		sum[0] += uint64(px[0]) * a
+		sum[1] += uint64(px[1]) * a
+		sum[2] += uint64(px[2]) * a
+		sum[3] += a
+		f.counts[outX]++
+	}
+}
+
+// flush writes the averages of the sums to dst and resets them.
+func (f *boxFilter) flush(dst []byte) {
+	for x := range f.sums {
+		sum, count := f.sums[x], f.counts[x]
+		px := dst[x*f.channels : x*f.channels+f.channels]
+		if a := sum[3]; a > 0 {
+			px[0] = uint8((sum[0] + a/2) / a)
+			px[1] = uint8((sum[1] + a/2) / a)
+			px[2] = uint8((sum[2] + a/2) / a)
+		} else {
+			px[0], px[1], px[2] = 0, 0, 0
+		}
+		if f.channels == 4 {
+			px[3] = uint8((sum[3] + count/2) / count)
+		}
+		f.sums[x], f.counts[x] = [4]uint64{}, 0
+	}
+}
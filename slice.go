@@ -0,0 +1,165 @@
+package qoi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// DecodeBytes decodes a QOI image from data. It indexes data directly, avoiding the overhead of reading
+// through an io.Reader.
+func DecodeBytes(data []byte) (*Image, error) {
+	var dec Decoder
+	return dec.DecodeBytes(data)
+}
+
+// DecodeBytes is like the package-level DecodeBytes, but uses the settings of dec.
+func (dec *Decoder) DecodeBytes(data []byte) (*Image, error) {
+	if err := dec.checkConversions(); err != nil {
+		return nil, err
+	}
+	if len(data) < qoiHeaderSize {
+		return nil, fmt.Errorf("could not read header: %w", truncated(io.ErrUnexpectedEOF))
+	}
+	header, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	img, err := dec.newImage(header)
+	if err != nil {
+		return nil, err
+	}
+	d := newSliceDecoder(data, img.Width, img.Height)
+	err = dec.decodeBody(d, img.Pix, img.Width, img.Height, int(img.Channels), img.Stride)
+	dec.postprocess(img)
+	return img, err
+}
+
+// sliceDecoder is a rowDecoder indexing the body in a byte slice.
+type sliceDecoder struct {
+	// data holds the QOI stream, starting at offset base of the stream.
+	data []byte
+	base int64
+	// pos is the offset in data of the next byte to read.
+	pos int
+	opState
+}
+
+func newSliceDecoder(data []byte, width, height int) *sliceDecoder {
+	return &sliceDecoder{
+		data:    data,
+		pos:     qoiHeaderSize,
+		opState: newOpState(width, height),
+	}
+}
+
+func (d *sliceDecoder) decodeRow(row []byte, bytesPerPixel int) error {
+	if n := d.decodePixels(row, bytesPerPixel); n < len(row) {
+		return d.truncatedError()
+	}
+	return nil
+}
+
+// truncatedError returns the error to report when data ends before all pixels are decoded.
+func (d *sliceDecoder) truncatedError() error {
+	if d.pos < len(d.data) {
+		// The next op is incomplete.
+		d.lastOp, d.lastOpOffset = d.data[d.pos], d.base+int64(d.pos)
+	}
+	return d.truncatedAt(d.base + int64(len(d.data)))
+}
+
+// decodePixels decodes pixels into dest until it cannot fit another pixel or data ends, never stopping
+// within an op. It returns the amount of bytes written to dest.
+func (d *sliceDecoder) decodePixels(dest []byte, bytesPerPixel int) int {
+	data := d.data
+	pos := d.pos
+	px := d.px
+	run := d.run
+	n := 0
+	for n+bytesPerPixel <= len(dest) {
+		if run > 0 {
+			run--
+		} else {
+			if pos >= len(data) {
+				break
+			}
+			b1 := data[pos]
+			if pos+opSize(b1) > len(data) {
+				break
+			}
+			opOffset := pos
+			d.lastOp, d.lastOpOffset = b1, d.base+int64(opOffset)
+			pos++
+
+			switch {
+			case b1 == qoi_RGB:
+				copy(px[:3], data[pos:pos+3])
+				pos += 3
+			case b1 == qoi_RGBA:
+				copy(px[:], data[pos:pos+4])
+				pos += 4
+			case b1&qoi_MASK_2 == qoi_INDEX:
+				px = d.index[b1]
+			case b1&qoi_MASK_2 == qoi_DIFF:
+				px[0] += ((b1 >> 4) & 0x03) - 2
+				px[1] += ((b1 >> 2) & 0x03) - 2
+				px[2] += (b1 & 0x03) - 2
+			case b1&qoi_MASK_2 == qoi_LUMA:
+				b2 := data[pos]
+				pos++
+				vg := (b1 & 0b00111111) - 32
+				px[0] += vg - 8 + ((b2 >> 4) & 0x0f)
+				px[1] += vg
+				px[2] += vg - 8 + (b2 & 0x0f)
+			case b1&qoi_MASK_2 == qoi_RUN:
+				run = int(b1 & 0b00111111)
+				d.runOp, d.runOffset = b1, d.base+int64(opOffset)
+			default:
+				px = pixel{255, 0, 255, 255} // should not happen
+			}
+
+			d.index[int(qoi_COLOR_HASH(px[0], px[1], px[2], px[3]))&0b111111] = px
+		}
+
+		copy(dest[n:n+bytesPerPixel], px[:bytesPerPixel])
+		n += bytesPerPixel
+		d.numDecodedPixels++
+	}
+	d.px = px
+	d.run = run
+	d.pos = pos
+	return n
+}
+
+// opSize returns the size in bytes of the op starting with b1.
+func opSize(b1 byte) int {
+	switch {
+	case b1 == qoi_RGB:
+		return 4
+	case b1 == qoi_RGBA:
+		return 5
+	case b1&qoi_MASK_2 == qoi_LUMA:
+		return 2
+	}
+	return 1
+}
+
+func (d *sliceDecoder) readEnd() error {
+	if len(d.data)-d.pos < len(qoiEnd) {
+		return fmt.Errorf("could not read end marker: %w", truncated(io.ErrUnexpectedEOF))
+	}
+	end := d.data[d.pos : d.pos+len(qoiEnd)]
+	d.pos += len(qoiEnd)
+	if !bytes.Equal(end, qoiEnd) {
+		return fmt.Errorf("bad end marker %x", end)
+	}
+	return nil
+}
+
+func (d *sliceDecoder) verifyEOF() error {
+	if n := len(d.data) - d.pos; n > 0 {
+		return fmt.Errorf("%d bytes of trailing data after end marker", n)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package qoi
+
+import "io"
+
+// Op is a type of op of a QOI stream.
+type Op uint8
+
+const (
+	OpIndex Op = iota
+	OpDiff
+	OpLuma
+	OpRun
+	OpRGB
+	OpRGBA
+
+	numOps = 6
+)
+
+var opNames = [numOps]string{"INDEX", "DIFF", "LUMA", "RUN", "RGB", "RGBA"}
+
+// String returns the name of op as in the QOI specification, such as "INDEX".
+func (op Op) String() string {
+	if op >= numOps {
+		return "invalid op"
+	}
+	return opNames[op]
+}
+
+// maxRun is the longest run a RUN op can encode.
+const maxRun = 62
+
+// Stats holds statistics about the encoding of an image, as collected by Encoder.Stats. They show which
+// parts of the format an image makes use of, to tune content for compressibility.
+type Stats struct {
+	// Ops holds the amount of ops of each type, indexed by Op.
+	Ops [numOps]int
+	// Pixels holds the amount of pixels encoded by ops of each type, indexed by Op. It equals Ops for all
+	// types but OpRun.
+	Pixels [numOps]int
+	// RunLengths holds the amount of RUN ops encoding each length of run: RunLengths[n] counts the runs of n
+	// pixels, for n in 1..62. Runs longer than 62 pixels are split into several ops.
+	RunLengths [maxRun + 1]int
+	// InputBytes is the size of the pixels of the image stored raw, with the channels stated in the header.
+	InputBytes int64
+	// OutputBytes is the size of the QOI file written, including the CRC trailer and metadata chunks.
+	OutputBytes int64
+}
+
+// IndexHitRate returns the share of pixels which are not part of a run and were found in the index, in
+// 0..1. It is 0 if all pixels are part of runs.
+func (s *Stats) IndexHitRate() float64 {
+	total := 0
+	for op, n := range s.Ops {
+		if Op(op) != OpRun {
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Ops[OpIndex]) / float64(total)
+}
+
+// Ratio returns OutputBytes divided by InputBytes, which is less than 1 for images QOI compresses.
+func (s *Stats) Ratio() float64 {
+	if s.InputBytes == 0 {
+		return 0
+	}
+	return float64(s.OutputBytes) / float64(s.InputBytes)
+}
+
+// addOps counts the ops of b, which must hold complete ops.
+func (s *Stats) addOps(b []byte) {
+	for i := 0; i < len(b); {
+		op, size, pixels := OpIndex, 1, 1
+		switch {
+		case b[i] == qoi_RGB:
+			op, size = OpRGB, 4
+		case b[i] == qoi_RGBA:
+			op, size = OpRGBA, 5
+		case b[i]&qoi_MASK_2 == qoi_INDEX:
+		case b[i]&qoi_MASK_2 == qoi_DIFF:
+			op = OpDiff
+		case b[i]&qoi_MASK_2 == qoi_LUMA:
+			op, size = OpLuma, 2
+		default:
+			op, pixels = OpRun, int(b[i]&0b111111)+1
+			s.RunLengths[pixels]++
+		}
+		s.Ops[op]++
+		s.Pixels[op] += pixels
+		i += size
+	}
+}
+
+// statsWriter passes writes on to w, counting their size.
+type statsWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (sw *statsWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,194 @@
+package qoi
+
+import "fmt"
+
+// StreamDecoder incrementally decodes a QOI image from data pushed to it through Write, e.g. while the image
+// is still being downloaded. Rows of the image become available as soon as they are complete.
+//
+// The settings of the embedded Decoder are honored and must not be changed after the first call to Write.
+// Rows are converted as they are completed, so with Premultiply set, the rows reported by CompletedRows
+// already hold premultiplied alpha, as Decoder.Decode would return them.
+type StreamDecoder struct {
+	Decoder
+
+	buf []byte
+	d   *sliceDecoder
+	img *Image
+	// y is the amount of completed rows, x the amount of bytes decoded into the current row or wide.
+	y, x int
+	// wide receives the pixels of the current row with alpha if they are composited over the background.
+	wide []byte
+	// convert converts completed rows like Decoder.Decode converts the decoded image, if not nil.
+	convert func(row []byte)
+	// endRead is set once the end marker was consumed, trailerRead once the CRC trailer was consumed or
+	// found to be missing.
+	endRead     bool
+	trailerRead bool
+	// sum accumulates the CRC-32 of the decoded pixels if VerifyCRC is set.
+	sum *pixelSum
+	err error
+}
+
+// Write consumes p, decoding as many pixels as possible. Incomplete ops are kept until they are completed
+// by subsequent writes. Once the image and, if VerifyCRC is set, its CRC trailer are complete, further data
+// is discarded, unless Strict is set.
+func (s *StreamDecoder) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.Done() && !s.Strict && (!s.VerifyCRC || s.trailerRead) {
+		return len(p), nil
+	}
+	if s.img == nil && len(s.buf) == 0 {
+		if err := s.checkConversions(); err != nil {
+			s.err = err
+			return 0, err
+		}
+	}
+	s.buf = append(s.buf, p...)
+	if s.img == nil {
+		if len(s.buf) < qoiHeaderSize {
+			return len(p), nil
+		}
+		header, err := parseHeader(s.buf)
+		if err != nil {
+			s.err = err
+			return len(p), err
+		}
+		s.img, err = s.newImage(header)
+		if err != nil {
+			s.err = err
+			return len(p), err
+		}
+		s.d = newSliceDecoder(s.buf, s.img.Width, s.img.Height)
+		s.convert = s.rowConversion(s.img.Colorspace, int(s.img.Channels))
+		if s.ConvertColorspace {
+			s.img.Colorspace = s.Colorspace
+		}
+		if s.VerifyCRC {
+			s.sum = new(pixelSum)
+		}
+	}
+	s.d.data = s.buf
+	if err := s.decode(); err != nil {
+		s.err = err
+		return len(p), err
+	}
+	// Drop consumed bytes, so the buffer only ever holds an incomplete op or end marker.
+	s.d.base += int64(s.d.pos)
+	s.buf = append(s.buf[:0], s.buf[s.d.pos:]...)
+	s.d.data = s.buf
+	s.d.pos = 0
+	return len(p), nil
+}
+
+func (s *StreamDecoder) decode() error {
+	img := s.img
+	bytesPerPixel := int(img.Channels)
+	rowSize := img.Width * bytesPerPixel
+	for s.y < img.Height {
+		i := s.destRow(s.y, img.Height) * img.Stride
+		row := img.Pix[i : i+rowSize]
+		if s.composites(bytesPerPixel) {
+			// Decode with alpha, then composite into row, like Decoder.Decode.
+			if s.wide == nil {
+				s.wide = make([]byte, img.Width*4)
+			}
+			s.x += s.d.decodePixels(s.wide[s.x:], 4)
+			if s.x < len(s.wide) {
+				return nil
+			}
+			compositeRow(row, s.wide, s.Background)
+			if s.sum != nil {
+				s.sum.addRow(s.wide, 4, false)
+			}
+		} else {
+			s.x += s.d.decodePixels(row[s.x:], bytesPerPixel)
+			if s.x < rowSize {
+				return nil
+			}
+			if s.sum != nil {
+				s.sum.addRow(row, bytesPerPixel, false)
+			}
+		}
+		s.transformRow(row, bytesPerPixel)
+		if s.convert != nil {
+			s.convert(row)
+		}
+		s.y++
+		s.x = 0
+		if s.y == img.Height && s.Strict {
+			if err := s.d.verifyRun(); err != nil {
+				return err
+			}
+		}
+	}
+	if !s.Strict && !s.VerifyCRC {
+		return nil
+	}
+	if !s.endRead {
+		if len(s.d.data)-s.d.pos < len(qoiEnd) {
+			return nil
+		}
+		if err := s.d.readEnd(); err != nil {
+			return err
+		}
+		s.endRead = true
+	}
+	if s.VerifyCRC && !s.trailerRead {
+		if partialTrailer(s.d.data[s.d.pos:]) {
+			return nil
+		}
+		trailer, err := s.d.readTrailer()
+		if err != nil {
+			return err
+		}
+		if trailer != nil {
+			if err := s.sum.verify(trailer); err != nil {
+				return err
+			}
+		}
+		s.trailerRead = true
+	}
+	if !s.Strict {
+		return nil
+	}
+	return s.d.verifyEOF()
+}
+
+// Image returns the image being decoded, or nil if its header is not complete yet. Only the rows reported
+// by CompletedRows hold their final pixels.
+func (s *StreamDecoder) Image() *Image {
+	return s.img
+}
+
+// CompletedRows returns the amount of rows decoded so far. Rows are completed top-down, or bottom-up if
+// FlipVertical is set.
+func (s *StreamDecoder) CompletedRows() int {
+	return s.y
+}
+
+// Done reports whether all pixels of the image were decoded.
+func (s *StreamDecoder) Done() bool {
+	return s.img != nil && s.y == s.img.Height
+}
+
+// Close returns an error if the image is incomplete or decoding failed.
+func (s *StreamDecoder) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.img == nil {
+		return fmt.Errorf("%w: header incomplete", ErrTruncated)
+	}
+	if !s.Done() {
+		return s.d.truncatedError()
+	}
+	if (s.Strict || s.VerifyCRC) && !s.endRead {
+		return fmt.Errorf("could not read end marker: %w", ErrTruncated)
+	}
+	if s.VerifyCRC && !s.trailerRead && len(s.buf) > 0 {
+		return fmt.Errorf("could not read CRC trailer: %w", ErrTruncated)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package qoi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// swizzlePerm returns the permutation of channels selected by the channel order order, a permutation of
+// "RGBA" such as "BGRA" or "ARGB", for pixels of the given amount of channels: channel i of a swizzled pixel
+// is channel perm[i] of the RGB(A) pixel. For 3-channel pixels, alpha is left out of order.
+func swizzlePerm(order string, channels int) (perm [4]int, err error) {
+	if len(order) != 4 {
+		return perm, fmt.Errorf("invalid channel order %q: must be a permutation of \"RGBA\"", order)
+	}
+	channelNames := "RGBA"[:channels]
+	var seen [4]bool
+	i := 0
+	for _, name := range order {
+		c := strings.IndexRune("RGBA", name)
+		if c < 0 || seen[c] {
+			return perm, fmt.Errorf("invalid channel order %q: must be a permutation of \"RGBA\"", order)
+		}
+		seen[c] = true
+		if c < len(channelNames) {
+			perm[i] = c
+			i++
+		}
+	}
+	return perm, nil
+}
+
+// swizzleRow reorders the channels of the pixels of row, each bytesPerPixel bytes long, such that channel i
+// of each pixel becomes channel perm[i].
+func swizzleRow(row []byte, bytesPerPixel int, perm [4]int) {
+	var px [4]byte
+	for i := 0; i+bytesPerPixel <= len(row); i += bytesPerPixel {
+		copy(px[:], row[i:i+bytesPerPixel])
+		for c := 0; c < bytesPerPixel; c++ {
+			row[i+c] = px[perm[c]]
+		}
+	}
+}
+
+// unswizzleRow reverts swizzleRow.
+func unswizzleRow(row []byte, bytesPerPixel int, perm [4]int) {
+	var px [4]byte
+	for i := 0; i+bytesPerPixel <= len(row); i += bytesPerPixel {
+		copy(px[:], row[i:i+bytesPerPixel])
+		for c := 0; c < bytesPerPixel; c++ {
+			row[i+perm[c]] = px[c]
+		}
+	}
+}
+
+// swizzleImage reorders the channels of the pixels of img to order, which must be valid.
+func swizzleImage(img *Image, order string) {
+	n := int(img.Channels)
+	perm, _ := swizzlePerm(order, n)
+	for y := 0; y < img.Height; y++ {
+		i := img.offset(0, y)
+		swizzleRow(img.Pix[i:i+img.Width*n], n, perm)
+	}
+}
+
+// swizzlesRows reports whether dec swizzles rows as they are decoded. Converting the colorspace and
+// premultiplying alpha need to know where alpha is, so if either is configured, pixels are swizzled after
+// them instead.
+func (dec *Decoder) swizzlesRows() bool {
+	return dec.Swizzle != "" && !dec.ConvertColorspace && !dec.Premultiply
+}
@@ -0,0 +1,116 @@
+package qoi
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// TracedOp describes an op of a QOI stream, as reported by Trace.
+type TracedOp struct {
+	Op Op
+	// Offset is the offset of the op in the stream, counted from the start of the header, and Size its size
+	// in bytes.
+	Offset int64
+	Size   int
+	// Pixel is the index of the first pixel the op produces, counted in reading order from 0, and Pos its
+	// position in the image.
+	Pixel int
+	Pos   image.Point
+	// Pixels is the amount of pixels the op produces, which is 1 for all ops but RUN ops. The run of the last
+	// op may extend past the last pixel.
+	Pixels int
+	// Color is the color of the pixels the op produces, with alpha as stored even for 3-channel images.
+	Color color.NRGBA
+	// Index is the index position an INDEX op reads, or the index position the color of any other op is
+	// stored at.
+	Index int
+}
+
+// Trace walks the ops of the QOI stream read from r and calls fn for each of them, in order, without
+// decoding the image. It is meant for debugging, such as finding where two implementations start to
+// disagree about a file. Trace returns the header along with the first error returned by fn, or an error
+// if the stream ends before the last pixel, after calling fn for all complete ops up to there. It stops
+// after the op producing the last pixel and reads neither the end marker nor anything following it.
+func Trace(r io.Reader, fn func(op TracedOp) error) (Header, error) {
+	in, ok := r.(io.ByteReader)
+	if !ok {
+		in = bufio.NewReaderSize(r, defaultBufferSize)
+	}
+	var b [qoiHeaderSize]byte
+	for i := range b {
+		c, err := in.ReadByte()
+		if err != nil {
+			return Header{}, fmt.Errorf("could not read header: %w", truncated(err))
+		}
+		b[i] = c
+	}
+	header, err := parseHeader(b[:])
+	if err != nil {
+		return Header{}, err
+	}
+
+	width := int(header.width)
+	total := uint64(header.width) * uint64(header.height)
+	offset := int64(qoiHeaderSize)
+	var index [64]pixel
+	px := pixel{0, 0, 0, 255}
+	var raw [4]byte
+	for n := uint64(0); n < total; {
+		op := TracedOp{Offset: offset, Size: 1, Pixel: int(n), Pos: image.Pt(int(n%uint64(width)), int(n/uint64(width))), Pixels: 1}
+		b1, err := in.ReadByte()
+		if err != nil {
+			return header, fmt.Errorf("could not read op at offset %d for pixel %d of %d: %w", offset, n, total, truncated(err))
+		}
+		switch {
+		case b1 == qoi_RGB:
+			op.Op, op.Size = OpRGB, 4
+		case b1 == qoi_RGBA:
+			op.Op, op.Size = OpRGBA, 5
+		case b1&qoi_MASK_2 == qoi_INDEX:
+			op.Op = OpIndex
+		case b1&qoi_MASK_2 == qoi_DIFF:
+			op.Op = OpDiff
+		case b1&qoi_MASK_2 == qoi_LUMA:
+			op.Op, op.Size = OpLuma, 2
+		default:
+			op.Op, op.Pixels = OpRun, int(b1&0b111111)+1
+		}
+		for i := 0; i < op.Size-1; i++ {
+			if raw[i], err = in.ReadByte(); err != nil {
+				return header, fmt.Errorf("could not read %s op at offset %d for pixel %d of %d: %w", op.Op, offset, n, total, truncated(err))
+			}
+		}
+		switch op.Op {
+		case OpRGB:
+			px[0], px[1], px[2] = raw[0], raw[1], raw[2]
+		case OpRGBA:
+			px = pixel{raw[0], raw[1], raw[2], raw[3]}
+		case OpIndex:
+			px = index[b1]
+		case OpDiff:
+			px[0] += (b1>>4)&0x03 - 2
+			px[1] += (b1>>2)&0x03 - 2
+			px[2] += b1&0x03 - 2
+		case OpLuma:
+			vg := b1&0b111111 - 32
+			px[0] += vg - 8 + (raw[0]>>4)&0x0f
+			px[1] += vg
+			px[2] += vg - 8 + raw[0]&0x0f
+		}
+		op.Index = int(b1)
+		if op.Op != OpIndex {
+			op.Index = int(qoi_COLOR_HASH(px[0], px[1], px[2], px[3]) & 0b111111)
+			index[op.Index] = px
+		}
+		op.Color = color.NRGBA{R: px[0], G: px[1], B: px[2], A: px[3]}
+		if err := fn(op); err != nil {
+			return header, err
+		}
+		offset += int64(op.Size)
+		n += uint64(op.Pixels)
+	}
+	return header, nil
+}
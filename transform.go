@@ -0,0 +1,59 @@
+package qoi
+
+import "image"
+
+// FlipVertical mirrors img vertically in place.
+func (img *Image) FlipVertical() {
+	rowSize := img.Width * int(img.Channels)
+	tmp := make([]byte, rowSize)
+	for y0, y1 := 0, img.Height-1; y0 < y1; y0, y1 = y0+1, y1-1 {
+		row0 := img.Pix[img.offset(0, y0) : img.offset(0, y0)+rowSize]
+		row1 := img.Pix[img.offset(0, y1) : img.offset(0, y1)+rowSize]
+		copy(tmp, row0)
+		copy(row0, row1)
+		copy(row1, tmp)
+	}
+}
+
+// FlipHorizontal mirrors img horizontally in place.
+func (img *Image) FlipHorizontal() {
+	n := int(img.Channels)
+	for y := 0; y < img.Height; y++ {
+		row := img.Pix[img.offset(0, y) : img.offset(0, y)+img.Width*n]
+		for i, j := 0, len(row)-n; i < j; i, j = i+n, j-n {
+			for c := 0; c < n; c++ {
+				row[i+c], row[j+c] = row[j+c], row[i+c]
+			}
+		}
+	}
+}
+
+// Rotate90 rotates img by 90 degrees, clockwise or counter-clockwise, swapping its width and height. If the
+// rows of img are tightly packed, the rotated pixels are written back into Pix, otherwise Pix is replaced.
+// The top-left corner of the bounds of img is preserved.
+func (img *Image) Rotate90(clockwise bool) {
+	n := int(img.Channels)
+	width, height := img.Height, img.Width
+	rotated := make([]byte, width*height*n)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			dx, dy := img.Height-1-y, x
+			if !clockwise {
+				dx, dy = y, img.Width-1-x
+			}
+			i := img.offset(x, y)
+			j := (dy*width + dx) * n
+			copy(rotated[j:j+n], img.Pix[i:i+n])
+		}
+	}
+	if img.stride() == img.Width*n && len(img.Pix) >= len(rotated) {
+		img.Pix = img.Pix[:len(rotated)]
+		copy(img.Pix, rotated)
+	} else {
+		img.Pix = rotated
+	}
+	min := img.Bounds().Min
+	img.Stride = width * n
+	img.Width, img.Height = width, height
+	img.Rect = image.Rect(min.X, min.Y, min.X+width, min.Y+height)
+}
@@ -0,0 +1,19 @@
+package qoi
+
+// ColorTransformer transforms the colors of pixels while they are decoded or encoded, e.g. between the ICC
+// profile stored in Metadata.ICCProfile and that of a display, as computed by a color management library.
+// Rows are transformed as they pass through the decoder or encoder, so no additional pass over the image is
+// needed.
+type ColorTransformer interface {
+	// TransformRow transforms the pixels of row in place. Each pixel consists of channels bytes, holding
+	// red, green, blue and, if channels is 4, non-premultiplied alpha.
+	TransformRow(row []byte, channels int)
+}
+
+// ColorTransformerFunc adapts a function to a ColorTransformer.
+type ColorTransformerFunc func(row []byte, channels int)
+
+// TransformRow calls f(row, channels).
+func (f ColorTransformerFunc) TransformRow(row []byte, channels int) {
+	f(row, channels)
+}
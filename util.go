@@ -1,6 +1,9 @@
 package qoi
 
-import "image"
+import (
+	"image"
+	"image/color"
+)
 
 func isOpaqueImage(im image.Image) bool {
 	// Check if image has Opaque() method:
@@ -22,3 +25,181 @@ func isOpaqueImage(im image.Image) bool {
 
 	return true // All pixels are opaque, so is the image
 }
+
+// premultiplyRow premultiplies the color channels of 4-channel pixels in row by their alpha, rounding like
+// color.NRGBA's RGBA method does.
+func premultiplyRow(row []byte) {
+	for i := 0; i+3 < len(row); i += 4 {
+		a := uint32(row[i+3]) * 0x101
+		row[i+0] = uint8(uint32(row[i+0]) * a / 0xff >> 8)
+		row[i+1] = uint8(uint32(row[i+1]) * a / 0xff >> 8)
+		row[i+2] = uint8(uint32(row[i+2]) * a / 0xff >> 8)
+	}
+}
+
+// swapRB swaps the first and third channel of each pixel in row.
+func swapRB(row []byte, bytesPerPixel int) {
+	for i := 0; i+2 < len(row); i += bytesPerPixel {
+		row[i], row[i+2] = row[i+2], row[i]
+	}
+}
+
+// widenRow writes the 8-bit channels of src into dst as big-endian 16-bit channels.
+func widenRow(dst, src []byte) {
+	for i, c := range src {
+		dst[i*2] = c
+		dst[i*2+1] = c
+	}
+}
+
+// expandRGB writes the 3-channel pixels of src into dst as 4-channel pixels with alpha 255.
+// QOI ops depend on the pixel before them, so this and the other row helpers are the only loops that could be
+// vectorized; slicing fixed-size windows lets the compiler drop the per-byte bounds checks instead.
+func expandRGB(dst, src []byte) {
+	for len(src) >= 3 && len(dst) >= 4 {
+		s, d := src[:3:3], dst[:4:4]
+		d[0], d[1], d[2], d[3] = s[0], s[1], s[2], 255
+		src, dst = src[3:], dst[4:]
+	}
+}
+
+// pixelRows returns a function returning row y of img, which must be within its bounds, as 4-channel
+// non-premultiplied pixels, converted exactly like color.NRGBAModel converts the colors returned by img.At.
+// The returned row is only valid until the next call and must not be modified, as it may alias the Pix of
+// img.
+func pixelRows(img image.Image) func(y int) []byte {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	row := make([]byte, width*4)
+	switch img := img.(type) {
+	case *Image:
+		if img.Channels == 4 {
+			return func(y int) []byte {
+				i := img.PixOffset(bounds.Min.X, y)
+				return img.Pix[i : i+width*4]
+			}
+		}
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			expandRGB(row, img.Pix[i:i+width*3])
+			return row
+		}
+	case *image.NRGBA:
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			return img.Pix[i : i+width*4]
+		}
+	case *image.RGBA:
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			src := img.Pix[i : i+width*4]
+			for j := 0; j < len(src); j += 4 {
+				unpremultiply(row[j:j+4], uint32(src[j])*0x101, uint32(src[j+1])*0x101, uint32(src[j+2])*0x101, uint32(src[j+3])*0x101)
+			}
+			return row
+		}
+	case *image.NRGBA64:
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			src := img.Pix[i : i+width*8]
+			for j, k := 0, 0; j < len(src); j, k = j+8, k+4 {
+				c := color.NRGBA64{
+					R: uint16(src[j])<<8 | uint16(src[j+1]),
+					G: uint16(src[j+2])<<8 | uint16(src[j+3]),
+					B: uint16(src[j+4])<<8 | uint16(src[j+5]),
+					A: uint16(src[j+6])<<8 | uint16(src[j+7]),
+				}
+				r, g, b, a := c.RGBA()
+				unpremultiply(row[k:k+4], r, g, b, a)
+			}
+			return row
+		}
+	case *image.RGBA64:
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			src := img.Pix[i : i+width*8]
+			for j, k := 0, 0; j < len(src); j, k = j+8, k+4 {
+				unpremultiply(row[k:k+4],
+					uint32(src[j])<<8|uint32(src[j+1]),
+					uint32(src[j+2])<<8|uint32(src[j+3]),
+					uint32(src[j+4])<<8|uint32(src[j+5]),
+					uint32(src[j+6])<<8|uint32(src[j+7]))
+			}
+			return row
+		}
+	case *image.Gray:
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			for j, c := range img.Pix[i : i+width] {
+				row[j*4], row[j*4+1], row[j*4+2], row[j*4+3] = c, c, c, 255
+			}
+			return row
+		}
+	case *image.CMYK:
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			src := img.Pix[i : i+width*4]
+			for j := 0; j < len(src); j += 4 {
+				row[j], row[j+1], row[j+2] = color.CMYKToRGB(src[j], src[j+1], src[j+2], src[j+3])
+				row[j+3] = 255
+			}
+			return row
+		}
+	case *image.Paletted:
+		if len(img.Palette) == 0 {
+			break
+		}
+		palette := make([]color.NRGBA, len(img.Palette))
+		for i, c := range img.Palette {
+			palette[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+		return func(y int) []byte {
+			i := img.PixOffset(bounds.Min.X, y)
+			for j, ci := range img.Pix[i : i+width] {
+				c := palette[ci]
+				row[j*4], row[j*4+1], row[j*4+2], row[j*4+3] = c.R, c.G, c.B, c.A
+			}
+			return row
+		}
+	}
+	if img, ok := img.(image.RGBA64Image); ok && !isNRGBAModel(img.ColorModel()) {
+		// RGBA64At returns a concrete color, sparing the allocation of the color.Color returned by At.
+		return func(y int) []byte {
+			for x := 0; x < width; x++ {
+				c := img.RGBA64At(bounds.Min.X+x, y)
+				unpremultiply(row[x*4:x*4+4], uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A))
+			}
+			return row
+		}
+	}
+	return func(y int) []byte {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, y)).(color.NRGBA)
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = c.R, c.G, c.B, c.A
+		}
+		return row
+	}
+}
+
+// unpremultiply writes the 16-bit alpha-premultiplied color r, g, b, a into px as an 8-bit
+// non-premultiplied color, rounding like color.NRGBAModel does.
+func unpremultiply(px []byte, r, g, b, a uint32) {
+	switch a {
+	case 0xffff:
+		px[0], px[1], px[2], px[3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), 0xff
+	case 0:
+		px[0], px[1], px[2], px[3] = 0, 0, 0, 0
+	default:
+		px[0] = uint8((r * 0xffff) / a >> 8)
+		px[1] = uint8((g * 0xffff) / a >> 8)
+		px[2] = uint8((b * 0xffff) / a >> 8)
+		px[3] = uint8(a >> 8)
+	}
+}
+
+// isNRGBAModel reports whether the colors of model may be color.NRGBA values, which color.NRGBAModel
+// converts losslessly, but which lose precision when premultiplied, as by RGBA64At.
+func isNRGBAModel(model color.Model) bool {
+	_, isPalette := model.(color.Palette)
+	return model == color.NRGBAModel || isPalette
+}
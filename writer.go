@@ -0,0 +1,308 @@
+package qoi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// PixelWriter encodes an image of known size from pixels pushed to it incrementally, emitting ops as they
+// arrive, so the image is never held in memory as a whole.
+type PixelWriter struct {
+	out           *bufio.Writer
+	e             *opEncoder
+	bytesPerPixel int
+	// remaining is the amount of pixels yet to be written.
+	remaining int
+	// partial holds the first np bytes of a pixel split across calls to WritePixels.
+	partial [4]byte
+	np      int
+	// If swizzle is set, pixels are reordered from the channel order selected by perm to RGB(A) in swizzled.
+	swizzle  bool
+	perm     [4]int
+	swizzled []byte
+	err      error
+}
+
+// NewPixelWriter returns a PixelWriter encoding a width*height image with the given colorspace to w, from
+// pixels with the given amount of channels, which must be 3 (RGB) or 4 (RGBA).
+func NewPixelWriter(w io.Writer, width, height int, channels uint8, cs Colorspace) (*PixelWriter, error) {
+	var enc Encoder
+	return enc.NewPixelWriter(w, width, height, channels, cs)
+}
+
+// NewPixelWriter is like the package-level NewPixelWriter, but uses the settings of enc. The header states
+// enc.Channels if set, or channels otherwise.
+func (enc *Encoder) NewPixelWriter(w io.Writer, width, height int, channels uint8, cs Colorspace) (*PixelWriter, error) {
+	headerChannels, err := enc.headerChannels(channels, cs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(width, height); err != nil {
+		return nil, err
+	}
+	swizzle, perm, err := enc.swizzlePerm(int(channels))
+	if err != nil {
+		return nil, err
+	}
+	pw := &PixelWriter{
+		out:           writerPool.Get().(*bufio.Writer),
+		bytesPerPixel: int(channels),
+		remaining:     width * height,
+	}
+	pw.swizzle, pw.perm = swizzle, perm
+	pw.out.Reset(w)
+	var sum *pixelSum
+	if enc.CRC {
+		sum = new(pixelSum)
+	}
+	pw.e = newOpEncoder(pw.out, width, enc.options(), sum)
+	if err := encodeHeader(pw.out, width, height, int(headerChannels), cs); err != nil {
+		pw.release()
+		return nil, err
+	}
+	return pw, nil
+}
+
+// headerChannels returns the channels stated in the header of an image encoded by enc from pixels with the
+// given amount of channels and colorspace, if they are valid.
+func (enc *Encoder) headerChannels(channels uint8, cs Colorspace) (uint8, error) {
+	if channels != 3 && channels != 4 {
+		return 0, fmt.Errorf("%w %d: must be 3 or 4", ErrInvalidChannels, channels)
+	}
+	if cs != SRGB && cs != Linear {
+		return 0, fmt.Errorf("%w %d: must be 0 (sRGB) or 1 (linear RGB)", ErrInvalidColorspace, cs)
+	}
+	switch enc.Channels {
+	case 0:
+		return channels, nil
+	case 3, 4:
+		return enc.Channels, nil
+	}
+	return 0, fmt.Errorf("invalid amount of channels %d: must be 0, 3 or 4", enc.Channels)
+}
+
+// swizzlePerm returns whether enc.Swizzle is set and the permutation it selects for pixels with the given
+// amount of channels.
+func (enc *Encoder) swizzlePerm(channels int) (bool, [4]int, error) {
+	if enc.Swizzle == "" {
+		return false, [4]int{}, nil
+	}
+	perm, err := swizzlePerm(enc.Swizzle, channels)
+	return err == nil, perm, err
+}
+
+// WritePixels encodes the pixels in p, which follow the pixels of previous calls in row-major order. p
+// need not end on a pixel boundary; an incomplete pixel is completed by the next call. An error is
+// returned if p holds more pixels than remain in the image.
+func (pw *PixelWriter) WritePixels(p []byte) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	bpp := pw.bytesPerPixel
+	if pw.np > 0 {
+		n := copy(pw.partial[pw.np:bpp], p)
+		pw.np += n
+		p = p[n:]
+		if pw.np < bpp {
+			return nil
+		}
+		pw.np = 0
+		if err := pw.encode(pw.partial[:bpp]); err != nil {
+			return err
+		}
+	}
+	whole := len(p) / bpp * bpp
+	if err := pw.encode(p[:whole]); err != nil {
+		return err
+	}
+	pw.np = copy(pw.partial[:], p[whole:])
+	return nil
+}
+
+// encode encodes the whole pixels in pixels.
+func (pw *PixelWriter) encode(pixels []byte) error {
+	n := len(pixels) / pw.bytesPerPixel
+	if n > pw.remaining {
+		pw.err = fmt.Errorf("got %d pixels, but only %d remain in the image", n, pw.remaining)
+		return pw.err
+	}
+	if pw.swizzle {
+		pw.swizzled = append(pw.swizzled[:0], pixels...)
+		unswizzleRow(pw.swizzled, pw.bytesPerPixel, pw.perm)
+		pixels = pw.swizzled
+	}
+	pw.e.encodePixels(pixels, pw.bytesPerPixel)
+	pw.remaining -= n
+	return nil
+}
+
+// Close completes the image and flushes it to the underlying writer, which is not closed. An error is
+// returned if fewer pixels than the image has were written.
+func (pw *PixelWriter) Close() error {
+	if pw.out == nil {
+		return pw.err
+	}
+	// Release the buffer on every path, including failed writes, so it does not keep the underlying writer.
+	defer pw.release()
+	if pw.err != nil {
+		return pw.err
+	}
+	switch {
+	case pw.remaining > 0:
+		pw.err = fmt.Errorf("image incomplete: %d pixels missing", pw.remaining)
+		return pw.err
+	case pw.np > 0:
+		pw.err = fmt.Errorf("got %d bytes of an incomplete pixel after the last pixel of the image", pw.np)
+		return pw.err
+	}
+	pw.err = fmt.Errorf("PixelWriter is closed")
+	return pw.e.finishImage()
+}
+
+// release returns the buffer of pw to the pool.
+func (pw *PixelWriter) release() {
+	pw.out.Reset(nil)
+	writerPool.Put(pw.out)
+	pw.out = nil
+}
+
+// RowWriter encodes an image of known width from rows pushed to it one at a time, for sources which do not
+// know the height of the image up front. The height is the amount of rows written once the RowWriter is
+// closed. If the underlying writer is an io.WriteSeeker, ops are emitted as rows arrive and the height in
+// the header is backpatched by Close. Otherwise, the encoded image is buffered in memory until Close.
+type RowWriter struct {
+	w       io.Writer
+	ws      io.WriteSeeker
+	start   int64
+	body    *bytes.Buffer
+	out     *bufio.Writer
+	e       *opEncoder
+	header  [qoiHeaderSize]byte
+	width   int
+	rowSize int
+	height  int
+	// If swizzle is set, rows are reordered from the channel order selected by perm to RGB(A) in swizzled.
+	swizzle  bool
+	perm     [4]int
+	swizzled []byte
+	err      error
+}
+
+// NewRowWriter returns a RowWriter encoding an image of the given width and colorspace to w, from rows of
+// pixels with the given amount of channels, which must be 3 (RGB) or 4 (RGBA).
+func NewRowWriter(w io.Writer, width int, channels uint8, cs Colorspace) (*RowWriter, error) {
+	var enc Encoder
+	return enc.NewRowWriter(w, width, channels, cs)
+}
+
+// NewRowWriter is like the package-level NewRowWriter, but uses the settings of enc. The header states
+// enc.Channels if set, or channels otherwise.
+func (enc *Encoder) NewRowWriter(w io.Writer, width int, channels uint8, cs Colorspace) (*RowWriter, error) {
+	headerChannels, err := enc.headerChannels(channels, cs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDimensions(width, 1); err != nil {
+		return nil, err
+	}
+	swizzle, perm, err := enc.swizzlePerm(int(channels))
+	if err != nil {
+		return nil, err
+	}
+	rw := &RowWriter{
+		w:       w,
+		out:     writerPool.Get().(*bufio.Writer),
+		width:   width,
+		rowSize: width * int(channels),
+	}
+	rw.swizzle, rw.perm = swizzle, perm
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if start, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			rw.ws, rw.start = ws, start
+		}
+	}
+	if rw.ws != nil {
+		rw.out.Reset(w)
+	} else {
+		rw.body = new(bytes.Buffer)
+		rw.out.Reset(rw.body)
+	}
+	var sum *pixelSum
+	if enc.CRC {
+		sum = new(pixelSum)
+	}
+	rw.e = newOpEncoder(rw.out, width, enc.options(), sum)
+	// The height is filled in by Close.
+	copy(rw.header[:4], qoiMagic)
+	binary.BigEndian.PutUint32(rw.header[4:8], uint32(width))
+	rw.header[12] = headerChannels
+	rw.header[13] = uint8(cs)
+	if rw.ws != nil {
+		if _, err := rw.out.Write(rw.header[:]); err != nil {
+			rw.release()
+			return nil, err
+		}
+	}
+	return rw, nil
+}
+
+// WriteRow encodes row, which must hold exactly one row of pixels, as the next row of the image.
+func (rw *RowWriter) WriteRow(row []byte) error {
+	if rw.err != nil {
+		return rw.err
+	}
+	if len(row) != rw.rowSize {
+		return fmt.Errorf("row of %d bytes does not match row size of %d bytes", len(row), rw.rowSize)
+	}
+	if err := checkDimensions(rw.width, rw.height+1); err != nil {
+		rw.err = err
+		return err
+	}
+	if rw.swizzle {
+		rw.swizzled = append(rw.swizzled[:0], row...)
+		unswizzleRow(rw.swizzled, rw.rowSize/rw.width, rw.perm)
+		row = rw.swizzled
+	}
+	rw.e.encodePixels(row, rw.rowSize/rw.width)
+	rw.height++
+	return nil
+}
+
+// Close completes the image and writes what remains of it to the underlying writer, which is not closed.
+// An error is returned if no rows were written.
+func (rw *RowWriter) Close() error {
+	if rw.out == nil {
+		return rw.err
+	}
+	// Release the buffer on every path, including failed writes, so it does not keep the underlying writer.
+	defer rw.release()
+	if rw.err != nil {
+		return rw.err
+	}
+	rw.err = fmt.Errorf("RowWriter is closed")
+	if err := checkDimensions(rw.width, rw.height); err != nil {
+		return err
+	}
+	if err := rw.e.finishImage(); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(rw.header[8:12], uint32(rw.height))
+	if rw.ws != nil {
+		return backpatchHeader(rw.ws, rw.start, 8, rw.header[8:12])
+	}
+	if _, err := rw.w.Write(rw.header[:]); err != nil {
+		return err
+	}
+	_, err := rw.body.WriteTo(rw.w)
+	return err
+}
+
+// release returns the buffer of rw to the pool.
+func (rw *RowWriter) release() {
+	rw.out.Reset(nil)
+	writerPool.Put(rw.out)
+	rw.out = nil
+}
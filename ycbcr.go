@@ -0,0 +1,80 @@
+package qoi
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// DecodeYCbCr decodes a QOI image from r into a new *image.YCbCr, converting colors like color.RGBToYCbCr
+// does, as expected by video encoders. ratio must be image.YCbCrSubsampleRatio444, keeping the chroma of
+// each pixel, or image.YCbCrSubsampleRatio420, averaging the chroma of each 2x2 block. Alpha is discarded.
+func DecodeYCbCr(r io.Reader, ratio image.YCbCrSubsampleRatio) (*image.YCbCr, error) {
+	var dec Decoder
+	return dec.DecodeYCbCr(r, ratio)
+}
+
+// DecodeYCbCr is like the package-level DecodeYCbCr, but uses the settings of dec. Images are decoded into 3
+// channels regardless of Channels, so that CompositeAlpha can be used to composite them over a background
+// instead of discarding alpha. BGRA and Swizzle are ignored.
+func (dec *Decoder) DecodeYCbCr(r io.Reader, ratio image.YCbCrSubsampleRatio) (*image.YCbCr, error) {
+	if ratio != image.YCbCrSubsampleRatio444 && ratio != image.YCbCrSubsampleRatio420 {
+		return nil, fmt.Errorf("unsupported subsample ratio %v: must be 4:4:4 or 4:2:0", ratio)
+	}
+	in, header, err := dec.peekHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	rowDec := *dec
+	rowDec.Channels, rowDec.BGRA, rowDec.Swizzle = 3, false, ""
+	width, height := int(header.width), int(header.height)
+	dst := image.NewYCbCr(image.Rect(0, 0, width, height), ratio)
+	if ratio == image.YCbCrSubsampleRatio444 {
+		err = rowDec.DecodeRows(in, func(y int, row []byte) error {
+			i := y * dst.YStride
+			for x := 0; x < width; x++ {
+				dst.Y[i+x], dst.Cb[i+x], dst.Cr[i+x] = color.RGBToYCbCr(row[x*3], row[x*3+1], row[x*3+2])
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return dst, nil
+	}
+
+	// The chroma of each 2x2 block is summed up over both of its rows, which arrive in either order.
+	cbSums, crSums, counts := make([]uint32, dst.CStride), make([]uint32, dst.CStride), make([]uint32, dst.CStride)
+	chromaY := -1
+	flush := func() {
+		i := chromaY * dst.CStride
+		for cx, count := range counts {
+			dst.Cb[i+cx] = uint8((cbSums[cx] + count/2) / count)
+			dst.Cr[i+cx] = uint8((crSums[cx] + count/2) / count)
+			cbSums[cx], crSums[cx], counts[cx] = 0, 0, 0
+		}
+	}
+	err = rowDec.DecodeRows(in, func(y int, row []byte) error {
+		if y/2 != chromaY {
+			if chromaY >= 0 {
+				flush()
+			}
+			chromaY = y / 2
+		}
+		i := y * dst.YStride
+		for x := 0; x < width; x++ {
+			yy, cb, cr := color.RGBToYCbCr(row[x*3], row[x*3+1], row[x*3+2])
+			dst.Y[i+x] = yy
+			cbSums[x/2] += uint32(cb)
+			crSums[x/2] += uint32(cr)
+			counts[x/2]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	return dst, nil
+}